@@ -61,11 +61,14 @@ func luaImportMicroConfig() *lua.LTable {
 	pkg := ulua.L.NewTable()
 
 	ulua.L.SetField(pkg, "MakeCommand", luar.New(ulua.L, action.MakeCommand))
+	ulua.L.SetField(pkg, "RemoveCommand", luar.New(ulua.L, action.RemoveCommand))
+	ulua.L.SetField(pkg, "CommandExists", luar.New(ulua.L, action.CommandExists))
 	ulua.L.SetField(pkg, "FileComplete", luar.New(ulua.L, buffer.FileComplete))
 	ulua.L.SetField(pkg, "HelpComplete", luar.New(ulua.L, action.HelpComplete))
 	ulua.L.SetField(pkg, "OptionComplete", luar.New(ulua.L, action.OptionComplete))
 	ulua.L.SetField(pkg, "OptionValueComplete", luar.New(ulua.L, action.OptionValueComplete))
 	ulua.L.SetField(pkg, "NoComplete", luar.New(ulua.L, nil))
+	ulua.L.SetField(pkg, "MakeCompleter", luar.New(ulua.L, action.MakeCompleter))
 	ulua.L.SetField(pkg, "TryBindKey", luar.New(ulua.L, action.TryBindKey))
 	ulua.L.SetField(pkg, "Reload", luar.New(ulua.L, action.ReloadConfig))
 	ulua.L.SetField(pkg, "AddRuntimeFileFromMemory", luar.New(ulua.L, config.PluginAddRuntimeFileFromMemory))
@@ -91,8 +94,13 @@ func luaImportMicroShell() *lua.LTable {
 	pkg := ulua.L.NewTable()
 
 	ulua.L.SetField(pkg, "ExecCommand", luar.New(ulua.L, shell.ExecCommand))
+	ulua.L.SetField(pkg, "ExecCommandOutput", luar.New(ulua.L, shell.ExecCommandOutput))
+	ulua.L.SetField(pkg, "ExecCommandWithInput", luar.New(ulua.L, shell.ExecCommandWithInput))
 	ulua.L.SetField(pkg, "RunCommand", luar.New(ulua.L, shell.RunCommand))
+	ulua.L.SetField(pkg, "RunCommandOutput", luar.New(ulua.L, shell.RunCommandOutput))
 	ulua.L.SetField(pkg, "RunBackgroundShell", luar.New(ulua.L, shell.RunBackgroundShell))
+	ulua.L.SetField(pkg, "RunBackgroundShellExit", luar.New(ulua.L, shell.RunBackgroundShellExit))
+	ulua.L.SetField(pkg, "ExitCode", luar.New(ulua.L, shell.ExitCode))
 	ulua.L.SetField(pkg, "RunInteractiveShell", luar.New(ulua.L, shell.RunInteractiveShell))
 	ulua.L.SetField(pkg, "JobStart", luar.New(ulua.L, shell.JobStart))
 	ulua.L.SetField(pkg, "JobSpawn", luar.New(ulua.L, shell.JobSpawn))
@@ -16,6 +16,7 @@ import (
 	"github.com/zyedidia/micro/internal/action"
 	"github.com/zyedidia/micro/internal/buffer"
 	"github.com/zyedidia/micro/internal/config"
+	"github.com/zyedidia/micro/internal/remote"
 	"github.com/zyedidia/micro/internal/screen"
 	"github.com/zyedidia/micro/internal/shell"
 	"github.com/zyedidia/micro/internal/util"
@@ -24,8 +25,7 @@ import (
 
 var (
 	// Event channel
-	events   chan tcell.Event
-	autosave chan bool
+	events chan tcell.Event
 
 	// Command line flags
 	flagVersion   = flag.Bool("version", false, "Show the version number and information")
@@ -34,6 +34,7 @@ var (
 	flagDebug     = flag.Bool("debug", false, "Enable debug mode (prints debug info to ./log.txt)")
 	flagPlugin    = flag.String("plugin", "", "Plugin command")
 	flagClean     = flag.Bool("clean", false, "Clean configuration directory")
+	flagReadonly  = flag.Bool("r", false, "Open files readonly")
 	optionFlags   map[string]*string
 )
 
@@ -49,6 +50,8 @@ func InitFlags() {
 		fmt.Println("    \tSpecify a line and column to start the cursor at when opening a buffer")
 		fmt.Println("-options")
 		fmt.Println("    \tShow all option help")
+		fmt.Println("-r")
+		fmt.Println("    \tOpen files readonly (the same as -readonly true)")
 		fmt.Println("-debug")
 		fmt.Println("    \tEnable debug mode (enables logging to ./log.txt)")
 		fmt.Println("-version")
@@ -165,7 +168,25 @@ func LoadInput(files []File) []*buffer.Buffer {
 		// Option 1
 		// We go through each file and load it
 		for _, file := range files {
+			open, readonly := false, false
+			buffer.OpenBinary(file.Name, file.Type, func(question string, answer func(bool)) {
+				answer(screen.TermPrompt(question+" (y,n) ", []string{"y", "n"}, true) == 0)
+			}, func(ro bool) {
+				open, readonly = true, ro
+			})
+			if !open {
+				continue
+			}
 			buf, err := buffer.NewBufferFromFile(file.Name, file.Type, file.Passwords)
+			if os.IsPermission(err) {
+				sudo := config.GetGlobalOption("autosu").(bool)
+				if !sudo {
+					sudo = screen.TermPrompt("Permission denied reading "+file.Name+". Read it using sudo? (y,n) ", []string{"y", "n"}, true) == 0
+				}
+				if sudo {
+					buf, err = buffer.NewBufferFromFileWithSudo(file.Name, file.Type, file.Passwords)
+				}
+			}
 			if err != nil {
 				screen.TermMessage(err)
 				continue
@@ -174,6 +195,9 @@ func LoadInput(files []File) []*buffer.Buffer {
 				buf.Settings["password"] = file.Passwords[0].Secret
 				buf.Settings["passwordPrompted"] = file.Passwords[0].Prompted
 			}
+			if readonly {
+				buf.SetOptionNative("readonly", true)
+			}
 			// If the file didn't exist, input will be empty, and we'll open an empty buffer
 			buffers = append(buffers, buf)
 		}
@@ -197,6 +221,7 @@ func LoadInput(files []File) []*buffer.Buffer {
 
 func main() {
 	defer func() {
+		remote.CloseAll()
 		if util.Stdout.Len() > 0 {
 			fmt.Fprint(os.Stdout, util.Stdout.String())
 		}
@@ -270,6 +295,9 @@ func main() {
 			config.GlobalSettings[k] = nativeValue
 		}
 	}
+	if *flagReadonly {
+		config.GlobalSettings["readonly"] = true
+	}
 
 	DoPluginFlags()
 
@@ -313,6 +341,11 @@ func main() {
 	action.InitTabs(b)
 	action.InitGlobals()
 
+	if a := config.GetGlobalOption("autosave").(float64); a > 0 {
+		config.SetAutoTime(int(a))
+		config.StartAutoSave()
+	}
+
 	err = config.RunPluginFn("init")
 	if err != nil {
 		screen.TermMessage(err)
@@ -386,7 +419,11 @@ func DoEvent() {
 		f.Function(f.Output, f.Args)
 	case <-config.Autosave:
 		for _, b := range buffer.OpenBuffers {
-			b.Save()
+			if b.CanAutoSave() {
+				if err := b.Save(); err != nil {
+					action.InfoBar.Error(err)
+				}
+			}
 		}
 	case <-shell.CloseTerms:
 	case event = <-events:
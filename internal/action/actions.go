@@ -445,11 +445,17 @@ func (h *BufPane) InsertNewline() bool {
 	h.Buf.Insert(h.Cursor.Loc, "\n")
 	// h.Cursor.Right()
 
+	// continue a comment if the newline was inserted after its start
+	comment := ""
+	if cx > len(ws) {
+		comment = h.Buf.CommentContinuation(h.Cursor.Y - 1)
+	}
+
 	if h.Buf.Settings["autoindent"].(bool) {
 		if cx < len(ws) {
 			ws = ws[0:cx]
 		}
-		h.Buf.Insert(h.Cursor.Loc, string(ws))
+		h.Buf.Insert(h.Cursor.Loc, string(ws)+comment)
 		// for i := 0; i < len(ws); i++ {
 		// 	h.Cursor.Right()
 		// }
@@ -459,6 +465,8 @@ func (h *BufPane) InsertNewline() bool {
 			line := h.Buf.LineBytes(h.Cursor.Y - 1)
 			h.Buf.Remove(buffer.Loc{X: 0, Y: h.Cursor.Y - 1}, buffer.Loc{X: utf8.RuneCount(line), Y: h.Cursor.Y - 1})
 		}
+	} else if comment != "" {
+		h.Buf.Insert(h.Cursor.Loc, comment)
 	}
 	h.Cursor.LastVisualX = h.Cursor.GetVisualX()
 	h.Relocate()
@@ -484,10 +492,10 @@ func (h *BufPane) Backspace() bool {
 		tabSize := int(h.Buf.Settings["tabsize"].(float64))
 		if h.Buf.Settings["tabstospaces"].(bool) && util.IsSpaces(lineStart) && len(lineStart) != 0 && utf8.RuneCount(lineStart)%tabSize == 0 {
 			loc := h.Cursor.Loc
-			h.Buf.Remove(loc.Move(-tabSize, h.Buf), loc)
+			h.Buf.RemoveBackward(loc.Move(-tabSize, h.Buf), loc)
 		} else {
 			loc := h.Cursor.Loc
-			h.Buf.Remove(loc.Move(-1, h.Buf), loc)
+			h.Buf.RemoveBackward(loc.Move(-1, h.Buf), loc)
 		}
 	}
 	h.Cursor.LastVisualX = h.Cursor.GetVisualX()
@@ -740,49 +748,88 @@ func (h *BufPane) SaveAs() bool {
 
 // This function saves the buffer to `filename` and changes the buffer's path and name
 // to `filename` if the save is successful
+// The callback only runs once the file is saved, so that actions such as
+// Quit do not go ahead while a prompt is open or when saving failed
 func (h *BufPane) saveBufToFile(filename string, action string, callback func(noPrompt bool)) {
 	CheckPassword(h.Buf, filename, func() {
+		saved := func(noPrompt bool) {
+			if callback != nil {
+				callback(noPrompt)
+			}
+		}
 		err := h.Buf.SaveAs(filename)
 		if err != nil {
 			if strings.HasSuffix(err.Error(), "permission denied") {
-				saveWithSudo := func() {
+				saveWithSudo := func() bool {
 					err = h.Buf.SaveAsWithSudo(filename)
 					if err != nil {
 						InfoBar.Error(err)
-					} else {
-						h.Buf.Path = filename
-						h.Buf.SetName(filename)
-						InfoBar.Message("Saved " + filename)
+						return false
 					}
+					h.Buf.Path = filename
+					h.Buf.SetName(filename)
+					InfoBar.Message("Saved " + filename)
+					return true
 				}
 				if h.Buf.Settings["autosu"].(bool) {
-					saveWithSudo()
-				} else {
-					InfoBar.YNPrompt("Permission denied. Do you want to save this file using sudo? (y,n)", func(yes, canceled bool) {
-						if yes && !canceled {
-							saveWithSudo()
+					if saveWithSudo() {
+						saved(true)
+					}
+					return
+				}
+				InfoBar.YNPrompt("Permission denied. Do you want to save this file using sudo? (y,n)", func(yes, canceled bool) {
+					if yes && !canceled && saveWithSudo() {
+						h.completeAction(action)
+						saved(false)
+					}
+				})
+			} else if err == buffer.ErrNoParentDirs {
+				InfoBar.YNPrompt("Parent directories don't exist. Create them? (y,n)", func(yes, canceled bool) {
+					if yes && !canceled {
+						if err := h.Buf.SaveAsQuiet(filename, true); err != nil {
+							InfoBar.Error(err)
+						} else {
+							h.Buf.Path = filename
+							h.Buf.SetName(filename)
+							InfoBar.Message("Saved " + filename)
 							h.completeAction(action)
+							saved(false)
 						}
-						if callback != nil {
-							callback(false)
-						}
-					})
-				}
+					}
+				})
+			} else if err == buffer.ErrChangedOnDisk {
+				InfoBar.YNPrompt("The file has changed on disk. Overwrite it anyway? (y,n)", func(yes, canceled bool) {
+					if yes && !canceled && h.saveForce(filename) {
+						h.completeAction(action)
+						saved(false)
+					}
+				})
 			} else {
 				InfoBar.Error(err)
 			}
-		} else {
-			h.Buf.Path = filename
-			h.Buf.SetName(filename)
-			InfoBar.Message("Saved " + filename)
-		}
-		if callback != nil {
-			callback(true)
+			return
 		}
+		h.Buf.Path = filename
+		h.Buf.SetName(filename)
+		InfoBar.Message("Saved " + filename)
+		saved(true)
 	})
 	return
 }
 
+// saveForce saves the buffer to filename even if the file changed on disk
+// and returns whether it was saved
+func (h *BufPane) saveForce(filename string) bool {
+	if err := h.Buf.SaveAsForce(filename); err != nil {
+		InfoBar.Error(err)
+		return false
+	}
+	h.Buf.Path = filename
+	h.Buf.SetName(filename)
+	InfoBar.Message("Saved " + filename)
+	return true
+}
+
 // Find opens a prompt and searches forward for the input
 func (h *BufPane) Find() bool {
 	h.searchOrig = h.Cursor.Loc
@@ -954,17 +1001,31 @@ func (h *BufPane) Cut() bool {
 	}
 }
 
-// DuplicateLine duplicates the current line or selection
+// DuplicateLine duplicates the current line or the selected lines, and
+// moves the cursor and the selection to the copy
 func (h *BufPane) DuplicateLine() bool {
-	if h.Cursor.HasSelection() {
-		h.Buf.Insert(h.Cursor.CurSelection[1], string(h.Cursor.GetSelection()))
-	} else {
-		h.Cursor.End()
-		h.Buf.Insert(h.Cursor.Loc, "\n"+string(h.Buf.LineBytes(h.Cursor.Y)))
-		// h.Cursor.Right()
+	start, end := h.Cursor.Y, h.Cursor.Y
+	selected := h.Cursor.HasSelection()
+	if selected {
+		start, end = h.selectedLines()
+	}
+
+	loc, sel := h.Cursor.Loc, h.Cursor.CurSelection
+	n := h.Buf.DuplicateLines(start, end)
+	if n == 0 {
+		return false
+	}
+	h.Cursor.GotoLoc(buffer.Loc{loc.X, loc.Y + n})
+	if selected {
+		h.Cursor.SetSelectionStart(buffer.Loc{sel[0].X, sel[0].Y + n})
+		h.Cursor.SetSelectionEnd(buffer.Loc{sel[1].X, sel[1].Y + n})
 	}
 
-	InfoBar.Message("Duplicated line")
+	if n == 1 {
+		InfoBar.Message("Duplicated line")
+	} else {
+		InfoBar.Message("Duplicated ", n, " lines")
+	}
 	h.Relocate()
 	return true
 }
@@ -1090,7 +1151,7 @@ func (h *BufPane) paste(clip string) {
 // JumpToMatchingBrace moves the cursor to the matching brace if it is
 // currently on a brace
 func (h *BufPane) JumpToMatchingBrace() bool {
-	for _, bp := range buffer.BracePairs {
+	for _, bp := range h.Buf.BracePairs() {
 		r := h.Cursor.RuneUnder(h.Cursor.X)
 		rl := h.Cursor.RuneUnder(h.Cursor.X - 1)
 		if r == bp[0] || r == bp[1] || rl == bp[0] || rl == bp[1] {
@@ -1278,6 +1339,14 @@ func (h *BufPane) ToggleDiffGutter() bool {
 	return true
 }
 
+// HistorySearch searches the history of a prompt, see
+// InfoPane.SearchHistory
+// A buffer has no history, so it does nothing there and lets the next
+// action bound to the same key run
+func (h *BufPane) HistorySearch() bool {
+	return false
+}
+
 // ToggleRuler turns line numbers off and on
 func (h *BufPane) ToggleRuler() bool {
 	if !h.Buf.Settings["ruler"].(bool) {
@@ -1346,21 +1415,36 @@ func (h *BufPane) Escape() bool {
 	return true
 }
 
+// closePane closes the buffer of this pane and then the pane, its tab or
+// micro itself if it is the last one
+// The buffer is discarded without saving its cursor and undo history if
+// discard is true
+func (h *BufPane) closePane(discard bool) {
+	if discard {
+		h.Buf.Discard()
+	} else {
+		h.Buf.Close()
+	}
+	if len(MainTab().Panes) > 1 {
+		h.Unsplit()
+	} else if len(Tabs.List) > 1 {
+		Tabs.RemoveTab(h.splitID)
+	} else {
+		config.StopAutoSave()
+		screen.Screen.Fini()
+		InfoBar.Close()
+		runtime.Goexit()
+	}
+}
+
 // Quit this will close the current tab or view that is open
+// It only asks to save the buffer if it is modified and no other view
+// shows it, because the changes are not lost otherwise
 func (h *BufPane) Quit() bool {
 	quit := func() {
-		h.Buf.Close()
-		if len(MainTab().Panes) > 1 {
-			h.Unsplit()
-		} else if len(Tabs.List) > 1 {
-			Tabs.RemoveTab(h.splitID)
-		} else {
-			screen.Screen.Fini()
-			InfoBar.Close()
-			runtime.Goexit()
-		}
+		h.closePane(false)
 	}
-	if h.Buf.Modified() {
+	if h.Buf.Modified() && !h.Buf.SharedWithOpenBuffer() {
 		if config.GlobalSettings["autosave"].(float64) > 0 {
 			// autosave on means we automatically save when quitting
 			h.SaveCB("Quit", func(noPrompt bool) {
@@ -1383,6 +1467,13 @@ func (h *BufPane) Quit() bool {
 	return true
 }
 
+// ForceQuit closes the current tab or view without asking to save its
+// changes, which are lost
+func (h *BufPane) ForceQuit() bool {
+	h.closePane(true)
+	return true
+}
+
 // QuitAll quits the whole editor; all splits and tabs
 func (h *BufPane) QuitAll() bool {
 	anyModified := false
@@ -1397,6 +1488,7 @@ func (h *BufPane) QuitAll() bool {
 		for _, b := range buffer.OpenBuffers {
 			b.Close()
 		}
+		config.StopAutoSave()
 		screen.Screen.Fini()
 		InfoBar.Close()
 		runtime.Goexit()
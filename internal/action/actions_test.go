@@ -0,0 +1,135 @@
+package action
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/zyedidia/tcell"
+
+	"github.com/zyedidia/micro/internal/buffer"
+	"github.com/zyedidia/micro/internal/config"
+	ulua "github.com/zyedidia/micro/internal/lua"
+	"github.com/zyedidia/micro/internal/screen"
+)
+
+func init() {
+	ulua.L = lua.NewState()
+	config.InitGlobalSettings()
+}
+
+// initTestPanes opens b in a tab on a simulated screen, with a second pane
+// so that closing b does not exit
+func initTestPanes(t *testing.T, b *buffer.Buffer) *BufPane {
+	s := tcell.NewSimulationScreen("")
+	if err := s.Init(); err != nil {
+		t.Fatal(err)
+	}
+	s.SetSize(80, 24)
+	screen.Screen = s
+	InitGlobals()
+	InitTabs([]*buffer.Buffer{b})
+	bp := MainTab().CurPane()
+	bp.VSplitBuf(buffer.NewBufferFromString("", "", buffer.BTDefault))
+	return bp
+}
+
+func TestQuitWaitsForOverwritePrompt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "micro-quit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "test.txt")
+	ioutil.WriteFile(name, []byte("old\n"), 0644)
+	b, err := buffer.NewBufferFromFile(name, buffer.BTDefault, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Settings["backup"] = false
+	bp := initTestPanes(t, b)
+	defer screen.Screen.Fini()
+
+	b.Insert(buffer.Loc{X: 0, Y: 0}, "new ")
+	ioutil.WriteFile(name, []byte("changed\n"), 0644)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(name, later, later)
+
+	// answer "Save changes?" with yes, which opens the overwrite prompt
+	bp.Quit()
+	InfoBar.YNResp = true
+	InfoBar.DonePrompt(false)
+	if !InfoBar.HasYN {
+		t.Fatal("Quit did not ask whether to overwrite the changed file")
+	}
+	if len(MainTab().Panes) != 2 {
+		t.Fatal("Quit closed the pane while the overwrite prompt was open")
+	}
+
+	// refusing to overwrite keeps the pane and the edits
+	InfoBar.YNResp = false
+	InfoBar.DonePrompt(false)
+	if len(MainTab().Panes) != 2 {
+		t.Error("Quit closed the pane although the file was not saved")
+	}
+	if data, _ := ioutil.ReadFile(name); string(data) != "changed\n" {
+		t.Errorf("file was overwritten with %q", data)
+	}
+
+	// overwriting saves the file and then closes the pane
+	bp.Quit()
+	InfoBar.YNResp = true
+	InfoBar.DonePrompt(false)
+	InfoBar.YNResp = true
+	InfoBar.DonePrompt(false)
+	if data, _ := ioutil.ReadFile(name); string(data) != "new old\n" {
+		t.Errorf("file contains %q after overwriting", data)
+	}
+	if len(MainTab().Panes) != 1 {
+		t.Error("Quit did not close the pane after saving")
+	}
+}
+
+func TestQuitWaitsForParentDirsPrompt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "micro-quit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "a", "b", "test.txt")
+	b, err := buffer.NewBufferFromFile(name, buffer.BTDefault, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Settings["backup"] = false
+	b.Settings["mkparents"] = false
+	bp := initTestPanes(t, b)
+	defer screen.Screen.Fini()
+
+	b.Insert(buffer.Loc{X: 0, Y: 0}, "text")
+
+	// answer "Save changes?" with yes, which asks to create the directories
+	bp.Quit()
+	InfoBar.YNResp = true
+	InfoBar.DonePrompt(false)
+	if !InfoBar.HasYN {
+		t.Fatal("Quit did not ask whether to create the parent directories")
+	}
+	if len(MainTab().Panes) != 2 {
+		t.Fatal("Quit closed the pane while the parent directories prompt was open")
+	}
+
+	InfoBar.YNResp = true
+	InfoBar.DonePrompt(false)
+	if data, _ := ioutil.ReadFile(name); string(data) != "text\n" {
+		t.Errorf("file contains %q after creating its directories", data)
+	}
+	if len(MainTab().Panes) != 1 {
+		t.Error("Quit did not close the pane after saving")
+	}
+}
@@ -0,0 +1,155 @@
+package action
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	shellquote "github.com/kballard/go-shellquote"
+	"github.com/zyedidia/json5"
+	"github.com/zyedidia/micro/internal/config"
+	"github.com/zyedidia/micro/internal/screen"
+)
+
+// aliases maps the names of the user's command aliases to the commands
+// they stand for, as read from aliases.json
+var aliases map[string]string
+
+// InitAliases reads the command aliases from aliases.json
+func InitAliases() {
+	aliases = make(map[string]string)
+
+	filename := filepath.Join(config.ConfigDir, "aliases.json")
+	input, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			screen.TermMessage("Error reading aliases.json file: " + err.Error())
+		}
+		return
+	}
+	if err := json5.Unmarshal(input, &aliases); err != nil {
+		screen.TermMessage("Error reading aliases.json:", err.Error())
+	}
+}
+
+// writeAliases writes the command aliases to aliases.json
+func writeAliases() error {
+	txt, _ := json.MarshalIndent(aliases, "", "    ")
+	return ioutil.WriteFile(filepath.Join(config.ConfigDir, "aliases.json"), append(txt, '\n'), 0644)
+}
+
+// expandAlias replaces the alias that args starts with, if any, by the
+// command it stands for, followed by the other arguments, until args starts
+// with something that is not an alias
+// An alias that leads back to itself is an error, unless it has the name
+// of a command, which then runs, as in `alias ls "ls -l"`
+func expandAlias(args []string) ([]string, error) {
+	seen := make(map[string]bool)
+	for len(args) > 0 {
+		cmd, ok := aliases[args[0]]
+		if !ok {
+			break
+		}
+		if seen[args[0]] {
+			// like in the shell, an alias can run the command it hides
+			if _, ok := commands[args[0]]; ok {
+				break
+			}
+			return nil, errors.New("Alias " + args[0] + " leads back to itself")
+		}
+		seen[args[0]] = true
+
+		expanded, err := shellquote.Split(cmd)
+		if err != nil {
+			return nil, errors.New("Error parsing alias " + args[0] + ": " + err.Error())
+		}
+		args = append(expanded, args[1:]...)
+	}
+	return args, nil
+}
+
+// AliasCmd shows the command aliases, or defines one
+// For example: `alias w save` or `alias gs "run git status"`
+func (h *BufPane) AliasCmd(args []string) {
+	if len(args) == 0 {
+		if len(aliases) == 0 {
+			InfoBar.Message("No aliases")
+			return
+		}
+		names := make([]string, 0, len(aliases))
+		for name := range aliases {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for i, name := range names {
+			names[i] = name + " = " + aliases[name]
+		}
+		InfoBar.Message(strings.Join(names, ", "))
+		return
+	}
+
+	name := args[0]
+	if len(args) == 1 {
+		if cmd, ok := aliases[name]; ok {
+			InfoBar.Message(name + " = " + cmd)
+		} else {
+			InfoBar.Error("No alias ", name)
+		}
+		return
+	}
+
+	cmd := args[1]
+	if len(args) > 2 {
+		cmd = shellquote.Join(args[1:]...)
+	}
+	if strings.TrimSpace(cmd) == "" {
+		InfoBar.Error("No command for alias ", name)
+		return
+	}
+	old, existed := aliases[name]
+	aliases[name] = cmd
+	if _, err := expandAlias([]string{name}); err != nil {
+		if existed {
+			aliases[name] = old
+		} else {
+			delete(aliases, name)
+		}
+		InfoBar.Error(err)
+		return
+	}
+	if err := writeAliases(); err != nil {
+		InfoBar.Error("Error writing aliases.json: ", err)
+		return
+	}
+	InfoBar.Message(name + " = " + cmd)
+}
+
+// UnaliasCmd removes a command alias
+func (h *BufPane) UnaliasCmd(args []string) {
+	if len(args) < 1 {
+		InfoBar.Error("Not enough arguments")
+		return
+	}
+	if _, ok := aliases[args[0]]; !ok {
+		InfoBar.Error("No alias ", args[0])
+		return
+	}
+	delete(aliases, args[0])
+	if err := writeAliases(); err != nil {
+		InfoBar.Error("Error writing aliases.json: ", err)
+	}
+}
+
+// AliasComplete autocompletes the names of the command aliases
+var AliasComplete = MakeCompleter(func(input string, args []string) []string {
+	names := make([]string, 0, len(aliases))
+	for name := range aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+})
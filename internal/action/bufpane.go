@@ -12,6 +12,7 @@ import (
 	"github.com/zyedidia/micro/internal/display"
 	ulua "github.com/zyedidia/micro/internal/lua"
 	"github.com/zyedidia/micro/internal/screen"
+	"github.com/zyedidia/micro/internal/util"
 	"github.com/zyedidia/tcell"
 )
 
@@ -296,27 +297,60 @@ func (h *BufPane) SetID(i uint64) {
 }
 
 func (h *BufPane) Name() string {
-	n := h.Buf.GetName()
-	if h.Buf.Modified() {
-		n += " +"
-	}
-	return n
+	return h.Buf.StatusName()
 }
 
-// HandleEvent executes the tcell event properly
-func (h *BufPane) HandleEvent(event tcell.Event) {
-	if h.Buf.ExternallyModified() && !h.Buf.ReloadDisabled {
-		InfoBar.YNPrompt("The file on disk has changed. Reload file? (y,n,esc)", func(yes, canceled bool) {
+// checkExternalChange asks what to do if the file of the buffer was
+// changed on disk by another program
+func (h *BufPane) checkExternalChange() {
+	switch h.Buf.ExternalChange() {
+	case buffer.ChangeModified:
+		choices := []string{"Reload", "Keep buffer", "Overwrite file"}
+		InfoBar.ChoicePrompt("The file on disk has changed:", choices, func(choice int, canceled bool) {
+			if canceled {
+				h.Buf.DisableReload()
+			}
+			if choice == 0 && !canceled {
+				h.Buf.ReOpen()
+				return
+			}
+			h.Buf.UpdateModTime()
+			if choice == 2 && !canceled {
+				h.Save()
+			}
+		})
+	case buffer.ChangeDeleted:
+		InfoBar.YNPrompt("The file on disk was deleted. Keep the buffer so that saving recreates it? (y,n,esc)", func(yes, canceled bool) {
+			if canceled {
+				h.Buf.DisableReload()
+			}
+			h.Buf.UpdateModTime()
+			if yes && !canceled {
+				h.Buf.ForceModified()
+			}
+		})
+	case buffer.ChangeTruncated:
+		InfoBar.YNPrompt("The file on disk was emptied, possibly by another program. Reload the empty file? (y,n,esc)", func(yes, canceled bool) {
 			if canceled {
 				h.Buf.DisableReload()
 			}
 			if !yes || canceled {
+				// saving writes the contents back
 				h.Buf.UpdateModTime()
+				h.Buf.ForceModified()
 			} else {
 				h.Buf.ReOpen()
 			}
 		})
+	}
+}
 
+// HandleEvent executes the tcell event properly
+func (h *BufPane) HandleEvent(event tcell.Event) {
+	// Remote files are only checked when they are saved, because asking
+	// the remote machine after every event would make typing slow
+	if !h.Buf.ReloadDisabled && !h.Buf.IsRemote() {
+		h.checkExternalChange()
 	}
 
 	switch e := event.(type) {
@@ -388,6 +422,14 @@ func (h *BufPane) HandleEvent(event tcell.Event) {
 	}
 	h.Buf.MergeCursors()
 
+	if h.Buf.RefusedEdit() {
+		if h.Buf.Type.Kind == buffer.BTDefault.Kind {
+			InfoBar.Message("Buffer is readonly, run 'setlocal readonly off' to edit it")
+		} else {
+			InfoBar.Message("Buffer is readonly")
+		}
+	}
+
 	if h.IsActive() {
 		// Display any gutter messages for this line
 		c := h.Buf.GetActiveCursor()
@@ -482,10 +524,16 @@ func (h *BufPane) DoRuneInsert(r rune) {
 		if h.isOverwriteMode {
 			next := c.Loc
 			next.X++
-			h.Buf.Replace(c.Loc, next, string(r))
+			h.Buf.ReplaceRange(c.Loc, next, string(r))
 		} else {
 			h.Buf.Insert(c.Loc, string(r))
 		}
+		// a finished keyword such as else may need to line up with its block
+		if !util.IsWordChar(r) {
+			if indent := h.Buf.SmartDedent(c.Y); indent >= 0 {
+				h.Buf.SetLineIndent(c.Y, indent)
+			}
+		}
 		if recording_macro {
 			curmacro = append(curmacro, r)
 		}
@@ -614,12 +662,14 @@ var BufKeyActions = map[string]BufKeyAction{
 	"ToggleKeyMenu":          (*BufPane).ToggleKeyMenu,
 	"ToggleDiffGutter":       (*BufPane).ToggleDiffGutter,
 	"ToggleRuler":            (*BufPane).ToggleRuler,
+	"HistorySearch":          (*BufPane).HistorySearch,
 	"ClearStatus":            (*BufPane).ClearStatus,
 	"ShellMode":              (*BufPane).ShellMode,
 	"CommandMode":            (*BufPane).CommandMode,
 	"ToggleOverwriteMode":    (*BufPane).ToggleOverwriteMode,
 	"Escape":                 (*BufPane).Escape,
 	"Quit":                   (*BufPane).Quit,
+	"ForceQuit":              (*BufPane).ForceQuit,
 	"QuitAll":                (*BufPane).QuitAll,
 	"AddTab":                 (*BufPane).AddTab,
 	"PreviousTab":            (*BufPane).PreviousTab,
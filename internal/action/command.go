@@ -1,23 +1,27 @@
 package action
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"regexp"
+	"runtime"
+	"runtime/pprof"
 	"strconv"
 	"strings"
+	"time"
 	"unicode/utf8"
 
 	shellquote "github.com/kballard/go-shellquote"
 	"github.com/zyedidia/micro/internal/buffer"
 	"github.com/zyedidia/micro/internal/config"
+	ulua "github.com/zyedidia/micro/internal/lua"
 	"github.com/zyedidia/micro/internal/screen"
 	"github.com/zyedidia/micro/internal/shell"
 	"github.com/zyedidia/micro/internal/util"
+	luar "layeh.com/gopher-luar"
 )
 
 // A Command contains information about how to execute a command
@@ -29,50 +33,125 @@ type Command struct {
 
 var commands map[string]Command
 
+// builtinCommands holds the commands as they were before plugins changed
+// them, so that RemoveCommand can bring back a builtin command that a
+// plugin overrode, and overridden holds the names of those commands
+var builtinCommands map[string]Command
+var overridden map[string]bool
+
 func InitCommands() {
 	commands = map[string]Command{
-		"set":        {(*BufPane).SetCmd, OptionValueComplete},
-		"reset":      {(*BufPane).ResetCmd, OptionValueComplete},
-		"setlocal":   {(*BufPane).SetLocalCmd, OptionValueComplete},
-		"show":       {(*BufPane).ShowCmd, OptionComplete},
-		"showkey":    {(*BufPane).ShowKeyCmd, nil},
-		"run":        {(*BufPane).RunCmd, nil},
-		"bind":       {(*BufPane).BindCmd, nil},
-		"unbind":     {(*BufPane).UnbindCmd, nil},
-		"quit":       {(*BufPane).QuitCmd, nil},
-		"goto":       {(*BufPane).GotoCmd, nil},
-		"save":       {(*BufPane).SaveCmd, nil},
-		"replace":    {(*BufPane).ReplaceCmd, nil},
-		"replaceall": {(*BufPane).ReplaceAllCmd, nil},
-		"vsplit":     {(*BufPane).VSplitCmd, buffer.FileComplete},
-		"hsplit":     {(*BufPane).HSplitCmd, buffer.FileComplete},
-		"tab":        {(*BufPane).NewTabCmd, buffer.FileComplete},
-		"help":       {(*BufPane).HelpCmd, HelpComplete},
-		"eval":       {(*BufPane).EvalCmd, nil},
-		"log":        {(*BufPane).ToggleLogCmd, nil},
-		"plugin":     {(*BufPane).PluginCmd, PluginComplete},
-		"reload":     {(*BufPane).ReloadCmd, nil},
-		"reopen":     {(*BufPane).ReopenCmd, nil},
-		"cd":         {(*BufPane).CdCmd, buffer.FileComplete},
-		"pwd":        {(*BufPane).PwdCmd, nil},
-		"open":       {(*BufPane).OpenCmd, buffer.FileComplete},
-		"tabswitch":  {(*BufPane).TabSwitchCmd, nil},
-		"term":       {(*BufPane).TermCmd, nil},
-		"memusage":   {(*BufPane).MemUsageCmd, nil},
-		"retab":      {(*BufPane).RetabCmd, nil},
-		"raw":        {(*BufPane).RawCmd, nil},
-		"textfilter": {(*BufPane).TextFilterCmd, nil},
-	}
+		"set":           {(*BufPane).SetCmd, OptionValueComplete},
+		"reset":         {(*BufPane).ResetCmd, OptionValueComplete},
+		"setlocal":      {(*BufPane).SetLocalCmd, OptionValueComplete},
+		"show":          {(*BufPane).ShowCmd, OptionComplete},
+		"showkey":       {(*BufPane).ShowKeyCmd, nil},
+		"run":           {(*BufPane).RunCmd, nil},
+		"killjobs":      {(*BufPane).KillJobsCmd, nil},
+		"bind":          {(*BufPane).BindCmd, nil},
+		"unbind":        {(*BufPane).UnbindCmd, nil},
+		"quit":          {(*BufPane).QuitCmd, nil},
+		"quit!":         {(*BufPane).ForceQuitCmd, nil},
+		"quitall":       {(*BufPane).QuitAllCmd, nil},
+		"qa":            {(*BufPane).QuitAllCmd, nil},
+		"goto":          {(*BufPane).GotoCmd, nil},
+		"save":          {(*BufPane).SaveCmd, nil},
+		"saveall":       {(*BufPane).SaveAllCmd, nil},
+		"wq":            {(*BufPane).WriteQuitCmd, nil},
+		"replace":       {(*BufPane).ReplaceCmd, nil},
+		"replaceall":    {(*BufPane).ReplaceAllCmd, nil},
+		"vsplit":        {(*BufPane).VSplitCmd, buffer.FileComplete},
+		"hsplit":        {(*BufPane).HSplitCmd, buffer.FileComplete},
+		"tab":           {(*BufPane).NewTabCmd, buffer.FileComplete},
+		"help":          {(*BufPane).HelpCmd, HelpComplete},
+		"eval":          {(*BufPane).EvalCmd, nil},
+		"log":           {(*BufPane).ToggleLogCmd, nil},
+		"plugin":        {(*BufPane).PluginCmd, PluginComplete},
+		"reload":        {(*BufPane).ReloadCmd, nil},
+		"reopen":        {(*BufPane).ReopenCmd, nil},
+		"reloadbuffer":  {(*BufPane).ReloadBufferCmd, nil},
+		"clearstate":    {(*BufPane).ClearStateCmd, nil},
+		"cd":            {(*BufPane).CdCmd, buffer.FileComplete},
+		"togglepath":    {(*BufPane).TogglePathCmd, nil},
+		"pwd":           {(*BufPane).PwdCmd, nil},
+		"open":          {(*BufPane).OpenCmd, buffer.FileComplete},
+		"tabswitch":     {(*BufPane).TabSwitchCmd, nil},
+		"term":          {(*BufPane).TermCmd, nil},
+		"memusage":      {(*BufPane).MemUsageCmd, nil},
+		"profile":       {(*BufPane).ProfileCmd, nil},
+		"retab":         {(*BufPane).RetabCmd, nil},
+		"raw":           {(*BufPane).RawCmd, nil},
+		"textfilter":    {(*BufPane).TextFilterCmd, nil},
+		"cyclecase":     {(*BufPane).CycleCaseCmd, nil},
+		"surround":      {(*BufPane).SurroundCmd, nil},
+		"unsurround":    {(*BufPane).UnsurroundCmd, nil},
+		"gf":            {(*BufPane).GotoFileCmd, nil},
+		"sort":          {(*BufPane).SortCmd, nil},
+		"join":          {(*BufPane).JoinCmd, nil},
+		"reflow":        {(*BufPane).ReflowCmd, nil},
+		"pathconvert":   {(*BufPane).PathConvertCmd, nil},
+		"squeezeblanks": {(*BufPane).SqueezeBlanksCmd, nil},
+		"squeezespaces": {(*BufPane).SqueezeSpacesCmd, nil},
+		"breakhere":     {(*BufPane).BreakHereCmd, nil},
+		"toc":           {(*BufPane).TocCmd, nil},
+		"blockinsert":   {(*BufPane).BlockInsertCmd, nil},
+		"blockdelete":   {(*BufPane).BlockDeleteCmd, nil},
+		"trimtrailing":  {(*BufPane).TrimTrailingCmd, nil},
+		"trimline":      {(*BufPane).TrimLineCmd, nil},
+		"repeat":        {(*BufPane).RepeatCmd, nil},
+		"share":         {(*BufPane).ShareCmd, nil},
+		"filter":        {(*BufPane).FilterCmd, nil},
+		"info":          {(*BufPane).InfoCmd, nil},
+		"count":         {(*BufPane).CountCmd, nil},
+		"duplicate":     {(*BufPane).DuplicateCmd, nil},
+		"messages":      {(*BufPane).MessagesCmd, nil},
+		"fileformat":    {(*BufPane).FileFormatCmd, FileFormatComplete},
+		"readfile":      {(*BufPane).ReadFileCmd, buffer.FileComplete},
+		"alias":         {(*BufPane).AliasCmd, AliasComplete},
+		"unalias":       {(*BufPane).UnaliasCmd, AliasComplete},
+	}
+
+	builtinCommands = make(map[string]Command, len(commands))
+	for name, cmd := range commands {
+		builtinCommands[name] = cmd
+	}
+	overridden = make(map[string]bool)
+
+	InitAliases()
 }
 
 // MakeCommand is a function to easily create new commands
 // This can be called by plugins in Lua so that plugins can define their own commands
+// Overriding a builtin command is written to the log so that conflicts
+// between plugins and micro are visible
 func MakeCommand(name string, action func(bp *BufPane, args []string), completer buffer.Completer) {
 	if action != nil {
+		if _, ok := builtinCommands[name]; ok {
+			buffer.WriteLog("Command '" + name + "' overrides a builtin command\n")
+			overridden[name] = true
+		}
 		commands[name] = Command{action, completer}
 	}
 }
 
+// RemoveCommand undoes MakeCommand: a builtin command that was overridden
+// is restored, and any other command is removed, including builtin
+// commands that were not overridden
+func RemoveCommand(name string) {
+	if overridden[name] {
+		commands[name] = builtinCommands[name]
+		delete(overridden, name)
+	} else {
+		delete(commands, name)
+	}
+}
+
+// CommandExists returns whether a command with the given name exists
+func CommandExists(name string) bool {
+	_, ok := commands[name]
+	return ok
+}
+
 // CommandEditAction returns a bindable function that opens a prompt with
 // the given string and executes the command when the user presses
 // enter
@@ -114,8 +193,378 @@ func (h *BufPane) PluginCmd(args []string) {
 
 // RetabCmd changes all spaces to tabs or all tabs to spaces
 // depending on the user's settings
+// If there is a selection only the selected lines are changed
 func (h *BufPane) RetabCmd(args []string) {
-	h.Buf.Retab()
+	start, end := 0, h.Buf.LinesNum()-1
+	if h.Cursor.HasSelection() {
+		start, end = h.selectedLines()
+	}
+	n := h.Buf.RetabLines(start, end)
+	InfoBar.Message("Retabbed ", n, " lines")
+}
+
+// CycleCaseCmd converts the identifier under the cursor to the next
+// case style
+func (h *BufPane) CycleCaseCmd(args []string) {
+	style := h.Buf.CycleCase(h.Cursor)
+	if style == "" {
+		InfoBar.Error("No identifier under the cursor")
+		return
+	}
+	h.Relocate()
+	InfoBar.Message("Converted to ", style, " case")
+}
+
+// SurroundCmd wraps the selection with the given pair of delimiters
+func (h *BufPane) SurroundCmd(args []string) {
+	if len(args) < 1 {
+		InfoBar.Error("Not enough arguments")
+		return
+	}
+	if !h.Cursor.HasSelection() {
+		InfoBar.Error("Nothing is selected")
+		return
+	}
+
+	open, close, err := buffer.SurroundPair(strings.Join(args, " "))
+	if err != nil {
+		InfoBar.Error(err)
+		return
+	}
+	h.Buf.Surround(h.Cursor, open, close)
+	h.Relocate()
+}
+
+// UnsurroundCmd removes the pair of delimiters around the selection or
+// the cursor
+func (h *BufPane) UnsurroundCmd(args []string) {
+	if !h.Buf.Unsurround(h.Cursor) {
+		InfoBar.Error("No surrounding delimiters found")
+		return
+	}
+	h.Relocate()
+}
+
+// SortCmd sorts the selected lines, or the whole buffer if there is no
+// selection
+// Flags: -r reverses the order, -n compares the numbers the lines start
+// with, -u removes duplicate lines
+func (h *BufPane) SortCmd(args []string) {
+	var reverse, numeric, unique bool
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") || len(arg) < 2 {
+			InfoBar.Error("Invalid flag: ", arg)
+			return
+		}
+		for _, f := range arg[1:] {
+			switch f {
+			case 'r':
+				reverse = true
+			case 'n':
+				numeric = true
+			case 'u':
+				unique = true
+			default:
+				InfoBar.Error("Invalid flag: -", string(f))
+				return
+			}
+		}
+	}
+
+	start, end := 0, h.Buf.LinesNum()-1
+	if h.Cursor.HasSelection() {
+		start, end = h.selectedLines()
+	}
+
+	n := h.Buf.SortLines(start, end, reverse, numeric, unique)
+	h.Cursor.ResetSelection()
+	h.Cursor.GotoLoc(buffer.Loc{0, start})
+	h.Relocate()
+	InfoBar.Message("Sorted ", n, " lines")
+}
+
+// JoinCmd joins the selected lines, or the current line and the next one,
+// putting the given separator between them, or a space depending on the
+// joinspace option
+func (h *BufPane) JoinCmd(args []string) {
+	start, end := h.Cursor.Y, h.Cursor.Y+1
+	if h.Cursor.HasSelection() {
+		start, end = h.selectedLines()
+	}
+	if end >= h.Buf.LinesNum() || start == end {
+		InfoBar.Error("Nothing to join")
+		return
+	}
+
+	var loc buffer.Loc
+	if len(args) > 0 {
+		loc = h.Buf.JoinWithSeparator(start, end, strings.Join(args, " "))
+	} else {
+		loc = h.Buf.JoinLines(start, end)
+	}
+	h.Cursor.ResetSelection()
+	h.Cursor.GotoLoc(loc)
+	h.Relocate()
+}
+
+// DuplicateCmd duplicates the current line or the selected lines
+func (h *BufPane) DuplicateCmd(args []string) {
+	h.DuplicateLine()
+}
+
+// ReflowCmd rewraps the selected lines, or the paragraph around the
+// cursor, to the wrapwidth option
+func (h *BufPane) ReflowCmd(args []string) {
+	var start, end int
+	if h.Cursor.HasSelection() {
+		start, end = h.selectedLines()
+	} else {
+		var ok bool
+		if start, end, ok = h.Buf.ParagraphAround(h.Cursor.Y); !ok {
+			InfoBar.Error("Nothing to reflow")
+			return
+		}
+	}
+
+	last := h.Buf.Reflow(start, end)
+	h.Cursor.ResetSelection()
+	h.Cursor.GotoLoc(buffer.Loc{utf8.RuneCount(h.Buf.LineBytes(last)), last})
+	h.Relocate()
+}
+
+// PathConvertCmd rewrites the file paths in the selected lines, or in the
+// whole buffer if there is no selection, to be absolute or relative
+// For example: `pathconvert abs` or `pathconvert rel ~/project`
+func (h *BufPane) PathConvertCmd(args []string) {
+	if len(args) < 1 {
+		InfoBar.Error("Not enough arguments")
+		return
+	}
+
+	var toAbsolute bool
+	switch args[0] {
+	case "abs":
+		toAbsolute = true
+	case "rel":
+		toAbsolute = false
+	default:
+		InfoBar.Error("Invalid argument: ", args[0])
+		return
+	}
+
+	base := ""
+	if len(args) > 1 {
+		var err error
+		base, err = util.ReplaceHome(args[1])
+		if err != nil {
+			InfoBar.Error(err)
+			return
+		}
+	}
+
+	start, end := 0, h.Buf.LinesNum()-1
+	if h.Cursor.HasSelection() {
+		start, end = h.selectedLines()
+	}
+	n := h.Buf.ConvertPaths(start, end, toAbsolute, base)
+	h.Relocate()
+	InfoBar.Message("Converted ", n, " paths")
+}
+
+// SqueezeBlanksCmd replaces the runs of blank lines in the selection, or
+// around the cursor if it is on a blank line, or else in the whole buffer,
+// with a single empty line
+func (h *BufPane) SqueezeBlanksCmd(args []string) {
+	var n int
+	if h.Cursor.HasSelection() {
+		n = h.Buf.SqueezeBlankLines(h.selectedLines())
+	} else if n = h.Buf.SqueezeBlankLinesAround(h.Cursor.Y); n == 0 {
+		n = h.Buf.SqueezeBlankLines(0, h.Buf.LinesNum()-1)
+	}
+	if n == 0 {
+		InfoBar.Message("No blank lines to remove")
+		return
+	}
+	h.Relocate()
+	InfoBar.Message("Removed ", n, " blank lines")
+}
+
+// SqueezeSpacesCmd replaces the runs of spaces and tabs between words in
+// the selected lines, or in the whole buffer, with a single space
+func (h *BufPane) SqueezeSpacesCmd(args []string) {
+	start, end := 0, h.Buf.LinesNum()-1
+	if h.Cursor.HasSelection() {
+		start, end = h.selectedLines()
+	}
+	n := h.Buf.SqueezeSpaces(start, end)
+	if n == 0 {
+		InfoBar.Message("No spaces to squeeze")
+		return
+	}
+	h.Relocate()
+	InfoBar.Message("Squeezed spaces on ", n, " lines")
+}
+
+// BreakHereCmd splits the current line at the cursor, keeping its
+// indentation on the new line
+func (h *BufPane) BreakHereCmd(args []string) {
+	h.Cursor.ResetSelection()
+	loc := h.Buf.BreakLine(h.Cursor.Loc)
+	h.Cursor.GotoLoc(loc)
+	h.Relocate()
+}
+
+// TocCmd lists the headings of the buffer in a split, or jumps to the
+// heading with the given number or to the first one containing the
+// given text
+func (h *BufPane) TocCmd(args []string) {
+	headings := h.Buf.Headings()
+	if len(headings) == 0 {
+		InfoBar.Message("No headings found")
+		return
+	}
+
+	if len(args) == 0 {
+		var toc strings.Builder
+		for i, hd := range headings {
+			fmt.Fprintf(&toc, "%3d  %s%s (line %d)\n", i+1, strings.Repeat("  ", hd.Level-1), hd.Text, hd.Line+1)
+		}
+		tocBuf := buffer.NewBufferFromString(toc.String(), "", buffer.BTScratch)
+		tocBuf.SetName("Contents of " + h.Buf.GetName())
+		h.HSplitBuf(tocBuf)
+		return
+	}
+
+	line := -1
+	if n, err := strconv.Atoi(args[0]); err == nil && len(args) == 1 {
+		if n < 1 || n > len(headings) {
+			InfoBar.Error("There are only ", len(headings), " headings")
+			return
+		}
+		line = headings[n-1].Line
+	} else {
+		text := strings.ToLower(strings.Join(args, " "))
+		for _, hd := range headings {
+			if strings.Contains(strings.ToLower(hd.Text), text) {
+				line = hd.Line
+				break
+			}
+		}
+		if line < 0 {
+			InfoBar.Error("No heading contains ", strings.Join(args, " "))
+			return
+		}
+	}
+
+	h.RemoveAllMultiCursors()
+	h.Cursor.ResetSelection()
+	h.Cursor.GotoLoc(buffer.Loc{0, line})
+	h.Relocate()
+}
+
+// BlockInsertCmd inserts the text at the same column on every line of the
+// block between the corners of the selection, and leaves a cursor after
+// the text on each line
+func (h *BufPane) BlockInsertCmd(args []string) {
+	if len(args) < 1 {
+		InfoBar.Error("Not enough arguments: provide the text to insert")
+		return
+	}
+	if !h.Cursor.HasSelection() {
+		InfoBar.Error("Select the block first")
+		return
+	}
+	start, end := h.Cursor.CurSelection[0], h.Cursor.CurSelection[1]
+	if end.LessThan(start) {
+		start, end = end, start
+	}
+	locs := h.Buf.BlockInsert(start, end, strings.Join(args, " "))
+	h.Buf.SetBlockCursors(locs)
+	h.Relocate()
+}
+
+// BlockDeleteCmd deletes the rectangle between the corners of the
+// selection and leaves a cursor at its left edge on each line
+func (h *BufPane) BlockDeleteCmd(args []string) {
+	if !h.Cursor.HasSelection() {
+		InfoBar.Error("Select the block first")
+		return
+	}
+	locs := h.Buf.BlockDelete(h.Cursor.CurSelection[0], h.Cursor.CurSelection[1])
+	h.Buf.SetBlockCursors(locs)
+	h.Relocate()
+}
+
+// TrimTrailingCmd removes trailing whitespace from the selected lines, or
+// from the whole buffer if there is no selection
+func (h *BufPane) TrimTrailingCmd(args []string) {
+	start, end := 0, h.Buf.LinesNum()-1
+	if h.Cursor.HasSelection() {
+		start, end = h.selectedLines()
+	}
+	n := h.Buf.TrimTrailingWhitespace(start, end)
+	h.Relocate()
+	InfoBar.Message("Trimmed ", n, " lines")
+}
+
+// TrimLineCmd removes trailing whitespace from the line of each cursor
+func (h *BufPane) TrimLineCmd(args []string) {
+	lines := make(map[int]bool)
+	for _, c := range h.Buf.GetCursors() {
+		lines[c.Y] = true
+	}
+	for y := range lines {
+		h.Buf.TrimTrailingWhitespace(y, y)
+	}
+	h.Relocate()
+}
+
+// RepeatCmd makes the last edit again at the cursor
+func (h *BufPane) RepeatCmd(args []string) {
+	if !h.Buf.RepeatLastEdit(h.Cursor) {
+		InfoBar.Error("No edit to repeat")
+		return
+	}
+	h.Relocate()
+}
+
+// ShareCmd writes the selection, or the whole buffer if there is no
+// selection, to a new file in the snippets directory
+func (h *BufPane) ShareCmd(args []string) {
+	var text []byte
+	if h.Cursor.HasSelection() {
+		text = h.Cursor.GetSelection()
+	} else {
+		text = h.Buf.Bytes()
+	}
+
+	dir := config.GetGlobalOption("snippetdir").(string)
+	if dir == "" {
+		dir = filepath.Join(config.ConfigDir, "snippets")
+	} else {
+		dir, _ = util.ReplaceHome(dir)
+	}
+
+	path, err := h.Buf.ExportSnippet(dir, text, time.Now())
+	if err != nil {
+		InfoBar.Error(err)
+		return
+	}
+	InfoBar.Message("Snippet saved to ", path)
+}
+
+// selectedLines returns the first and last line of the selection
+// A selection that ends at the start of a line does not include that line
+func (h *BufPane) selectedLines() (int, int) {
+	a, b := h.Cursor.CurSelection[0], h.Cursor.CurSelection[1]
+	if b.LessThan(a) {
+		a, b = b, a
+	}
+	start, end := a.Y, b.Y
+	if b.X == 0 && end > start {
+		end--
+	}
+	return start, end
 }
 
 // RawCmd opens a new raw view which displays the escape sequences micro
@@ -136,23 +585,60 @@ func (h *BufPane) TextFilterCmd(args []string) {
 		InfoBar.Error("usage: textfilter arguments")
 		return
 	}
-	sel := h.Cursor.GetSelection()
-	if len(sel) == 0 {
+	if !h.Cursor.HasSelection() {
 		h.Cursor.SelectWord()
-		sel = h.Cursor.GetSelection()
-	}
-	var bout, berr bytes.Buffer
-	cmd := exec.Command(args[0], args[1:]...)
-	cmd.Stdin = strings.NewReader(string(sel))
-	cmd.Stderr = &berr
-	cmd.Stdout = &bout
-	err := cmd.Run()
+	}
+	h.filterSelection(args)
+}
+
+// FilterCmd runs the selection, or the whole buffer if there is no
+// selection, through an external command and replaces it with the
+// command's output
+func (h *BufPane) FilterCmd(args []string) {
+	if len(args) == 0 {
+		InfoBar.Error("usage: filter command [arguments]")
+		return
+	}
+	if !h.Cursor.HasSelection() {
+		h.Cursor.SetSelectionStart(h.Buf.Start())
+		h.Cursor.SetSelectionEnd(h.Buf.End())
+	}
+	h.filterSelection(args)
+}
+
+// filterSelection feeds the selection to the given command and replaces
+// it with the output as a single undoable edit
+func (h *BufPane) filterSelection(args []string) {
+	start, end := h.Cursor.CurSelection[0], h.Cursor.CurSelection[1]
+	if end.LessThan(start) {
+		start, end = end, start
+	}
+
+	var out string
+	var err error
+	if start == h.Buf.Start() && end == h.Buf.End() {
+		// the whole buffer is streamed to the command
+		out, err = shell.ExecCommandFrom(func(w io.Writer) error {
+			_, err := h.Buf.WriteLinesTo(w)
+			return err
+		}, args[0], args[1:]...)
+	} else {
+		out, err = shell.ExecCommandWithInput(string(h.Cursor.GetSelection()), args[0], args[1:]...)
+	}
 	if err != nil {
-		InfoBar.Error(err.Error() + " " + berr.String())
+		InfoBar.Error(err)
 		return
 	}
-	h.Cursor.DeleteSelection()
-	h.Buf.Insert(h.Cursor.Loc, bout.String())
+	// most commands end their output with a newline, don't add one that
+	// wasn't selected
+	if end.X != 0 || end.Y == start.Y {
+		out = strings.TrimSuffix(out, "\n")
+	}
+
+	h.Buf.ReplaceRange(start, end, out)
+	h.Cursor.ResetSelection()
+	h.Cursor.GotoLoc(start)
+	h.Relocate()
 }
 
 // TabSwitchCmd switches to a given tab either by name or by number
@@ -161,16 +647,18 @@ func (h *BufPane) TabSwitchCmd(args []string) {
 		num, err := strconv.Atoi(args[0])
 		if err != nil {
 			// Check for tab with this name
-
-			found := false
-			for i, t := range Tabs.List {
-				if t.Panes[t.active].Name() == args[0] {
-					Tabs.SetActive(i)
-					found = true
+			matches := findTabs(args[0])
+			switch len(matches) {
+			case 0:
+				InfoBar.Error("Could not find tab: ", args[0])
+			case 1:
+				Tabs.SetActive(matches[0])
+			default:
+				var names []string
+				for _, i := range matches {
+					names = append(names, tabPath(Tabs.List[i]))
 				}
-			}
-			if !found {
-				InfoBar.Error("Could not find tab: ", err)
+				InfoBar.Message("Several tabs match ", args[0], ": ", strings.Join(names, ", "))
 			}
 		} else {
 			num--
@@ -183,6 +671,46 @@ func (h *BufPane) TabSwitchCmd(args []string) {
 	}
 }
 
+// tabPath returns the path of the file shown in the active pane of a tab,
+// or the name of the pane if it does not show a file
+func tabPath(t *Tab) string {
+	p := t.Panes[t.active]
+	if bp, ok := p.(*BufPane); ok && bp.Buf.Path != "" {
+		return bp.Buf.Path
+	}
+	return p.Name()
+}
+
+// findTabs returns the indexes of the tabs whose active pane shows the
+// given file, matched by its absolute or relative path or by its name
+// A tab showing exactly the given path is preferred over tabs that only
+// have the same name
+func findTabs(name string) []int {
+	abs, _ := filepath.Abs(name)
+
+	var exact, named []int
+	for i, t := range Tabs.List {
+		p := t.Panes[t.active]
+		if bp, ok := p.(*BufPane); ok && bp.Buf.Path != "" {
+			if bp.Buf.AbsPath == abs {
+				exact = append(exact, i)
+				continue
+			}
+			if bp.Buf.Path == name || bp.Buf.GetName() == name {
+				named = append(named, i)
+				continue
+			}
+		}
+		if p.Name() == name {
+			named = append(named, i)
+		}
+	}
+	if len(exact) > 0 {
+		return exact
+	}
+	return named
+}
+
 // CdCmd changes the current working directory
 func (h *BufPane) CdCmd(args []string) {
 	if len(args) > 0 {
@@ -198,27 +726,159 @@ func (h *BufPane) CdCmd(args []string) {
 		}
 		wd, _ := os.Getwd()
 		for _, b := range buffer.OpenBuffers {
-			if len(b.Path) > 0 {
+			if len(b.Path) > 0 && !b.IsRemote() {
 				b.Path, _ = util.MakeRelative(b.AbsPath, wd)
 				if p, _ := filepath.Abs(b.Path); !strings.Contains(p, wd) {
 					b.Path = b.AbsPath
 				}
+				// filetype detection may depend on the path
+				b.UpdateRules()
 			}
 		}
+
+		if err := config.RunPluginFn("onChangeDir", luar.New(ulua.L, wd)); err != nil {
+			InfoBar.Error(err)
+		}
 	}
 }
 
+// TogglePathCmd switches the name shown for the current buffer between
+// its path relative to the current directory and its absolute path
+func (h *BufPane) TogglePathCmd(args []string) {
+	abspath := !h.Buf.Settings["abspath"].(bool)
+	if err := h.Buf.SetOptionNative("abspath", abspath); err != nil {
+		InfoBar.Error(err)
+		return
+	}
+	InfoBar.Message(h.Buf.GetName())
+}
+
+// ReadFileCmd inserts the contents of a file at the cursor
+func (h *BufPane) ReadFileCmd(args []string) {
+	if len(args) < 1 {
+		InfoBar.Error("Not enough arguments")
+		return
+	}
+	if h.Buf.Type.Readonly {
+		InfoBar.Error("Cannot insert into a readonly buffer")
+		return
+	}
+
+	h.Cursor.ResetSelection()
+	loc, err := h.Buf.InsertFile(h.Cursor.Loc, args[0])
+	if err != nil {
+		InfoBar.Error(err)
+		return
+	}
+	h.Cursor.GotoLoc(loc)
+	h.Relocate()
+}
+
 // MemUsageCmd prints micro's memory usage
 // Alloc shows how many bytes are currently in use
 // Sys shows how many bytes have been requested from the operating system
+// HeapInuse and HeapObjects show the size and number of live heap objects
 // NumGC shows how many times the GC has been run
 // Note that Go commonly reserves more memory from the OS than is currently in-use/required
 // Additionally, even if Go returns memory to the OS, the OS does not always claim it because
 // there may be plenty of memory to spare
+// With the gc argument a garbage collection is run first, so that only
+// memory that is still in use is counted
 func (h *BufPane) MemUsageCmd(args []string) {
+	if len(args) > 0 {
+		if args[0] != "gc" {
+			InfoBar.Error("Invalid argument: ", args[0])
+			return
+		}
+		runtime.GC()
+	}
 	InfoBar.Message(util.GetMemStats())
 }
 
+// cpuProfile is the file that a CPU profile started by ProfileCmd is being
+// written to, or nil if no profile is running
+var cpuProfile *os.File
+
+// ProfileCmd writes profiles of micro for the pprof tool
+// `profile cpu start 'file'?` starts a CPU profile, `profile cpu stop`
+// stops it, and `profile heap 'file'?` writes a heap profile
+// Files are written to the working directory unless a path is given
+func (h *BufPane) ProfileCmd(args []string) {
+	if len(args) < 1 {
+		InfoBar.Error("Not enough arguments")
+		return
+	}
+
+	switch args[0] {
+	case "cpu":
+		if len(args) < 2 {
+			InfoBar.Error("Not enough arguments")
+			return
+		}
+		switch args[1] {
+		case "start":
+			if cpuProfile != nil {
+				InfoBar.Error("A CPU profile is already running")
+				return
+			}
+			path := "cpu.prof"
+			if len(args) > 2 {
+				path = args[2]
+			}
+			f, err := os.Create(path)
+			if err != nil {
+				InfoBar.Error(err)
+				return
+			}
+			if err := pprof.StartCPUProfile(f); err != nil {
+				f.Close()
+				InfoBar.Error(err)
+				return
+			}
+			cpuProfile = f
+			InfoBar.Message("Writing CPU profile to ", f.Name())
+		case "stop":
+			if cpuProfile == nil {
+				InfoBar.Error("No CPU profile is running")
+				return
+			}
+			pprof.StopCPUProfile()
+			err := cpuProfile.Close()
+			name := cpuProfile.Name()
+			cpuProfile = nil
+			if err != nil {
+				InfoBar.Error(err)
+				return
+			}
+			InfoBar.Message("Wrote CPU profile to ", name)
+		default:
+			InfoBar.Error("Invalid argument: ", args[1])
+		}
+	case "heap":
+		path := "heap.prof"
+		if len(args) > 1 {
+			path = args[1]
+		}
+		f, err := os.Create(path)
+		if err != nil {
+			InfoBar.Error(err)
+			return
+		}
+		runtime.GC()
+		err = pprof.WriteHeapProfile(f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			InfoBar.Error(err)
+			return
+		}
+		InfoBar.Message("Wrote heap profile to ", path)
+	default:
+		InfoBar.Error("Invalid argument: ", args[0])
+	}
+}
+
 // PwdCmd prints the current working directory
 func (h *BufPane) PwdCmd(args []string) {
 	wd, err := os.Getwd()
@@ -229,6 +889,72 @@ func (h *BufPane) PwdCmd(args []string) {
 	}
 }
 
+// InfoCmd shows the file format, encoding, size and filetype of the buffer
+func (h *BufPane) InfoCmd(args []string) {
+	b := h.Buf
+	info := []string{
+		b.GetName(),
+		b.FileType(),
+		b.Settings["encoding"].(string),
+		b.Settings["fileformat"].(string),
+		strconv.Itoa(b.LinesNum()) + " lines",
+		strconv.Itoa(b.Len()) + " bytes",
+	}
+	if b.Type == buffer.BTGPG || b.Type == buffer.BTArmorGPG {
+		info = append(info, "encrypted")
+	}
+	InfoBar.Message(strings.Join(info, ", "))
+}
+
+// CountCmd shows the number of characters, words and lines in the
+// selection, or in the whole buffer if nothing is selected
+func (h *BufPane) CountCmd(args []string) {
+	start, end := h.Buf.Start(), h.Buf.End()
+	what := "buffer"
+	if h.Cursor.HasSelection() {
+		start, end = h.Cursor.CurSelection[0], h.Cursor.CurSelection[1]
+		what = "selection"
+	}
+	chars, words, lines := h.Buf.Count(start, end)
+	InfoBar.Message(fmt.Sprintf("%d characters, %d words, %d lines in the %s", chars, words, lines, what))
+}
+
+// FileFormatCmd shows the line endings of the buffer, or converts them to
+// the given format when the buffer is next saved
+func (h *BufPane) FileFormatCmd(args []string) {
+	if len(args) == 0 {
+		InfoBar.Message("File format: ", h.Buf.Settings["fileformat"])
+		return
+	}
+
+	format := args[0]
+	if err := config.OptionIsValid("fileformat", format); err != nil {
+		InfoBar.Error(err)
+		return
+	}
+	if format == h.Buf.Settings["fileformat"] {
+		InfoBar.Message("File format is already ", format)
+		return
+	}
+	h.Buf.SetOptionNative("fileformat", format)
+	// the hash that Modified compares ignores line endings
+	h.Buf.ForceModified()
+	InfoBar.Message("File format set to ", format, ", save the buffer to convert its line endings")
+}
+
+// MessagesCmd shows the messages and errors that were sent to the info
+// bar in a split
+func (h *BufPane) MessagesCmd(args []string) {
+	log := InfoBar.MessageLog()
+	if len(log) == 0 {
+		InfoBar.Message("No messages")
+		return
+	}
+	msgBuf := buffer.NewBufferFromString(strings.Join(log, "\n"), "", buffer.BTScratch)
+	msgBuf.SetName("Messages")
+	h.HSplitBuf(msgBuf).CursorEnd()
+}
+
 // GetPasswords gets the passwrods for a new file
 func GetPasswords(filename string, callback func(btype buffer.BufType, passwords []screen.Password)) {
 	passwords := make([]screen.Password, 0, 1)
@@ -256,32 +982,99 @@ func GetPasswords(filename string, callback func(btype buffer.BufType, passwords
 	return
 }
 
+// newBufferFromFile creates a buffer for the given file and passes it to the
+// callback. If the file exists but the user does not have permission to
+// read it, the user is offered to read it with sudo instead
+// A file that looks binary is only opened once the user agrees to it, or
+// is opened readonly, depending on the binaryfile option
+func newBufferFromFile(filename string, btype buffer.BufType, passwords []screen.Password, callback func(b *buffer.Buffer)) {
+	buffer.OpenBinary(filename, btype, func(question string, answer func(bool)) {
+		InfoBar.YNPrompt(question+" (y,n)", func(yes, canceled bool) {
+			answer(yes && !canceled)
+		})
+	}, func(readonly bool) {
+		openBufferFromFile(filename, btype, passwords, func(b *buffer.Buffer) {
+			if readonly {
+				b.SetOptionNative("readonly", true)
+			}
+			callback(b)
+		})
+	})
+}
+
+// openBufferFromFile is newBufferFromFile without the check for binary
+// files
+func openBufferFromFile(filename string, btype buffer.BufType, passwords []screen.Password, callback func(b *buffer.Buffer)) {
+	b, err := buffer.NewBufferFromFile(filename, btype, passwords)
+	if err == nil {
+		callback(b)
+		return
+	}
+	if !os.IsPermission(err) {
+		InfoBar.Error(err)
+		return
+	}
+
+	openWithSudo := func() {
+		b, err := buffer.NewBufferFromFileWithSudo(filename, btype, passwords)
+		if err != nil {
+			InfoBar.Error(err)
+			return
+		}
+		callback(b)
+	}
+	if config.GlobalSettings["autosu"].(bool) {
+		openWithSudo()
+	} else {
+		InfoBar.YNPrompt("Permission denied. Do you want to read this file using sudo? (y,n)", func(yes, canceled bool) {
+			if yes && !canceled {
+				openWithSudo()
+			}
+		})
+	}
+}
+
 // OpenCmd opens a new buffer with a given filename
+// Several files, or a glob such as *.go, may be given: the first file is
+// opened in the current buffer and the others in new tabs, or all of them
+// in new tabs with the -t flag
 func (h *BufPane) OpenCmd(args []string) {
-	if len(args) > 0 {
-		filename := args[0]
-		// the filename might or might not be quoted, so unquote first then join the strings.
-		args, err := shellquote.Split(filename)
+	inTabs := false
+	var paths []string
+	for _, a := range args {
+		if a == "-t" {
+			inTabs = true
+		} else {
+			paths = append(paths, a)
+		}
+	}
+
+	if len(paths) > 0 {
+		files, err := expandPaths(paths)
 		if err != nil {
-			InfoBar.Error("Error parsing args ", err)
+			InfoBar.Error(err)
 			return
 		}
-		if len(args) == 0 {
+		if len(files) == 0 {
 			return
 		}
-		filename = strings.Join(args, " ")
+		if inTabs {
+			h.NewTabCmd(files)
+			return
+		}
+		filename := files[0]
 
 		open := func() {
 			GetPasswords(filename, func(btype buffer.BufType, passwords []screen.Password) {
 				if passwords == nil {
 					return
 				}
-				b, err := buffer.NewBufferFromFile(filename, btype, passwords)
-				if err != nil {
-					InfoBar.Error(err)
-					return
-				}
-				h.OpenBuffer(b)
+				newBufferFromFile(filename, btype, passwords, func(b *buffer.Buffer) {
+					h.OpenBuffer(b)
+					if len(files) > 1 {
+						h.NewTabCmd(files[1:])
+					}
+				})
 			})
 		}
 		if h.Buf.Modified() {
@@ -301,6 +1094,68 @@ func (h *BufPane) OpenCmd(args []string) {
 	}
 }
 
+// expandPaths expands the globs among the given paths into the files they
+// match, and returns an error naming the globs that match nothing
+// Paths without glob characters are kept as they are, as they may be new
+// files
+func expandPaths(paths []string) ([]string, error) {
+	var files, unmatched []string
+	for _, p := range paths {
+		if !strings.ContainsAny(p, "*?[") {
+			files = append(files, p)
+			continue
+		}
+		pattern, _ := util.ReplaceHome(p)
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			unmatched = append(unmatched, p)
+		}
+		files = append(files, matches...)
+	}
+	if len(unmatched) > 0 {
+		return files, errors.New("No files match " + strings.Join(unmatched, ", "))
+	}
+	return files, nil
+}
+
+// GotoFileCmd opens the file whose path is under the cursor, or switches
+// to it if it is already open
+// A :line:col suffix on the path moves the cursor to that position
+func (h *BufPane) GotoFileCmd(args []string) {
+	path := h.Buf.PathUnderCursor(h.Cursor)
+	if path == "" {
+		InfoBar.Error("No filename under the cursor")
+		return
+	}
+	resolved, ok := h.Buf.ResolvePath(path)
+	if !ok {
+		InfoBar.Error("Can't find file ", path)
+		return
+	}
+
+	name, cursorPos := util.GetPathAndCursorPosition(resolved)
+	absPath, _ := filepath.Abs(name)
+	for i, t := range Tabs.List {
+		for j, p := range t.Panes {
+			bp, ok := p.(*BufPane)
+			if !ok || bp.Buf.AbsPath != absPath {
+				continue
+			}
+			Tabs.SetActive(i)
+			t.SetActive(j)
+			if cursorPos != nil {
+				bp.GotoCmd([]string{strings.Join(cursorPos, ":")})
+			}
+			return
+		}
+	}
+
+	h.OpenCmd([]string{shellquote.Join(resolved)})
+}
+
 // ToggleLogCmd toggles the log view
 func (h *BufPane) ToggleLogCmd(args []string) {
 	if h.Buf.Type != buffer.BTLog {
@@ -317,6 +1172,7 @@ func (h *BufPane) ReloadCmd(args []string) {
 
 func ReloadConfig() {
 	config.InitRuntimeFiles()
+	buffer.ClearSyntaxCache()
 	err := config.ReadSettings()
 	if err != nil {
 		screen.TermMessage(err)
@@ -351,6 +1207,43 @@ func (h *BufPane) ReopenCmd(args []string) {
 	}
 }
 
+// ReloadBufferCmd reads the buffer's file from disk again as an edit that
+// can be undone
+func (h *BufPane) ReloadBufferCmd(args []string) {
+	if err := h.Buf.Reload(); err != nil {
+		InfoBar.Error(err)
+		return
+	}
+	h.Relocate()
+}
+
+// ClearStateCmd removes the saved cursor and undo history of the current
+// file, or of every file with the argument 'all'
+func (h *BufPane) ClearStateCmd(args []string) {
+	if len(args) > 0 {
+		if args[0] != "all" {
+			InfoBar.Error("Usage: clearstate [all]")
+			return
+		}
+		n, err := buffer.ClearAllSerialized()
+		if err != nil {
+			InfoBar.Error(err)
+			return
+		}
+		InfoBar.Message("Removed the saved state of ", n, " files")
+		return
+	}
+
+	removed, err := h.Buf.ClearSerialized()
+	if err != nil {
+		InfoBar.Error(err)
+	} else if removed {
+		InfoBar.Message("Removed the saved state of ", h.Buf.GetName())
+	} else {
+		InfoBar.Message("No saved state for ", h.Buf.GetName())
+	}
+}
+
 func (h *BufPane) openHelp(page string) error {
 	if data, err := config.FindRuntimeFile(config.RTHelp, page).Data(); err != nil {
 		return errors.New(fmt.Sprint("Unable to load help text", page, "\n", err))
@@ -397,12 +1290,9 @@ func (h *BufPane) VSplitCmd(args []string) {
 		if passwords == nil {
 			return
 		}
-		buf, err := buffer.NewBufferFromFile(args[0], btype, passwords)
-		if err != nil {
-			InfoBar.Error(err)
-			return
-		}
-		h.VSplitBuf(buf)
+		newBufferFromFile(args[0], btype, passwords, func(buf *buffer.Buffer) {
+			h.VSplitBuf(buf)
+		})
 	})
 }
 
@@ -419,13 +1309,9 @@ func (h *BufPane) HSplitCmd(args []string) {
 		if passwords == nil {
 			return
 		}
-		buf, err := buffer.NewBufferFromFile(args[0], btype, passwords)
-		if err != nil {
-			InfoBar.Error(err)
-			return
-		}
-
-		h.HSplitBuf(buf)
+		newBufferFromFile(args[0], btype, passwords, func(buf *buffer.Buffer) {
+			h.HSplitBuf(buf)
+		})
 	})
 }
 
@@ -444,18 +1330,15 @@ func (h *BufPane) NewTabCmd(args []string) {
 			if i < len(args) {
 				a := args[i]
 				GetPasswords(a, func(btype buffer.BufType, passwords []screen.Password) {
-					if passwords != nil {
+					if passwords == nil {
 						return
 					}
-					b, err := buffer.NewBufferFromFile(a, btype, passwords)
-					if err != nil {
-						InfoBar.Error(err)
-						return
-					}
-					tp := NewTabFromBuffer(0, 0, width, height-1-iOffset, b)
-					Tabs.AddTab(tp)
-					Tabs.SetActive(len(Tabs.List) - 1)
-					open(i + 1)
+					newBufferFromFile(a, btype, passwords, func(b *buffer.Buffer) {
+						tp := NewTabFromBuffer(0, 0, width, height-1-iOffset, b)
+						Tabs.AddTab(tp)
+						Tabs.SetActive(len(Tabs.List) - 1)
+						open(i + 1)
+					})
 				})
 			}
 		}
@@ -500,6 +1383,7 @@ func SetGlobalOptionNative(option string, nativeValue interface{}) error {
 				config.StartAutoSave()
 			} else {
 				config.SetAutoTime(0)
+				config.StopAutoSave()
 			}
 		} else if option == "paste" {
 			screen.Screen.SetPaste(nativeValue.(bool))
@@ -667,25 +1551,112 @@ func (h *BufPane) UnbindCmd(args []string) {
 
 // RunCmd runs a shell command in the background
 func (h *BufPane) RunCmd(args []string) {
-	runf, err := shell.RunBackgroundShell(shellquote.Join(args...))
+	runf, err := shell.RunBackgroundShellExit(runCmdLine(args))
 	if err != nil {
 		InfoBar.Error(err)
 	} else {
 		go func() {
-			InfoBar.Message(runf())
+			msg, code := runf()
+			if code != 0 {
+				InfoBar.Error(msg)
+			} else {
+				InfoBar.Message(msg)
+			}
 			screen.Redraw()
 		}()
 	}
 }
 
+// runCmdLine quotes the arguments of the run command again, so that an
+// argument such as 'my script.sh' stays a single argument
+func runCmdLine(args []string) string {
+	return shellquote.Join(args...)
+}
+
+// KillJobsCmd kills the commands started with run that are still running
+func (h *BufPane) KillJobsCmd(args []string) {
+	n := shell.KillBackgroundShells()
+	InfoBar.Message("Killed ", n, " background commands")
+}
+
 // QuitCmd closes the main view
 func (h *BufPane) QuitCmd(args []string) {
 	h.Quit()
 }
 
+// ForceQuitCmd closes the main view without asking to save its changes
+func (h *BufPane) ForceQuitCmd(args []string) {
+	h.ForceQuit()
+}
+
+// QuitAllCmd quits micro after asking for each modified buffer that is open
+// in any tab whether to save it, discard its changes or cancel quitting
+func (h *BufPane) QuitAllCmd(args []string) {
+	var panes []*BufPane
+	for _, t := range Tabs.List {
+		for _, p := range t.Panes {
+			bp, ok := p.(*BufPane)
+			if !ok || !bp.Buf.Modified() {
+				continue
+			}
+			dup := false
+			for _, other := range panes {
+				if other.Buf.SharedBuffer == bp.Buf.SharedBuffer {
+					dup = true
+					break
+				}
+			}
+			if !dup {
+				panes = append(panes, bp)
+			}
+		}
+	}
+
+	discarded := make(map[*buffer.SharedBuffer]bool)
+	quit := func() {
+		for len(buffer.OpenBuffers) > 0 {
+			b := buffer.OpenBuffers[0]
+			if discarded[b.SharedBuffer] {
+				b.Discard()
+			} else {
+				b.Close()
+			}
+		}
+		config.StopAutoSave()
+		screen.Screen.Fini()
+		InfoBar.Close()
+		runtime.Goexit()
+	}
+
+	var ask func(int)
+	ask = func(i int) {
+		if i >= len(panes) {
+			quit()
+			return
+		}
+		bp := panes[i]
+		choices := []string{"Save", "Discard", "Cancel"}
+		InfoBar.ChoicePrompt("Save changes to "+bp.Buf.GetName()+" before quitting?", choices, func(choice int, canceled bool) {
+			if canceled || choice == 2 {
+				return
+			}
+			if choice == 1 {
+				discarded[bp.Buf.SharedBuffer] = true
+				ask(i + 1)
+				return
+			}
+			bp.SaveCB("Quit", func(noPrompt bool) {
+				ask(i + 1)
+			})
+		})
+	}
+	ask(0)
+}
+
 // GotoCmd is a command that will send the cursor to a certain
 // position in the buffer
 // For example: `goto line`, or `goto line:col`
+// Negative line numbers count from the end of the buffer
 func (h *BufPane) GotoCmd(args []string) {
 	if len(args) <= 0 {
 		InfoBar.Error("Not enough arguments")
@@ -703,7 +1674,7 @@ func (h *BufPane) GotoCmd(args []string) {
 				InfoBar.Error(err)
 				return
 			}
-			line = util.Clamp(line-1, 0, h.Buf.LinesNum()-1)
+			line = h.lineIndex(line)
 			col = util.Clamp(col-1, 0, utf8.RuneCount(h.Buf.LineBytes(line)))
 			h.Cursor.GotoLoc(buffer.Loc{col, line})
 		} else {
@@ -712,25 +1683,108 @@ func (h *BufPane) GotoCmd(args []string) {
 				InfoBar.Error(err)
 				return
 			}
-			line = util.Clamp(line-1, 0, h.Buf.LinesNum()-1)
+			line = h.lineIndex(line)
 			h.Cursor.GotoLoc(buffer.Loc{0, line})
 		}
 		h.Relocate()
 	}
 }
 
-// SaveCmd saves the buffer optionally with an argument file name
+// lineIndex converts a line number as given to goto into a line index in
+// the buffer, clamped to its bounds
+// Line numbers start at 1, and -1 is the last line
+func (h *BufPane) lineIndex(line int) int {
+	if line < 0 {
+		line += h.Buf.LinesNum() + 1
+	}
+	return util.Clamp(line-1, 0, h.Buf.LinesNum()-1)
+}
+
+// SaveCmd saves the buffer optionally with an argument file name, and
+// with -f overwrites the file even if it changed on disk
 func (h *BufPane) SaveCmd(args []string) {
-	if len(args) == 0 {
-		h.Save()
+	force := len(args) > 0 && args[0] == "-f"
+	if force {
+		args = args[1:]
+	}
+
+	if len(args) > 0 {
+		if force {
+			h.saveForce(args[0])
+		} else {
+			h.saveBufToFile(args[0], "SaveAs", nil)
+		}
+	} else if force && h.Buf.Path != "" {
+		h.saveForce(h.Buf.Path)
 	} else {
-		h.Buf.SaveAs(args[0])
+		h.Save()
 	}
 }
 
+// SaveAllCmd saves every modified buffer that is open in any tab and
+// reports how many buffers were written
+func (h *BufPane) SaveAllCmd(args []string) {
+	var bufs []*buffer.Buffer
+	for _, t := range Tabs.List {
+		for _, p := range t.Panes {
+			bp, ok := p.(*BufPane)
+			if !ok {
+				continue
+			}
+			b := bp.Buf
+			if b.Path == "" || !b.Modified() {
+				continue
+			}
+			dup := false
+			for _, other := range bufs {
+				if other.SharedBuffer == b.SharedBuffer {
+					dup = true
+					break
+				}
+			}
+			if !dup {
+				bufs = append(bufs, b)
+			}
+		}
+	}
+
+	nsaved := 0
+	var save func(int)
+	save = func(i int) {
+		if i >= len(bufs) {
+			if nsaved == 1 {
+				InfoBar.Message("Saved 1 buffer")
+			} else {
+				InfoBar.Message(fmt.Sprintf("Saved %d buffers", nsaved))
+			}
+			return
+		}
+		b := bufs[i]
+		CheckPassword(b, b.Path, func() {
+			if err := b.Save(); err != nil {
+				InfoBar.Error(err)
+				return
+			}
+			nsaved++
+			save(i + 1)
+		})
+	}
+	save(0)
+}
+
+// WriteQuitCmd saves the current buffer and then closes the view
+// If the buffer has no path the user is prompted for a filename first
+func (h *BufPane) WriteQuitCmd(args []string) {
+	h.SaveCB("Quit", func(noPrompt bool) {
+		if !h.Buf.Modified() {
+			h.Quit()
+		}
+	})
+}
+
 // ReplaceCmd runs search and replace
 func (h *BufPane) ReplaceCmd(args []string) {
-	if len(args) < 2 || len(args) > 4 {
+	if len(args) < 2 || len(args) > 7 {
 		// We need to find both a search and replace expression
 		InfoBar.Error("Invalid replace statement: " + strings.Join(args, " "))
 		return
@@ -738,6 +1792,9 @@ func (h *BufPane) ReplaceCmd(args []string) {
 
 	all := false
 	noRegex := false
+	ignoreCase := h.Buf.Settings["ignorecase"].(bool)
+	wholeWord := false
+	multiline := false
 
 	foundSearch := false
 	foundReplace := false
@@ -749,6 +1806,12 @@ func (h *BufPane) ReplaceCmd(args []string) {
 			all = true
 		case "-l":
 			noRegex = true
+		case "-i":
+			ignoreCase = true
+		case "-w":
+			wholeWord = true
+		case "-z":
+			multiline = true
 		default:
 			if !foundSearch {
 				foundSearch = true
@@ -765,17 +1828,21 @@ func (h *BufPane) ReplaceCmd(args []string) {
 
 	if noRegex {
 		search = regexp.QuoteMeta(search)
+		// $ has a special meaning in the replacement as well, so it must
+		// be escaped for a literal replacement
+		replaceStr = strings.Replace(replaceStr, "$", "$$", -1)
+	}
+
+	if wholeWord {
+		search = `\b(?:` + search + `)\b`
+	}
+	if ignoreCase {
+		search = "(?i)" + search
 	}
 
 	replace := []byte(replaceStr)
 
-	var regex *regexp.Regexp
-	var err error
-	if h.Buf.Settings["ignorecase"].(bool) {
-		regex, err = regexp.Compile("(?im)" + search)
-	} else {
-		regex, err = regexp.Compile("(?m)" + search)
-	}
+	regex, err := regexp.Compile("(?m)" + search)
 	if err != nil {
 		// There was an error with the user's regex
 		InfoBar.Error(err)
@@ -787,25 +1854,31 @@ func (h *BufPane) ReplaceCmd(args []string) {
 	end := h.Buf.End()
 	selection := h.Cursor.HasSelection()
 	if selection {
+		// only matches that lie completely inside the selection are replaced
 		start = h.Cursor.CurSelection[0]
 		end = h.Cursor.CurSelection[1]
+		if start.GreaterThan(end) {
+			start, end = end, start
+		}
 	}
-	if all {
+	if all && multiline {
+		nreplaced, _ = h.Buf.ReplaceRegexMultiline(start, end, regex, replace)
+	} else if all {
 		nreplaced, _ = h.Buf.ReplaceRegex(start, end, regex, replace)
 	} else {
-		inRange := func(l buffer.Loc) bool {
-			return l.GreaterEqual(start) && l.LessEqual(end)
+		findNext := h.Buf.FindNextInRange
+		if multiline {
+			findNext = h.Buf.FindNextMultiline
 		}
+		// the text after end never changes, so its length gives end back
+		// after replacements that add or remove lines
+		tail := end.Diff(h.Buf.End(), h.Buf)
 
 		searchLoc := start
 		var doReplacement func()
 		doReplacement = func() {
-			locs, found, err := h.Buf.FindNext(search, start, end, searchLoc, true, !noRegex)
-			if err != nil {
-				InfoBar.Error(err)
-				return
-			}
-			if !found || !inRange(locs[0]) || !inRange(locs[1]) {
+			locs, found := findNext(regex, start, end, searchLoc)
+			if !found {
 				h.Cursor.ResetSelection()
 				h.Buf.RelocateCursors()
 				return
@@ -816,23 +1889,37 @@ func (h *BufPane) ReplaceCmd(args []string) {
 
 			h.Relocate()
 
-			InfoBar.YNPrompt("Perform replacement (y,n,esc)", func(yes, canceled bool) {
-				if !canceled && yes {
+			preview := h.Buf.ExpandReplacement(locs[0], locs[1], regex, replace)
+			InfoBar.YNPrompt("Replace with '"+string(preview)+"'? (y,n,esc)", func(yes, canceled bool) {
+				if !canceled && yes && multiline {
+					n := locs[0].Diff(locs[1], h.Buf)
+					_, nrunes := h.Buf.ReplaceRegexMultiline(locs[0], locs[1], regex, replace)
+
+					searchLoc = locs[0].Move(n+nrunes, h.Buf)
+					end = h.Buf.End().Move(-tail, h.Buf)
+					h.Cursor.Loc = searchLoc
+					nreplaced++
+				} else if !canceled && yes {
 					_, nrunes := h.Buf.ReplaceRegex(locs[0], locs[1], regex, replace)
 
 					searchLoc = locs[0]
 					searchLoc.X += nrunes + locs[0].Diff(locs[1], h.Buf)
-					end.Move(nrunes, h.Buf)
+					if end.Y == locs[0].Y {
+						end.X += nrunes
+					}
 					h.Cursor.Loc = searchLoc
 					nreplaced++
 				} else if !canceled && !yes {
-					searchLoc = locs[0]
-					searchLoc.X += utf8.RuneCount(replace)
+					searchLoc = locs[1]
 				} else if canceled {
 					h.Cursor.ResetSelection()
 					h.Buf.RelocateCursors()
 					return
 				}
+				if locs[0] == locs[1] {
+					// don't get stuck on an empty match
+					searchLoc = searchLoc.Move(1, h.Buf)
+				}
 				doReplacement()
 			})
 		}
@@ -844,11 +1931,11 @@ func (h *BufPane) ReplaceCmd(args []string) {
 
 	var s string
 	if nreplaced > 1 {
-		s = fmt.Sprintf("Replaced %d occurrences of %s", nreplaced, search)
+		s = fmt.Sprintf("Replaced %d occurrences of %s", nreplaced, regex)
 	} else if nreplaced == 1 {
-		s = fmt.Sprintf("Replaced 1 occurrence of %s", search)
+		s = fmt.Sprintf("Replaced 1 occurrence of %s", regex)
 	} else {
-		s = fmt.Sprintf("Nothing matched %s", search)
+		s = fmt.Sprintf("Nothing matched %s", regex)
 	}
 
 	if selection {
@@ -935,14 +2022,76 @@ func (h *BufPane) TermCmd(args []string) {
 	}
 }
 
+// splitCommands splits input at every ; that is not quoted or escaped,
+// the way the shell separates commands, and leaves out empty commands
+func splitCommands(input string) []string {
+	var cmds []string
+	add := func(cmd string) {
+		if strings.TrimSpace(cmd) != "" {
+			cmds = append(cmds, cmd)
+		}
+	}
+
+	var quote rune
+	escaped := false
+	start := 0
+	for i, r := range input {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == ';':
+			add(input[start:i])
+			start = i + 1
+		}
+	}
+	add(input[start:])
+	return cmds
+}
+
 // HandleCommand handles input from the user
+// Several commands separated by ; run one after the other, in the pane
+// that is active when each one starts, until one of them shows an error or
+// opens a prompt
 func (h *BufPane) HandleCommand(input string) {
+	cmds := splitCommands(input)
+	if len(cmds) <= 1 {
+		h.handleCommand(input)
+		return
+	}
+
+	for _, cmd := range cmds {
+		InfoBar.HasError = false
+		h.handleCommand(cmd)
+		if InfoBar.HasError || InfoBar.HasPrompt {
+			return
+		}
+		if p := MainTab().CurPane(); p != nil {
+			h = p
+		}
+	}
+}
+
+// handleCommand runs a single command
+func (h *BufPane) handleCommand(input string) {
 	args, err := shellquote.Split(input)
 	if err != nil {
 		InfoBar.Error("Error parsing args ", err)
 		return
 	}
 
+	if args, err = expandAlias(args); err != nil {
+		InfoBar.Error(err)
+		return
+	}
+
 	if len(args) == 0 {
 		return
 	}
@@ -0,0 +1,72 @@
+package action
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	shellquote "github.com/kballard/go-shellquote"
+
+	"github.com/zyedidia/micro/internal/shell"
+)
+
+func TestSplitCommands(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"save", []string{"save"}},
+		{"set tabsize 4; save; quit", []string{"set tabsize 4", " save", " quit"}},
+		// empty commands are left out
+		{"save;;quit;", []string{"save", "quit"}},
+		{" ; ", nil},
+		{"", nil},
+		// quoted and escaped semicolons stay in the command
+		{`run "a;b"; quit`, []string{`run "a;b"`, " quit"}},
+		{`run 'a;b'`, []string{`run 'a;b'`}},
+		{`textfilter sed s/a/b/\;s/c/d/`, []string{`textfilter sed s/a/b/\;s/c/d/`}},
+		{`run "a\";b"; quit`, []string{`run "a\";b"`, " quit"}},
+		// a backslash does not escape inside single quotes
+		{`run 'a\'; quit`, []string{`run 'a\'`, " quit"}},
+		// an escaped backslash does not escape the semicolon after it
+		{`run a\\; quit`, []string{`run a\\`, " quit"}},
+	}
+	for _, test := range tests {
+		if got := splitCommands(test.input); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("splitCommands(%q) = %q, want %q", test.input, got, test.want)
+		}
+	}
+}
+
+func TestRunCmdLine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "micro-run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	script := filepath.Join(dir, "my script.sh")
+	if err := ioutil.WriteFile(script, []byte("#!/bin/sh\nexit 0\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// the arguments as the command parser splits run 'dir/my script.sh'
+	args, err := shellquote.Split("run " + shellquote.Join(script))
+	if err != nil {
+		t.Fatal(err)
+	}
+	args = args[1:]
+	if len(args) != 1 || args[0] != script {
+		t.Fatalf("split into %q", args)
+	}
+
+	runf, err := shell.RunBackgroundShellExit(runCmdLine(args))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg, code := runf(); code != 0 {
+		t.Errorf("running %q failed: %s", script, msg)
+	}
+}
@@ -64,7 +64,7 @@ func DefaultBindings() map[string]string {
 		"CtrlPageDown":   "NextTab",
 		"CtrlG":          "ToggleHelp",
 		"Alt-g":          "ToggleKeyMenu",
-		"CtrlR":          "ToggleRuler",
+		"CtrlR":          "HistorySearch|ToggleRuler",
 		"CtrlL":          "command-edit:goto ",
 		"Delete":         "Delete",
 		"CtrlB":          "ShellMode",
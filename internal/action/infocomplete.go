@@ -7,6 +7,7 @@ import (
 
 	"github.com/zyedidia/micro/internal/buffer"
 	"github.com/zyedidia/micro/internal/config"
+	"github.com/zyedidia/micro/internal/screen"
 	"github.com/zyedidia/micro/internal/util"
 )
 
@@ -25,6 +26,11 @@ func CommandComplete(b *buffer.Buffer) ([]string, []string) {
 			suggestions = append(suggestions, cmd)
 		}
 	}
+	for alias := range aliases {
+		if _, ok := commands[alias]; !ok && strings.HasPrefix(alias, input) {
+			suggestions = append(suggestions, alias)
+		}
+	}
 
 	sort.Strings(suggestions)
 	completions := make([]string, len(suggestions))
@@ -278,3 +284,50 @@ func PluginComplete(b *buffer.Buffer) ([]string, []string) {
 // 	pluginCompletions = append(pluginCompletions, LuaFunctionComplete(function))
 // 	return Completion(-len(pluginCompletions))
 // }
+
+// FileFormatComplete autocompletes the formats of the fileformat command
+var FileFormatComplete = MakeCompleter(func(input string, args []string) []string {
+	return []string{"unix", "dos"}
+})
+
+// MakeCompleter returns a completer that suggests the strings returned by
+// fn which start with the argument being typed
+// fn is called each time completion is requested, with the argument typed
+// so far and the arguments before it, so plugins can compute the
+// suggestions on demand, for example from the output of a program
+func MakeCompleter(fn func(input string, args []string) []string) buffer.Completer {
+	return func(b *buffer.Buffer) (completions []string, suggestions []string) {
+		// an error in a lua callback must not bring down the editor
+		defer func() {
+			if err := recover(); err != nil {
+				screen.TermMessage(err)
+				completions, suggestions = nil, nil
+			}
+		}()
+
+		c := b.GetActiveCursor()
+		l := b.LineBytes(c.Y)
+		l = util.SliceStart(l, c.X)
+		input, argstart := buffer.GetArg(b)
+
+		// the first word is the command itself and the last one is input
+		var args []string
+		words := strings.Split(string(l), " ")
+		if len(words) > 2 {
+			args = words[1 : len(words)-1]
+		}
+
+		for _, s := range fn(input, args) {
+			if strings.HasPrefix(s, input) && !contains(suggestions, s) {
+				suggestions = append(suggestions, s)
+			}
+		}
+
+		sort.Strings(suggestions)
+		completions = make([]string, len(suggestions))
+		for i := range suggestions {
+			completions[i] = util.SliceEndStr(suggestions[i], c.X-argstart)
+		}
+		return completions, suggestions
+	}
+}
@@ -40,6 +40,10 @@ func (h *InfoPane) Close() {
 func (h *InfoPane) HandleEvent(event tcell.Event) {
 	switch e := event.(type) {
 	case *tcell.EventKey:
+		if h.HasChoice {
+			h.handleChoiceKey(e)
+			return
+		}
 		ke := KeyEvent{
 			code: e.Key(),
 			mod:  e.Modifiers(),
@@ -66,6 +70,7 @@ func (h *InfoPane) HandleEvent(event tcell.Event) {
 			}
 		}
 		if done && h.HasPrompt && !hasYN {
+			h.UpdateHistorySearch()
 			resp := string(h.LineBytes(0))
 			hist := h.History[h.PromptType]
 			hist[h.HistoryNum] = resp
@@ -78,6 +83,23 @@ func (h *InfoPane) HandleEvent(event tcell.Event) {
 	}
 }
 
+// handleChoiceKey moves through the choices of a ChoicePrompt, or picks
+// one or cancels the prompt
+func (h *InfoPane) handleChoiceKey(e *tcell.EventKey) {
+	switch e.Key() {
+	case tcell.KeyLeft, tcell.KeyUp, tcell.KeyBacktab:
+		h.NextChoice(-1)
+	case tcell.KeyRight, tcell.KeyDown, tcell.KeyTab:
+		h.NextChoice(1)
+	case tcell.KeyEnter:
+		h.DonePrompt(false)
+	case tcell.KeyEscape, tcell.KeyCtrlQ, tcell.KeyCtrlC:
+		h.DonePrompt(true)
+	case tcell.KeyRune:
+		h.PickChoice(e.Rune())
+	}
+}
+
 // DoKeyEvent executes a key event for the command bar, doing any overridden actions
 func (h *InfoPane) DoKeyEvent(e KeyEvent) bool {
 	done := false
@@ -164,20 +186,39 @@ var InfoOverrides = map[string]InfoKeyAction{
 	"Escape":        (*InfoPane).Escape,
 	"Quit":          (*InfoPane).Quit,
 	"QuitAll":       (*InfoPane).QuitAll,
+	"HistorySearch": (*InfoPane).SearchHistory,
 }
 
 // CursorUp cycles history up
 func (h *InfoPane) CursorUp() {
+	if h.SearchingHistory {
+		h.CycleHistorySearch(true)
+		return
+	}
 	h.UpHistory(h.History[h.PromptType])
 }
 
 // CursorDown cycles history down
 func (h *InfoPane) CursorDown() {
+	if h.SearchingHistory {
+		h.CycleHistorySearch(false)
+		return
+	}
 	h.DownHistory(h.History[h.PromptType])
 }
 
+// SearchHistory searches the history of the prompt for what is typed
+// into it, like CtrlR in a shell
+func (h *InfoPane) SearchHistory() {
+	h.StartHistorySearch()
+}
+
 // Autocomplete begins autocompletion
 func (h *InfoPane) Autocomplete() {
+	if h.SearchingHistory {
+		h.EndHistorySearch(true)
+		return
+	}
 	b := h.Buf
 	if b.HasSuggestions {
 		b.CycleAutocomplete(true)
@@ -190,6 +231,9 @@ func (h *InfoPane) Autocomplete() {
 
 	args := bytes.Split(l, []byte{' '})
 	cmd := string(args[0])
+	if expanded, err := expandAlias([]string{cmd}); err == nil && len(expanded) > 0 {
+		cmd = expanded[0]
+	}
 
 	if h.PromptType == "Command" {
 		if len(args) == 1 {
@@ -222,7 +266,11 @@ func (h *InfoPane) QuitAll() {
 	h.DonePrompt(true)
 }
 
-// Escape cancels the prompt
+// Escape cancels the prompt, or the history search if there is one
 func (h *InfoPane) Escape() {
+	if h.SearchingHistory {
+		h.EndHistorySearch(false)
+		return
+	}
 	h.DonePrompt(true)
 }
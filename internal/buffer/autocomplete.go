@@ -59,7 +59,7 @@ func (b *Buffer) CycleAutocomplete(forward bool) {
 		// end = start.Move(1, b)
 	}
 
-	b.Replace(start, end, b.Completions[b.CurSuggestion])
+	b.ReplaceRange(start, end, b.Completions[b.CurSuggestion])
 	if len(b.Suggestions) > 1 {
 		b.HasSuggestions = true
 	}
@@ -59,15 +59,15 @@ func (b *Buffer) Backup(checkTime bool) error {
 		eol := []byte{'\n'}
 
 		// write lines
-		if _, e = file.Write(b.lines[0].data); e != nil {
+		if _, e = file.Write(b.peek(0)); e != nil {
 			return
 		}
 
-		for _, l := range b.lines[1:] {
+		for i := 1; i < len(b.lines); i++ {
 			if _, e = file.Write(eol); e != nil {
 				return
 			}
-			if _, e = file.Write(l.data); e != nil {
+			if _, e = file.Write(b.peek(i)); e != nil {
 				return
 			}
 		}
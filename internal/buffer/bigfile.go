@@ -0,0 +1,326 @@
+package buffer
+
+import (
+	"bufio"
+	"io"
+	"os"
+
+	"github.com/zyedidia/micro/internal/util"
+)
+
+// maxLazyLines is the number of lines read from the file backing a lazy
+// line array that are kept in memory before the ones far from the last
+// line read are dropped again
+const maxLazyLines = 20000
+
+// lazyHighlightLines is the number of lines at the start of a lazy line
+// array that are highlighted when the syntax rules are set, since
+// highlighting the whole file would read all of it
+const lazyHighlightLines = maxLazyLines / 4
+
+// lazySource is the file that the unedited lines of a lazy line array
+// are read from
+type lazySource struct {
+	r io.ReaderAt
+	// name is the path of the file, if it is known
+	name string
+	// closer is closed once the lines no longer need the file, it may be nil
+	closer io.Closer
+
+	// loaded holds the numbers of the lines currently read in, so that
+	// dropping lines does not go over the whole file, and last is the line
+	// read most recently
+	loaded []int
+	last   int
+	// shifted is set when lines were added or removed, after which the
+	// numbers in loaded must be found again
+	shifted bool
+}
+
+// NewLineArrayLazy returns a line array whose lines are read from r on
+// demand instead of up front
+// Only the offset and length of each line are kept until a line is
+// accessed, lines that are edited are then owned by the line array, and
+// unedited lines far from the ones in use are dropped again
+// r must keep returning the same data for as long as the line array uses
+// it, and closer, if not nil, is closed once it is not needed anymore
+func NewLineArrayLazy(size uint64, endings FileFormat, r io.ReaderAt, closer io.Closer) *LineArray {
+	la := new(LineArray)
+	la.initsize = size
+	la.src = &lazySource{r: r, closer: closer}
+	la.lines = make([]Line, 0, 1000)
+
+	br := bufio.NewReaderSize(io.NewSectionReader(r, 0, int64(size)), 1<<16)
+	var off int64
+	// the number of lines is estimated from the first ones, like in
+	// NewLineArray
+	estimated := false
+	for {
+		// the line is read in pieces so that a very long line does not
+		// need to be held in memory
+		var n int64
+		var prev, last byte
+		var err error
+		for {
+			var chunk []byte
+			chunk, err = br.ReadSlice('\n')
+			n += int64(len(chunk))
+			if len(chunk) > 1 {
+				prev, last = chunk[len(chunk)-2], chunk[len(chunk)-1]
+			} else if len(chunk) == 1 {
+				prev, last = last, chunk[0]
+			}
+			if err != bufio.ErrBufferFull {
+				break
+			}
+		}
+
+		length := n
+		if err == nil {
+			// Even if the file format is set to DOS, the '\r' is removed so
+			// that all lines end with '\n'
+			length--
+			if prev == '\r' && length > 0 {
+				length--
+				if endings == FFAuto {
+					la.Endings = FFDos
+				}
+			} else if endings == FFAuto {
+				la.Endings = FFUnix
+			}
+		} else if n > 0 && endings == FFAuto {
+			la.Endings = FFUnix
+		}
+
+		la.lines = append(la.lines, Line{
+			off:  off,
+			size: int(length),
+			lazy: true,
+		})
+		off += n
+		if !estimated && len(la.lines) == cap(la.lines) && off > 0 {
+			la.lines = growLines(la.lines, size*uint64(len(la.lines))/uint64(off))
+			estimated = true
+		}
+
+		if err != nil {
+			// Last line was read
+			break
+		}
+	}
+
+	return la
+}
+
+// IsLazy returns whether the lines are read from the file on demand
+func (la *LineArray) IsLazy() bool {
+	return la.src != nil
+}
+
+// data returns the bytes of line n, reading them from the backing file if
+// the line is lazy and not in memory
+// The data of a lazy line is only looked at with lazyLock held, since
+// dropLazyLines may free it from another goroutine
+func (la *LineArray) data(n int) []byte {
+	l := &la.lines[n]
+	if !l.lazy {
+		return l.data
+	}
+
+	la.lazyLock.Lock()
+	defer la.lazyLock.Unlock()
+	if !l.lazy || l.data != nil {
+		return l.data
+	}
+	if len(la.src.loaded) >= maxLazyLines {
+		la.dropLazyLines(n)
+	}
+	l.data = la.readLine(n)
+	la.src.loaded = append(la.src.loaded, n)
+	la.src.last = n
+	return l.data
+}
+
+// peek returns the bytes of line n like data, but without keeping a lazy
+// line in memory, for operations that go over the whole file once
+func (la *LineArray) peek(n int) []byte {
+	l := &la.lines[n]
+	if !l.lazy {
+		return l.data
+	}
+
+	la.lazyLock.Lock()
+	defer la.lazyLock.Unlock()
+	if !l.lazy || l.data != nil {
+		return l.data
+	}
+	return la.readLine(n)
+}
+
+// readLine reads lazy line n from the backing file
+// If the file got shorter in the meantime the line is cut short
+func (la *LineArray) readLine(n int) []byte {
+	l := &la.lines[n]
+	buf := make([]byte, l.size)
+	read, _ := la.src.r.ReadAt(buf, l.off)
+	return buf[:read]
+}
+
+// dropLazyLines frees the unedited lines that are far from line n and
+// from the line read before it
+// Only the loaded lines are looked at, unless lines were added or removed
+// since the last time
+func (la *LineArray) dropLazyLines(n int) {
+	if la.src.shifted {
+		la.src.loaded = la.src.loaded[:0]
+		for i := range la.lines {
+			if l := &la.lines[i]; l.lazy && l.data != nil {
+				la.src.loaded = append(la.src.loaded, i)
+			}
+		}
+		la.src.shifted = false
+	}
+
+	keep := maxLazyLines / 4
+	near := func(i, y int) bool {
+		return i >= y-keep && i <= y+keep
+	}
+	kept := la.src.loaded[:0]
+	for _, i := range la.src.loaded {
+		if i >= len(la.lines) {
+			continue
+		}
+		l := &la.lines[i]
+		if !l.lazy || l.data == nil {
+			continue
+		}
+		if near(i, n) || near(i, la.src.last) {
+			kept = append(kept, i)
+		} else {
+			l.data = nil
+		}
+	}
+	la.src.loaded = kept
+}
+
+// linesShifted records that lines were added to or removed from a lazy
+// line array, which changes the numbers of the loaded lines
+func (la *LineArray) linesShifted() {
+	if la.src == nil {
+		return
+	}
+	la.lazyLock.Lock()
+	la.src.shifted = true
+	la.lazyLock.Unlock()
+}
+
+// firstLines limits the lines of a buffer that the highlighter sees to the
+// first n
+type firstLines struct {
+	*Buffer
+	n int
+}
+
+func (f firstLines) LinesNum() int {
+	return util.Min(f.n, f.Buffer.LinesNum())
+}
+
+// Detach reads every line that is still lazy into memory and closes the
+// backing file, which must be done before that file is overwritten
+func (la *LineArray) Detach() {
+	if la.src == nil {
+		return
+	}
+	la.lazyLock.Lock()
+	defer la.lazyLock.Unlock()
+	for i := range la.lines {
+		l := &la.lines[i]
+		if l.lazy {
+			if l.data == nil {
+				l.data = la.readLine(i)
+			}
+			l.lazy = false
+		}
+	}
+	la.closeSource()
+}
+
+// closeSource closes the backing file without reading the lazy lines,
+// after which the line array must not be used anymore
+func (la *LineArray) closeSource() {
+	if la.src != nil && la.src.closer != nil {
+		la.src.closer.Close()
+	}
+	la.src = nil
+}
+
+// openLazy opens the file read from r again as the backing file of a lazy
+// line array if the bigfile option applies to it
+// It returns nil if the file should be read in full as usual
+func (b *Buffer) openLazy(r io.Reader, size int64) *LineArray {
+	if !b.Settings["bigfile"].(bool) || size <= int64(largeFileThreshold()) || b.Type != BTDefault {
+		return nil
+	}
+	if enc := b.Settings["encoding"].(string); enc != "utf-8" && enc != "utf8" {
+		return nil
+	}
+	file, ok := r.(*os.File)
+	if !ok {
+		return nil
+	}
+	f, err := os.Open(file.Name())
+	if err != nil {
+		return nil
+	}
+	la := NewLineArrayLazy(uint64(size), FFAuto, f, f)
+	la.src.name = f.Name()
+	return la
+}
+
+// readsFrom returns whether lazy lines are read from the given file
+func (la *LineArray) readsFrom(filename string) bool {
+	if la.src == nil || la.src.name == "" {
+		return false
+	}
+	a, err := os.Stat(la.src.name)
+	if err != nil {
+		return false
+	}
+	b, err := os.Stat(filename)
+	return err == nil && os.SameFile(a, b)
+}
+
+// reopenLazy reads a lazy buffer's file again after it changed on disk
+// The lazy lines no longer match the file, so the line array is replaced
+// and the undo history cleared instead of applying a diff
+func (b *Buffer) reopenLazy(file *os.File) error {
+	size := util.FSize(file)
+	la := b.openLazy(file, size)
+	if la == nil {
+		la = NewLineArray(uint64(size), FFAuto, bufio.NewReader(file))
+	}
+	b.closeSource()
+	b.LineArray = la
+	b.UndoStack = new(TEStack)
+	b.RedoStack = new(TEStack)
+	b.ModifiedThisFrame = true
+
+	b.ClearMatches()
+	b.UpdateRules()
+
+	err := b.UpdateModTime()
+	b.isModified = false
+	b.RelocateCursors()
+	return err
+}
+
+// SharedWithOpenBuffer returns whether another open buffer shows the same
+// file as this one
+func (b *Buffer) SharedWithOpenBuffer() bool {
+	for _, buf := range OpenBuffers {
+		if buf != b && buf.SharedBuffer == b.SharedBuffer {
+			return true
+		}
+	}
+	return false
+}
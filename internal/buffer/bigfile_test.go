@@ -0,0 +1,155 @@
+package buffer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zyedidia/micro/internal/config"
+)
+
+func TestNewLineArrayLazy(t *testing.T) {
+	for _, text := range []string{
+		"one\ntwo\n\nfour",
+		"one\r\ntwo\r\n\r\nfour\r\n",
+		"\n",
+		unicode_txt,
+	} {
+		eager := NewLineArray(uint64(len(text)), FFAuto, strings.NewReader(text))
+		lazy := NewLineArrayLazy(uint64(len(text)), FFAuto, strings.NewReader(text), nil)
+
+		assert.True(t, lazy.IsLazy())
+		assert.Equal(t, eager.LinesNum(), lazy.LinesNum())
+		assert.Equal(t, eager.Endings, lazy.Endings)
+		assert.Equal(t, string(eager.Bytes()), string(lazy.Bytes()))
+		for i := 0; i < eager.LinesNum(); i++ {
+			assert.Equal(t, string(eager.LineBytes(i)), string(lazy.LineBytes(i)))
+		}
+	}
+}
+
+func TestLineArrayLazyEdits(t *testing.T) {
+	text := "alpha\nbeta\ngamma\ndelta"
+	la := NewLineArrayLazy(uint64(len(text)), FFAuto, strings.NewReader(text), nil)
+
+	la.insert(Loc{2, 1}, []byte("X\nY"))
+	la.remove(Loc{1, 3}, Loc{2, 4})
+	assert.Equal(t, "alpha\nbeX\nYta\nglta", string(la.Bytes()))
+	assert.False(t, la.lines[1].lazy)
+	assert.True(t, la.lines[0].lazy)
+
+	// edited lines are kept when the unedited ones are dropped
+	la.dropLazyLines(0)
+	assert.Equal(t, "alpha\nbeX\nYta\nglta", string(la.Bytes()))
+
+	la.Detach()
+	assert.False(t, la.IsLazy())
+	assert.Equal(t, "alpha\nbeX\nYta\nglta", string(la.Bytes()))
+}
+
+func TestLineArrayLazyDropsLines(t *testing.T) {
+	var sb strings.Builder
+	n := 3 * maxLazyLines
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&sb, "line %d\n", i)
+	}
+	text := sb.String()
+	la := NewLineArrayLazy(uint64(len(text)), FFAuto, strings.NewReader(text), nil)
+
+	for i := 0; i < n; i++ {
+		assert.Equal(t, fmt.Sprintf("line %d", i), string(la.LineBytes(i)))
+	}
+	loaded := 0
+	for i := range la.lines {
+		if la.lines[i].data != nil {
+			loaded++
+		}
+	}
+	assert.True(t, loaded <= maxLazyLines)
+	assert.Equal(t, loaded, len(la.src.loaded))
+	assert.Nil(t, la.lines[0].data)
+
+	// lines that moved because others were removed are still dropped
+	la.deleteLines(0, 9)
+	for i := 0; i < n-10; i++ {
+		assert.Equal(t, fmt.Sprintf("line %d", i+10), string(la.LineBytes(i)))
+	}
+	loaded = 0
+	for i := range la.lines {
+		if la.lines[i].data != nil {
+			loaded++
+		}
+	}
+	assert.True(t, loaded <= maxLazyLines)
+	assert.Nil(t, la.lines[0].data)
+
+	// peeking does not keep lines in memory
+	la.peek(1)
+	assert.Nil(t, la.lines[1].data)
+}
+
+func TestLineArrayLazyConcurrentReads(t *testing.T) {
+	var sb strings.Builder
+	n := 3 * maxLazyLines
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&sb, "line %d\n", i)
+	}
+	text := sb.String()
+	la := NewLineArrayLazy(uint64(len(text)), FFAuto, strings.NewReader(text), nil)
+
+	// the highlighter reads lines in the background while the view keeps
+	// reading the first line, which the highlighter drops from memory
+	assert.Equal(t, "line 0", string(la.LineBytes(0)))
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < n; i++ {
+			if string(la.LineBytes(i)) != fmt.Sprintf("line %d", i) {
+				t.Errorf("Wrong line %d", i)
+			}
+		}
+		done <- true
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+			assert.Equal(t, "line 0", string(la.LineBytes(0)))
+		}
+	}
+}
+
+func TestBigFileSave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "micro-bigfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	text := strings.Repeat("the quick brown fox jumps over the lazy dog\n", 2000)
+	name := filepath.Join(dir, "big.log")
+	ioutil.WriteFile(name, []byte(text), 0644)
+
+	globals := config.GlobalSettings
+	config.GlobalSettings = map[string]interface{}{"bigfile": true, "backup": false}
+	defer func() { config.GlobalSettings = globals }()
+
+	b, err := NewBufferFromFile(name, BTDefault, nil)
+	assert.NoError(t, err)
+	assert.True(t, b.IsLazy())
+
+	b.Insert(Loc{0, 1}, "changed ")
+	assert.NoError(t, b.Save())
+	assert.False(t, b.IsLazy())
+
+	data, err := ioutil.ReadFile(name)
+	assert.NoError(t, err)
+	want := strings.Replace(text, "\nthe", "\nchanged the", 1)
+	assert.Equal(t, want, string(data))
+
+	b.Close()
+}
@@ -0,0 +1,89 @@
+package buffer
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"unicode/utf8"
+
+	"github.com/zyedidia/micro/internal/config"
+	"github.com/zyedidia/micro/internal/util"
+)
+
+// LooksBinary returns whether the file at path, which may end with
+// :line:col, seems to be a binary file rather than text because its first
+// `binarycheck` bytes contain a NUL byte or are not valid UTF-8
+// Files that are decompressed or decrypted when they are opened, and all
+// files when the encoding is not UTF-8, are never considered binary
+func LooksBinary(path string, btype BufType) bool {
+	size, _ := config.GetGlobalOption("binarycheck").(float64)
+	if size <= 0 || btype != BTDefault {
+		return false
+	}
+	if enc, _ := config.GetGlobalOption("encoding").(string); enc != "" && enc != "utf-8" && enc != "utf8" {
+		return false
+	}
+	if GetBufferType(path, BTDefault) != BTDefault {
+		return false
+	}
+
+	filename, _ := util.GetPathAndCursorPosition(path)
+	filename, err := util.ReplaceHome(filename)
+	if err != nil {
+		return false
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	sample := make([]byte, int(size))
+	n, err := io.ReadFull(file, sample)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return false
+	}
+	sample = sample[:n]
+	if bytes.IndexByte(sample, 0) >= 0 {
+		return true
+	}
+
+	// a full sample may end in the middle of a character
+	if err == nil {
+		for i := n - 1; i >= 0 && i >= n-utf8.UTFMax; i-- {
+			if utf8.RuneStart(sample[i]) {
+				if !utf8.FullRune(sample[i:]) {
+					sample = sample[:i]
+				}
+				break
+			}
+		}
+	}
+	return !utf8.Valid(sample)
+}
+
+// OpenBinary applies the binaryfile option to the file at path: it calls
+// open with whether the buffer must be made readonly, unless the file looks
+// binary and should not be opened
+// When binaryfile is ask, ask is called with the question for the user,
+// without the choices, and with the function to call with the answer, which
+// may be called once the user has answered
+func OpenBinary(path string, btype BufType, ask func(question string, answer func(yes bool)), open func(readonly bool)) {
+	if !LooksBinary(path, btype) {
+		open(false)
+		return
+	}
+
+	switch config.GetGlobalOption("binaryfile") {
+	case "ask":
+		ask(path+" looks like a binary file. Open it anyway?", func(yes bool) {
+			if yes {
+				open(false)
+			}
+		})
+	case "readonly":
+		open(true)
+	default:
+		open(false)
+	}
+}
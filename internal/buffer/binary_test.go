@@ -0,0 +1,94 @@
+package buffer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zyedidia/micro/internal/config"
+)
+
+func TestLooksBinary(t *testing.T) {
+	globals := config.GlobalSettings
+	config.GlobalSettings = map[string]interface{}{"binarycheck": float64(8), "encoding": "utf-8"}
+	defer func() { config.GlobalSettings = globals }()
+
+	dir, err := ioutil.TempDir("", "micro-binary")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, ioutil.WriteFile(path, []byte(data), 0644))
+		return path
+	}
+
+	text := write("text.txt", "plain text that is long")
+	assert.False(t, LooksBinary(text, BTDefault))
+	assert.False(t, LooksBinary(text+":3:1", BTDefault))
+	assert.False(t, LooksBinary(filepath.Join(dir, "missing"), BTDefault))
+
+	// ä is cut in half by the end of the sample
+	assert.False(t, LooksBinary(write("cut.txt", "abcdefgä more"), BTDefault))
+	assert.True(t, LooksBinary(write("nul.bin", "ab\x00cd"), BTDefault))
+	assert.True(t, LooksBinary(write("latin1.txt", "caf\xe9"), BTDefault))
+	// NUL bytes after the sample are not looked at
+	assert.False(t, LooksBinary(write("late.bin", "abcdefghij\x00"), BTDefault))
+	assert.False(t, LooksBinary(write("data.gz", "\x1f\x8b\x00"), BTDefault))
+
+	config.GlobalSettings["binarycheck"] = float64(0)
+	assert.False(t, LooksBinary(filepath.Join(dir, "nul.bin"), BTDefault))
+}
+
+func TestOpenBinary(t *testing.T) {
+	globals := config.GlobalSettings
+	config.GlobalSettings = map[string]interface{}{"binarycheck": float64(8), "encoding": "utf-8"}
+	defer func() { config.GlobalSettings = globals }()
+
+	dir, err := ioutil.TempDir("", "micro-binary")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	bin := filepath.Join(dir, "nul.bin")
+	assert.NoError(t, ioutil.WriteFile(bin, []byte("ab\x00cd"), 0644))
+	text := filepath.Join(dir, "text.txt")
+	assert.NoError(t, ioutil.WriteFile(text, []byte("text"), 0644))
+
+	// open returns whether the file was opened and readonly, ask answers
+	// with yes
+	open := func(path, policy string, yes bool) (bool, bool, bool) {
+		config.GlobalSettings["binaryfile"] = policy
+		asked, opened, readonly := false, false, false
+		OpenBinary(path, BTDefault, func(question string, answer func(bool)) {
+			asked = true
+			answer(yes)
+		}, func(ro bool) {
+			opened, readonly = true, ro
+		})
+		return asked, opened, readonly
+	}
+
+	asked, opened, readonly := open(text, "ask", false)
+	assert.False(t, asked)
+	assert.True(t, opened)
+	assert.False(t, readonly)
+
+	asked, opened, _ = open(bin, "ask", false)
+	assert.True(t, asked)
+	assert.False(t, opened)
+	asked, opened, readonly = open(bin, "ask", true)
+	assert.True(t, asked)
+	assert.True(t, opened)
+	assert.False(t, readonly)
+
+	asked, opened, readonly = open(bin, "readonly", false)
+	assert.False(t, asked)
+	assert.True(t, opened)
+	assert.True(t, readonly)
+
+	asked, opened, readonly = open(bin, "open", false)
+	assert.False(t, asked)
+	assert.True(t, opened)
+	assert.False(t, readonly)
+}
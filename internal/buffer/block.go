@@ -0,0 +1,102 @@
+package buffer
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/zyedidia/micro/internal/util"
+)
+
+// visualColumn returns the display column of loc, with tabs expanded
+func (b *Buffer) visualColumn(loc Loc) int {
+	l := b.LineBytes(loc.Y)
+	x := util.Clamp(loc.X, 0, utf8.RuneCount(l))
+	return util.StringWidth(l, x, util.IntOpt(b.Settings["tabsize"]))
+}
+
+// columnLoc returns the character position of display column col on line
+// y and, if the line is shorter than that, the number of spaces that are
+// missing to reach it
+func (b *Buffer) columnLoc(y, col int) (int, int) {
+	l := b.LineBytes(y)
+	tabsize := util.IntOpt(b.Settings["tabsize"])
+	n := utf8.RuneCount(l)
+	if w := util.StringWidth(l, n, tabsize); w <= col {
+		return n, col - w
+	}
+	return util.GetCharPosInLine(l, col, tabsize), 0
+}
+
+// BlockInsert inserts text at the display column of start on every line
+// from start to end as a single undoable edit
+// Lines that are too short are padded with spaces up to the column, and
+// text must not contain a newline
+// It returns the location just after the inserted text on each line, from
+// the first line to the last
+func (b *Buffer) BlockInsert(start, end Loc, text string) []Loc {
+	if strings.ContainsRune(text, '\n') {
+		return nil
+	}
+	if start.Y > end.Y {
+		start, end = end, start
+	}
+	col := b.visualColumn(start)
+	n := utf8.RuneCountInString(text)
+
+	locs := make([]Loc, end.Y-start.Y+1)
+	deltas := make([]Delta, 0, len(locs))
+	for y := end.Y; y >= start.Y; y-- {
+		x, pad := b.columnLoc(y, col)
+		locs[y-start.Y] = Loc{x + pad + n, y}
+		deltas = append(deltas, Delta{[]byte(util.Spaces(pad) + text), Loc{x, y}, Loc{x, y}})
+	}
+	b.MultipleReplace(deltas)
+	return locs
+}
+
+// BlockDelete removes the rectangle between the display columns of start
+// and end on every line from start to end as a single undoable edit
+// Lines that end before the rectangle are left alone and lines that end
+// inside it are cut at its left edge
+// It returns the location of the left edge on each line, from the first
+// line to the last
+func (b *Buffer) BlockDelete(start, end Loc) []Loc {
+	if start.Y > end.Y {
+		start, end = end, start
+	}
+	left, right := b.visualColumn(start), b.visualColumn(end)
+	if left > right {
+		left, right = right, left
+	}
+
+	locs := make([]Loc, end.Y-start.Y+1)
+	var deltas []Delta
+	for y := end.Y; y >= start.Y; y-- {
+		x1, pad := b.columnLoc(y, left)
+		x2, _ := b.columnLoc(y, right)
+		locs[y-start.Y] = Loc{x1, y}
+		if pad == 0 && x2 > x1 {
+			deltas = append(deltas, Delta{nil, Loc{x1, y}, Loc{x2, y}})
+		}
+	}
+	if len(deltas) > 0 {
+		b.MultipleReplace(deltas)
+	}
+	return locs
+}
+
+// SetBlockCursors replaces the cursors of the buffer with one cursor at
+// each of the given locations, which can come from BlockInsert or
+// BlockDelete, so that editing continues on every line of the block
+func (b *Buffer) SetBlockCursors(locs []Loc) {
+	if len(locs) == 0 {
+		return
+	}
+	b.ClearCursors()
+	c := b.GetActiveCursor()
+	c.GotoLoc(locs[0])
+	for _, l := range locs[1:] {
+		b.AddCursor(NewCursor(b, l))
+	}
+	b.MergeCursors()
+}
@@ -0,0 +1,42 @@
+package buffer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlockInsert(t *testing.T) {
+	b := NewBufferFromString("name  age\nalice 30\nbob\n\tx", "", BTDefault)
+	b.Settings["tabsize"] = float64(4)
+
+	locs := b.BlockInsert(Loc{6, 0}, Loc{0, 3}, "| ")
+	// the short line is padded, and the tab counts as four columns
+	assert.Equal(t, "name  | age\nalice | 30\nbob   | \n\tx | ", string(b.Bytes()))
+	assert.Equal(t, []Loc{{8, 0}, {8, 1}, {8, 2}, {5, 3}}, locs)
+
+	b.UndoOneEvent()
+	assert.Equal(t, "name  age\nalice 30\nbob\n\tx", string(b.Bytes()))
+
+	// newlines cannot be inserted in a block
+	assert.Nil(t, b.BlockInsert(Loc{0, 0}, Loc{0, 1}, "a\nb"))
+
+	b.Close()
+}
+
+func TestBlockDelete(t *testing.T) {
+	b := NewBufferFromString("name  | age\nalice | 30\nbob\nx     | y", "", BTDefault)
+
+	locs := b.BlockDelete(Loc{6, 0}, Loc{8, 3})
+	assert.Equal(t, "name  age\nalice 30\nbob\nx     y", string(b.Bytes()))
+	assert.Equal(t, []Loc{{6, 0}, {6, 1}, {3, 2}, {6, 3}}, locs)
+
+	b.SetBlockCursors(locs)
+	assert.Equal(t, 4, len(b.GetCursors()))
+	assert.Equal(t, Loc{6, 0}, b.GetActiveCursor().Loc)
+
+	b.UndoOneEvent()
+	assert.Equal(t, "name  | age\nalice | 30\nbob\nx     | y", string(b.Bytes()))
+
+	b.Close()
+}
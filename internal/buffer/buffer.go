@@ -5,12 +5,14 @@ import (
 	"bytes"
 	"crypto/md5"
 	"errors"
-	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"path"
 	"path/filepath"
+	"regexp"
+	"runtime"
 	"strconv"
 	"strings"
 	"sync"
@@ -23,6 +25,7 @@ import (
 	"github.com/zyedidia/micro/internal/config"
 	"github.com/zyedidia/micro/internal/encoding"
 	ulua "github.com/zyedidia/micro/internal/lua"
+	"github.com/zyedidia/micro/internal/remote"
 	"github.com/zyedidia/micro/internal/screen"
 	"github.com/zyedidia/micro/internal/util"
 	"github.com/zyedidia/micro/pkg/highlight"
@@ -71,6 +74,10 @@ var (
 	BTGPG = BufType{8, false, false, true}
 	// BTGZIP gzip encoded file extension
 	BTGZIP = BufType{9, false, false, true}
+	// BTBZIP2 bzip2 compressed file, which can only be read
+	BTBZIP2 = BufType{10, true, false, true}
+	// BTXZ xz compressed file, which can only be read
+	BTXZ = BufType{11, true, false, true}
 
 	// ErrFileTooLarge is returned when the file is too large to hash
 	// (fastdirty is automatically enabled)
@@ -84,9 +91,15 @@ const (
 	ExtensionGPG = "gpg"
 	// ExtensionGZIP gzip encoded file
 	ExtensionGZIP = "gz"
+	// ExtensionBZIP2 bzip2 compressed file
+	ExtensionBZIP2 = "bz2"
+	// ExtensionXZ xz compressed file
+	ExtensionXZ = "xz"
 )
 
 // GetBufferType gets the buffer type
+// Encryption comes first so that a compressed and encrypted file, such as
+// notes.txt.gz.gpg, asks for its password
 func GetBufferType(filename string, bufType BufType) BufType {
 	parts := strings.Split(filename, ".")
 	if len(parts) > 1 {
@@ -96,8 +109,16 @@ func GetBufferType(filename string, bufType BufType) BufType {
 				return BTArmorGPG
 			case ExtensionGPG:
 				return BTGPG
+			}
+		}
+		for _, part := range parts[1:] {
+			switch part {
 			case ExtensionGZIP:
 				return BTGZIP
+			case ExtensionBZIP2:
+				return BTBZIP2
+			case ExtensionXZ:
+				return BTXZ
 			}
 		}
 	}
@@ -110,6 +131,8 @@ type SharedBuffer struct {
 	*LineArray
 	// Stores the last modification time of the file the buffer is pointing to
 	ModTime time.Time
+	// whether the file existed when ModTime was last updated
+	onDisk bool
 	// Type of the buffer (e.g. help, raw, scratch etc..)
 	Type BufType
 
@@ -124,6 +147,8 @@ type SharedBuffer struct {
 
 	// Settings customized by the user
 	Settings map[string]interface{}
+	// Options that were set with SetOptionNative since the buffer opened
+	setOptions map[string]bool
 
 	Suggestions   []string
 	Completions   []string
@@ -158,27 +183,52 @@ type SharedBuffer struct {
 
 	ModifiedThisFrame bool
 
+	// Line ranges that cannot be edited, see ProtectRange
+	protected []lineRange
+
 	// Hash of the original buffer -- empty if fastdirty is on
 	origHash [md5.Size]byte
+	// edits counts the changes to the text and sizeDelta is how much
+	// longer they made it since origHash was calculated, so that Modified
+	// only hashes the buffer when it may be back to the original text
+	edits     uint64
+	sizeDelta int
+	// the value of edits when the buffer was last compared to origHash,
+	// and whether it was different
+	hashedEdits  uint64
+	hashModified bool
+	// Hash of the syntax file that SyntaxDef was parsed from, so that the
+	// buffer is only highlighted from scratch when the rules change
+	syntaxHash [md5.Size]byte
 }
 
 func (b *SharedBuffer) insert(pos Loc, value []byte) {
 	b.isModified = true
+	b.edits++
+	b.sizeDelta += len(value)
 	b.HasSuggestions = false
 	b.LineArray.insert(pos, value)
 
 	inslines := bytes.Count(value, []byte{'\n'})
+	b.shiftProtected(pos.Y, inslines)
 	b.MarkModified(pos.Y, pos.Y+inslines)
 }
 func (b *SharedBuffer) remove(start, end Loc) []byte {
 	b.isModified = true
 	b.HasSuggestions = false
 	defer b.MarkModified(start.Y, end.Y)
-	return b.LineArray.remove(start, end)
+	b.shiftProtected(end.Y, start.Y-end.Y)
+	removed := b.LineArray.remove(start, end)
+	b.edits++
+	b.sizeDelta -= len(removed)
+	return removed
 }
 
 // MarkModified marks the buffer as modified for this frame
 // and performs rehighlighting if syntax highlighting is enabled
+// The lines from start to end are marked dirty and only they are
+// highlighted again, along with the lines below them until the states
+// stop changing
 func (b *SharedBuffer) MarkModified(start, end int) {
 	b.ModifiedThisFrame = true
 
@@ -186,14 +236,15 @@ func (b *SharedBuffer) MarkModified(start, end int) {
 		return
 	}
 
-	start = util.Clamp(start, 0, len(b.lines))
-	end = util.Clamp(end, 0, len(b.lines))
+	start = util.Clamp(start, 0, len(b.lines)-1)
+	end = util.Clamp(end, 0, len(b.lines)-1)
 
-	l := -1
 	for i := start; i <= end; i++ {
-		l = util.Max(b.Highlighter.ReHighlightStates(b, i), l)
+		b.SetRehighlight(i, true)
+	}
+	if first, last := b.Highlighter.ReHighlightDirty(b, start, end); first >= 0 {
+		b.Highlighter.HighlightMatches(b, first, last+1)
 	}
-	b.Highlighter.HighlightMatches(b, start, l+1)
 }
 
 // DisableReload disables future reloads of this sharedbuffer
@@ -224,13 +275,43 @@ type Buffer struct {
 	cursors     []*Cursor
 	curCursor   int
 	StartCursor Loc
+	// the other cursors restored from the serialized buffer, which are
+	// added after the cursor at StartCursor
+	savedCursors []Loc
+
+	// first visible line of the view, see SavedTopLine
+	topLine int
+
+	// the serialized buffer state read while the buffer is created, whose
+	// highlight states UpdateRules uses if they are still valid
+	serialized *SerializedBuffer
+
+	// whether an edit was ignored because the buffer is readonly, see
+	// RefusedEdit
+	refusedEdit bool
+
+	// whether the onBufferEdit callbacks are running, see editHook
+	inEditHook bool
 }
 
 // NewBufferFromFile opens a new buffer using the given path
 // It will also automatically handle `~`, and line/column with filename:l:c
 // It will return an empty buffer if the path does not exist
-// and an error if the file is a directory
+// and an error if the file is a directory or cannot be read
+// because of missing permissions
 func NewBufferFromFile(path string, btype BufType, passwords []screen.Password) (*Buffer, error) {
+	return newBufferFromFile(path, btype, passwords, false)
+}
+
+// NewBufferFromFileWithSudo is the same as NewBufferFromFile except that
+// a file the user does not have permission to read is read using the
+// super user command (the `sucmd` option) instead
+// Such a buffer is opened read-only
+func NewBufferFromFileWithSudo(path string, btype BufType, passwords []screen.Password) (*Buffer, error) {
+	return newBufferFromFile(path, btype, passwords, true)
+}
+
+func newBufferFromFile(path string, btype BufType, passwords []screen.Password, withSudo bool) (*Buffer, error) {
 	var err error
 	filename, cursorPos := util.GetPathAndCursorPosition(path)
 	filename, err = util.ReplaceHome(filename)
@@ -238,19 +319,42 @@ func NewBufferFromFile(path string, btype BufType, passwords []screen.Password)
 		return nil, err
 	}
 
-	file, err := os.Open(filename)
-	fileInfo, _ := os.Stat(filename)
+	fs := fsFor(filename)
+	file, err := fs.Open(filename)
+	if err == nil {
+		defer file.Close()
+	}
+	fileInfo, _ := fs.Stat(filename)
 
-	if err == nil && fileInfo.IsDir() {
+	if fileInfo != nil && fileInfo.IsDir() {
 		return nil, errors.New("Error: " + filename + " is a directory and cannot be opened")
 	}
-
-	defer file.Close()
+	// a remote file that cannot be read for another reason than not
+	// existing, such as a failed login, must not look like a new file
+	if err != nil && remote.IsRemote(filename) && !os.IsNotExist(err) && !os.IsPermission(err) {
+		return nil, err
+	}
+	writable := err != nil || isWritable(filename)
 
 	var reader io.Reader = file
 	var size int64
+
+	readWithSudo, permErr := checkReadPermission(err, withSudo && !remote.IsRemote(filename))
+	if permErr != nil {
+		return nil, permErr
+	}
+	if readWithSudo {
+		var data []byte
+		data, err = readFileWithSudo(filename)
+		if err != nil {
+			return nil, err
+		}
+		reader, size = bytes.NewReader(data), int64(len(data))
+	} else if err == nil && fileInfo != nil {
+		size = fileInfo.Size()
+	}
+
 	if err == nil {
-		size = util.FSize(file)
 		if (btype == BTArmorGPG || btype == BTGPG) && len(passwords) == 1 {
 			buffer := bytes.Buffer{}
 			settings := map[string]interface{}{
@@ -264,7 +368,12 @@ func NewBufferFromFile(path string, btype BufType, passwords []screen.Password)
 					reader, size = &buffer, int64(buffer.Len())
 				}
 			}
-		} else if btype == BTGZIP {
+			// a wrong password or a corrupt file must not open as an empty
+			// buffer either
+			if err != nil {
+				return nil, errors.New("Error: cannot decrypt " + filename + ": " + err.Error())
+			}
+		} else if btype == BTGZIP || btype == BTBZIP2 || btype == BTXZ {
 			buffer := bytes.Buffer{}
 			settings := map[string]interface{}{
 				"size": size,
@@ -276,6 +385,11 @@ func NewBufferFromFile(path string, btype BufType, passwords []screen.Password)
 					reader, size = &buffer, int64(buffer.Len())
 				}
 			}
+			// a file that fails to decompress is an error rather than an
+			// empty buffer, which saving would write over it
+			if err != nil {
+				return nil, errors.New("Error: cannot decompress " + filename + ": " + err.Error())
+			}
 		}
 	}
 
@@ -297,9 +411,72 @@ func NewBufferFromFile(path string, btype BufType, passwords []screen.Password)
 		buf.Settings["passwordPrompted"] = passwords[0].Prompted
 	}
 
+	if readWithSudo || !writable {
+		// Saving this buffer requires sudo as well, so make sure the user
+		// explicitly turns off readonly before editing it
+		buf.SetOptionNative("readonly", true)
+	}
+
 	return buf, nil
 }
 
+// checkReadPermission decides how to handle the error returned when
+// opening a file for reading
+// It returns true if the file exists but can only be read with sudo and
+// withSudo is set
+// A permission error is returned as is if reading with sudo is not allowed
+// so that it is not masked by an empty buffer
+func checkReadPermission(err error, withSudo bool) (bool, error) {
+	if err == nil || !os.IsPermission(err) {
+		return false, nil
+	}
+	if !withSudo {
+		return false, err
+	}
+	return true, nil
+}
+
+// isWritable returns whether the current user may write to the given
+// file, which is checked without changing it
+// Remote files count as writable, and saving them reports the error if not
+func isWritable(filename string) bool {
+	if remote.IsRemote(filename) {
+		return true
+	}
+	file, err := os.OpenFile(filename, os.O_WRONLY, 0)
+	if err != nil {
+		return !os.IsPermission(err)
+	}
+	file.Close()
+	return true
+}
+
+// readFileWithSudo reads the contents of the given file using the
+// super user command
+func readFileWithSudo(filename string) ([]byte, error) {
+	if runtime.GOOS == "windows" {
+		return nil, errors.New("Read with sudo not supported on Windows")
+	}
+
+	var out, stderr bytes.Buffer
+	cmd := exec.Command(config.GlobalSettings["sucmd"].(string), "cat", filename)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+
+	screenb := screen.TempFini()
+	err := cmd.Run()
+	screen.TempStart(screenb)
+
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, errors.New(msg)
+		}
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
 // NewBufferFromString creates a new buffer containing the given string
 func NewBufferFromString(text, path string, btype BufType) *Buffer {
 	return NewBuffer(strings.NewReader(text), int64(len(text)), path, Loc{-1, -1}, btype)
@@ -311,7 +488,7 @@ func NewBufferFromString(text, path string, btype BufType) *Buffer {
 // Places the cursor at startcursor. If startcursor is -1, -1 places the
 // cursor at an autodetected location (based on savecursor or :LINE:COL)
 func NewBuffer(r io.Reader, size int64, path string, startcursor Loc, btype BufType) *Buffer {
-	absPath, _ := filepath.Abs(path)
+	absPath := absolutePath(path)
 
 	b := new(Buffer)
 
@@ -351,8 +528,10 @@ func NewBuffer(r io.Reader, size int64, path string, startcursor Loc, btype BufT
 		hasBackup := b.ApplyBackup(size)
 
 		if !hasBackup {
-			reader := bufio.NewReader(transform.NewReader(r, enc.NewDecoder()))
-			b.LineArray = NewLineArray(uint64(size), FFAuto, reader)
+			if b.LineArray = b.openLazy(r, size); b.LineArray == nil {
+				reader := bufio.NewReader(transform.NewReader(r, enc.NewDecoder()))
+				b.LineArray = NewLineArray(uint64(size), FFAuto, reader)
+			}
 		}
 		b.EventHandler = NewEventHandler(b.SharedBuffer, b.cursors)
 
@@ -371,6 +550,12 @@ func NewBuffer(r io.Reader, size int64, path string, startcursor Loc, btype BufT
 		b.Settings["fileformat"] = "dos"
 	}
 
+	// the saved state is read before the syntax rules are set so that the
+	// highlight states saved with it can be used instead of computing them
+	var serializedErr error
+	if startcursor.X == -1 || startcursor.Y == -1 {
+		b.serialized, serializedErr = b.readSerialized()
+	}
 	b.UpdateRules()
 	// init local settings again now that we know the filetype
 	config.InitLocalSettings(b.Settings, b.Path)
@@ -383,22 +568,26 @@ func NewBuffer(r io.Reader, size int64, path string, startcursor Loc, btype BufT
 		b.StartCursor = startcursor
 	} else {
 		if b.Settings["savecursor"].(bool) || b.Settings["saveundo"].(bool) {
-			err := b.Unserialize()
-			if err != nil {
-				screen.TermMessage(err)
+			if serializedErr != nil {
+				screen.TermMessage(serializedErr)
+			}
+			if b.serialized != nil {
+				b.applySerialized(b.serialized)
 			}
 		}
 	}
+	b.serialized = nil
 
 	b.AddCursor(NewCursor(b, b.StartCursor))
 	b.GetActiveCursor().Relocate()
+	b.restoreCursors()
 
 	if !b.Settings["fastdirty"].(bool) && !found {
-		if size > LargeFileThreshold {
-			// If the file is larger than LargeFileThreshold fastdirty needs to be on
+		if size > int64(largeFileThreshold()) {
+			// If the file is larger than largefilethreshold fastdirty needs to be on
 			b.Settings["fastdirty"] = true
 		} else {
-			calcHash(b, &b.origHash)
+			b.updateOrigHash()
 		}
 	}
 
@@ -414,9 +603,20 @@ func NewBuffer(r io.Reader, size int64, path string, startcursor Loc, btype BufT
 
 // Close removes this buffer from the list of open buffers
 func (b *Buffer) Close() {
+	b.close(true)
+}
+
+// Discard removes this buffer from the list of open buffers like Close,
+// but without saving its cursor and undo history, for closing it without
+// keeping its changes
+func (b *Buffer) Discard() {
+	b.close(false)
+}
+
+func (b *Buffer) close(serialize bool) {
 	for i, buf := range OpenBuffers {
 		if b == buf {
-			b.Fini()
+			b.fini(serialize)
 			copy(OpenBuffers[i:], OpenBuffers[i+1:])
 			OpenBuffers[len(OpenBuffers)-1] = nil
 			OpenBuffers = OpenBuffers[:len(OpenBuffers)-1]
@@ -428,13 +628,21 @@ func (b *Buffer) Close() {
 // Fini should be called when a buffer is closed and performs
 // some cleanup
 func (b *Buffer) Fini() {
-	if !b.Modified() {
+	b.fini(true)
+}
+
+func (b *Buffer) fini(serialize bool) {
+	if serialize && !b.Modified() {
 		b.Serialize()
 	}
 	b.RemoveBackup()
 
+	if b.IsLazy() && !b.SharedWithOpenBuffer() {
+		b.closeSource()
+	}
+
 	if b.Type == BTStdout {
-		fmt.Fprint(util.Stdout, string(b.Bytes()))
+		b.WriteTo(util.Stdout)
 	}
 }
 
@@ -448,12 +656,44 @@ func (b *Buffer) GetName() string {
 		}
 		name = b.Path
 	}
+	// buffers without a file, such as help pages, keep their name, since
+	// their AbsPath is the working directory
+	if b.Settings["abspath"].(bool) && b.Path != "" {
+		name = b.AbsPath
+	}
 	if b.Settings["basename"].(bool) {
 		return path.Base(name)
 	}
 	return name
 }
 
+var nameDirective = regexp.MustCompile(`\$\((name|modified|readonly)\)`)
+
+// StatusName returns the name of the buffer decorated as the nameformat
+// option says, for the statusline and tabbar
+// In the format, $(name) stands for GetName, $(modified) for "+ " if the
+// buffer is modified and $(readonly) for "[ro] " if it is readonly, the
+// markers of the statusline, and trailing spaces are removed
+func (b *Buffer) StatusName() string {
+	format, _ := b.Settings["nameformat"].(string)
+	name := nameDirective.ReplaceAllStringFunc(format, func(d string) string {
+		switch d {
+		case "$(name)":
+			return b.GetName()
+		case "$(modified)":
+			if b.Modified() {
+				return "+ "
+			}
+		case "$(readonly)":
+			if b.Type.Readonly {
+				return "[ro] "
+			}
+		}
+		return ""
+	})
+	return strings.TrimRight(name, " ")
+}
+
 //SetName changes the name for this buffer
 func (b *Buffer) SetName(s string) {
 	b.name = s
@@ -464,21 +704,88 @@ func (b *Buffer) Insert(start Loc, text string) {
 	if !b.Type.Readonly {
 		b.EventHandler.cursors = b.cursors
 		b.EventHandler.active = b.curCursor
+		start = clamp(start, b.LineArray)
 		b.EventHandler.Insert(start, text)
 
 		go b.Backup(true)
+		b.editHook()
+	} else {
+		b.refusedEdit = true
 	}
 }
 
 // Remove removes the characters between the start and end locations
 func (b *Buffer) Remove(start, end Loc) {
+	b.remove(start, end, false)
+}
+
+// RemoveBackward removes the characters between the start and end
+// locations like Remove, for removals made with the cursor after them such
+// as backspace, which RepeatLastEdit repeats before the cursor
+func (b *Buffer) RemoveBackward(start, end Loc) {
+	b.remove(start, end, true)
+}
+
+func (b *Buffer) remove(start, end Loc, backward bool) {
 	if !b.Type.Readonly {
 		b.EventHandler.cursors = b.cursors
 		b.EventHandler.active = b.curCursor
-		b.EventHandler.Remove(start, end)
+		start, end = clamp(start, b.LineArray), clamp(end, b.LineArray)
+		if end.LessThan(start) {
+			start, end = end, start
+		}
+		if backward {
+			b.EventHandler.RemoveBackward(start, end)
+		} else {
+			b.EventHandler.Remove(start, end)
+		}
 
 		go b.Backup(true)
+		b.editHook()
+	} else {
+		b.refusedEdit = true
+	}
+}
+
+// ReplaceRange replaces the characters between the start and end locations
+// with text as a single undoable edit
+// It returns the location just after the new text, which callers can use
+// to place cursors, or end if nothing was replaced
+func (b *Buffer) ReplaceRange(start, end Loc, text string) Loc {
+	if b.Type.Readonly {
+		b.refusedEdit = true
+		return end
+	}
+	b.EventHandler.cursors = b.cursors
+	b.EventHandler.active = b.curCursor
+	start, end = clamp(start, b.LineArray), clamp(end, b.LineArray)
+	if end.LessThan(start) {
+		start, end = end, start
+	}
+	newEnd := b.EventHandler.ReplaceRange(start, end, text)
+
+	go b.Backup(true)
+	b.editHook()
+	return newEnd
+}
+
+// MultipleReplace replaces the text of the deltas as a single undoable
+// edit unless the buffer is readonly, see EventHandler.MultipleReplace
+func (b *Buffer) MultipleReplace(deltas []Delta) {
+	if b.Type.Readonly {
+		b.refusedEdit = true
+		return
 	}
+	b.EventHandler.MultipleReplace(deltas)
+	b.editHook()
+}
+
+// RefusedEdit returns whether an edit was ignored because the buffer is
+// readonly since the last call, so that the user can be told about it
+func (b *Buffer) RefusedEdit() bool {
+	refused := b.refusedEdit
+	b.refusedEdit = false
+	return refused
 }
 
 // FileType returns the buffer's filetype
@@ -486,28 +793,45 @@ func (b *Buffer) FileType() string {
 	return b.Settings["filetype"].(string)
 }
 
+// FileFormat returns the line endings that the buffer uses and is saved
+// with, "unix" or "dos"
+func (b *Buffer) FileFormat() string {
+	return b.Settings["fileformat"].(string)
+}
+
+// EndsWithNewline returns whether the text of the buffer ends with a
+// newline, which is when its last line is empty
+// The eofnewline option may still add one when the buffer is saved
+func (b *Buffer) EndsWithNewline() bool {
+	n := b.LinesNum()
+	return n > 1 && len(b.LineBytes(n-1)) == 0
+}
+
 // ExternallyModified returns whether the file being edited has
 // been modified by some external process
+// ExternalChange tells how it was modified
 func (b *Buffer) ExternallyModified() bool {
-	modTime, err := util.GetModTime(b.Path)
-	if err == nil {
-		return modTime != b.ModTime
-	}
-	return false
+	return b.ExternalChange() != ChangeNone
 }
 
 // UpdateModTime updates the modtime of this file
 func (b *Buffer) UpdateModTime() (err error) {
-	b.ModTime, err = util.GetModTime(b.Path)
+	b.ModTime, err = modTime(b.Path)
+	b.onDisk = err == nil
 	return
 }
 
 // ReOpen reloads the current buffer from disk
 func (b *Buffer) ReOpen() error {
-	file, err := os.Open(b.Path)
+	file, err := fsFor(b.Path).Open(b.Path)
 	if err != nil {
 		return err
 	}
+	defer file.Close()
+
+	if f, ok := file.(*os.File); ok && b.IsLazy() {
+		return b.reopenLazy(f)
+	}
 
 	enc, err := htmlindex.Get(b.Settings["encoding"].(string))
 	if err != nil {
@@ -525,9 +849,10 @@ func (b *Buffer) ReOpen() error {
 
 	err = b.UpdateModTime()
 	if !b.Settings["fastdirty"].(bool) {
-		calcHash(b, &b.origHash)
+		b.updateOrigHash()
 	}
 	b.isModified = false
+	b.clearDirty()
 	b.RelocateCursors()
 	return err
 }
@@ -568,10 +893,28 @@ func (b *Buffer) Modified() bool {
 		return b.isModified
 	}
 
-	var buff [md5.Size]byte
+	// text of a different length cannot be the original text, and the
+	// result of the last comparison holds until the next edit
+	if b.sizeDelta != 0 {
+		return true
+	}
+	if b.edits != b.hashedEdits {
+		var buff [md5.Size]byte
+		calcHash(b, &buff)
+		b.hashModified = buff != b.origHash
+		b.hashedEdits = b.edits
+	}
+	return b.hashModified
+}
 
-	calcHash(b, &buff)
-	return buff != b.origHash
+// updateOrigHash makes the current text the original text that Modified
+// compares the buffer to
+func (b *Buffer) updateOrigHash() error {
+	err := calcHash(b, &b.origHash)
+	b.sizeDelta = 0
+	b.hashedEdits = b.edits
+	b.hashModified = false
+	return err
 }
 
 // calcHash calculates md5 hash of all lines in the buffer
@@ -580,19 +923,19 @@ func calcHash(b *Buffer, out *[md5.Size]byte) error {
 
 	size := 0
 	if len(b.lines) > 0 {
-		n, e := h.Write(b.lines[0].data)
+		n, e := h.Write(b.peek(0))
 		if e != nil {
 			return e
 		}
 		size += n
 
-		for _, l := range b.lines[1:] {
+		for i := 1; i < len(b.lines); i++ {
 			n, e = h.Write([]byte{'\n'})
 			if e != nil {
 				return e
 			}
 			size += n
-			n, e = h.Write(l.data)
+			n, e = h.Write(b.peek(i))
 			if e != nil {
 				return e
 			}
@@ -600,7 +943,7 @@ func calcHash(b *Buffer, out *[md5.Size]byte) error {
 		}
 	}
 
-	if size > LargeFileThreshold {
+	if size > largeFileThreshold() {
 		return ErrFileTooLarge
 	}
 
@@ -618,7 +961,9 @@ func (b *Buffer) UpdateRules() {
 	if ft == "off" {
 		return
 	}
+	oldDef := b.SyntaxDef
 	syntaxFile := ""
+	var syntaxData []byte
 	foundDef := false
 	var header *highlight.Header
 	// search for the syntax file in the user's custom syntax files
@@ -629,20 +974,21 @@ func (b *Buffer) UpdateRules() {
 			continue
 		}
 
-		header, err = highlight.MakeHeaderYaml(data)
-		file, err := highlight.ParseFile(data)
+		var file *highlight.File
+		header, file, err = parseSyntaxFile(f.Name(), data)
 		if err != nil {
 			screen.TermMessage("Error parsing syntax file " + f.Name() + ": " + err.Error())
 			continue
 		}
 
-		if ((ft == "unknown" || ft == "") && highlight.MatchFiletype(header.FtDetect, b.Path, b.lines[0].data)) || header.FileType == ft {
+		if ((ft == "unknown" || ft == "") && highlight.MatchFiletype(header.FtDetect, b.Path, b.LineBytes(0))) || header.FileType == ft {
 			syndef, err := highlight.ParseDef(file, header)
 			if err != nil {
 				screen.TermMessage("Error parsing syntax file " + f.Name() + ": " + err.Error())
 				continue
 			}
 			b.SyntaxDef = syndef
+			syntaxData = data
 			syntaxFile = f.Name()
 			foundDef = true
 			break
@@ -657,14 +1003,14 @@ func (b *Buffer) UpdateRules() {
 			continue
 		}
 
-		header, err = highlight.MakeHeader(data)
+		header, err = parseSyntaxHeader(f.Name(), data)
 		if err != nil {
 			screen.TermMessage("Error reading syntax header file", f.Name(), err)
 			continue
 		}
 
 		if ft == "unknown" || ft == "" {
-			if highlight.MatchFiletype(header.FtDetect, b.Path, b.lines[0].data) {
+			if highlight.MatchFiletype(header.FtDetect, b.Path, b.LineBytes(0)) {
 				syntaxFile = f.Name()
 				break
 			}
@@ -684,7 +1030,7 @@ func (b *Buffer) UpdateRules() {
 					continue
 				}
 
-				file, err := highlight.ParseFile(data)
+				_, file, err := parseSyntaxFile(f.Name(), data)
 				if err != nil {
 					screen.TermMessage("Error parsing syntax file " + f.Name() + ": " + err.Error())
 					continue
@@ -696,11 +1042,16 @@ func (b *Buffer) UpdateRules() {
 					continue
 				}
 				b.SyntaxDef = syndef
+				syntaxData = data
 				break
 			}
 		}
 	}
 
+	// the hash covers the syntax file and the files it includes
+	h := md5.New()
+	h.Write(syntaxData)
+
 	if b.SyntaxDef != nil && highlight.HasIncludes(b.SyntaxDef) {
 		includes := highlight.GetIncludes(b.SyntaxDef)
 
@@ -711,7 +1062,7 @@ func (b *Buffer) UpdateRules() {
 				screen.TermMessage("Error parsing syntax file " + f.Name() + ": " + err.Error())
 				continue
 			}
-			header, err := highlight.MakeHeaderYaml(data)
+			header, file, err := parseSyntaxFile(f.Name(), data)
 			if err != nil {
 				screen.TermMessage("Error parsing syntax file " + f.Name() + ": " + err.Error())
 				continue
@@ -719,12 +1070,8 @@ func (b *Buffer) UpdateRules() {
 
 			for _, i := range includes {
 				if header.FileType == i {
-					file, err := highlight.ParseFile(data)
-					if err != nil {
-						screen.TermMessage("Error parsing syntax file " + f.Name() + ": " + err.Error())
-						continue
-					}
 					files = append(files, file)
+					h.Write(data)
 					break
 				}
 			}
@@ -736,6 +1083,19 @@ func (b *Buffer) UpdateRules() {
 		highlight.ResolveIncludes(b.SyntaxDef, files)
 	}
 
+	var syntaxHash [md5.Size]byte
+	copy(syntaxHash[:], h.Sum(nil))
+
+	// Rules parsed from the same syntax files give the same highlighting, so
+	// the states of every line are still valid and the buffer does not
+	// need to be highlighted again, which is slow for large files
+	if syntaxData != nil && oldDef != nil && b.Highlighter != nil && syntaxHash == b.syntaxHash {
+		b.SyntaxDef = oldDef
+		b.Settings["filetype"] = oldDef.FileType
+		return
+	}
+	b.syntaxHash = syntaxHash
+
 	if b.Highlighter == nil || syntaxFile != "" {
 		if b.SyntaxDef != nil {
 			b.Settings["filetype"] = b.SyntaxDef.FileType
@@ -747,9 +1107,21 @@ func (b *Buffer) UpdateRules() {
 	if b.SyntaxDef != nil {
 		b.Highlighter = highlight.NewHighlighter(b.SyntaxDef)
 		if b.Settings["syntax"].(bool) {
+			// states saved with the buffer leave only the matches to find
+			restored := b.restoreSerializedStates()
+			// only the start of a file that is read lazily is highlighted,
+			// which would otherwise read in the whole file
+			var input highlight.LineStates = b
+			end := b.End().Y
+			if b.IsLazy() {
+				input = firstLines{b, lazyHighlightLines}
+				end = util.Min(end, lazyHighlightLines)
+			}
 			go func() {
-				b.Highlighter.HighlightStates(b)
-				b.Highlighter.HighlightMatches(b, 0, b.End().Y)
+				if !restored {
+					b.Highlighter.HighlightStates(input)
+				}
+				b.Highlighter.HighlightMatches(input, 0, end)
 				screen.Redraw()
 			}()
 		}
@@ -762,6 +1134,8 @@ func (b *Buffer) ClearMatches() {
 		b.SetMatch(i, nil)
 		b.SetState(i, nil)
 	}
+	// the next UpdateRules must highlight everything again
+	b.syntaxHash = [md5.Size]byte{}
 }
 
 // IndentString returns this buffer's indent method (a tabstop or n spaces
@@ -773,6 +1147,16 @@ func (b *Buffer) IndentString(tabsize int) string {
 	return "\t"
 }
 
+// indentOfWidth returns indentation that is the given number of columns
+// wide, made of tabs or spaces depending on the tabstospaces option
+func (b *Buffer) indentOfWidth(width int) string {
+	if b.Settings["tabstospaces"].(bool) {
+		return util.Spaces(width)
+	}
+	tabsize := util.IntOpt(b.Settings["tabsize"])
+	return strings.Repeat("\t", width/tabsize) + util.Spaces(width%tabsize)
+}
+
 // SetCursors resets this buffer's cursors to a new list
 func (b *Buffer) SetCursors(c []*Cursor) {
 	b.cursors = c
@@ -880,7 +1264,7 @@ func (b *Buffer) MoveLinesUp(start int, end int) {
 	if end == len(b.lines) {
 		b.Insert(
 			Loc{
-				utf8.RuneCount(b.lines[end-1].data),
+				utf8.RuneCount(b.LineBytes(end - 1)),
 				end - 1,
 			},
 			"\n"+l,
@@ -899,7 +1283,7 @@ func (b *Buffer) MoveLinesUp(start int, end int) {
 
 // MoveLinesDown moves the range of lines down one row
 func (b *Buffer) MoveLinesDown(start int, end int) {
-	if start < 0 || start >= end || end >= len(b.lines)-1 {
+	if start < 0 || start >= end || end >= len(b.lines) {
 		return
 	}
 	l := string(b.LineBytes(end))
@@ -908,10 +1292,50 @@ func (b *Buffer) MoveLinesDown(start int, end int) {
 		l+"\n",
 	)
 	end++
-	b.Remove(
-		Loc{0, end},
-		Loc{0, end + 1},
-	)
+	if end == len(b.lines)-1 {
+		// the last line has no newline after it, so the newline before it
+		// is removed instead
+		b.Remove(
+			Loc{
+				utf8.RuneCount(b.LineBytes(end - 1)),
+				end - 1,
+			},
+			Loc{
+				utf8.RuneCount(b.LineBytes(end)),
+				end,
+			},
+		)
+	} else {
+		b.Remove(
+			Loc{0, end},
+			Loc{0, end + 1},
+		)
+	}
+}
+
+// DuplicateLines inserts a copy of the lines from start to end (inclusive)
+// just below them as a single undoable edit
+// It returns the number of lines that were inserted
+func (b *Buffer) DuplicateLines(start, end int) int {
+	if start > end {
+		start, end = end, start
+	}
+	if start < 0 || end >= len(b.lines) {
+		return 0
+	}
+	if b.Type.Readonly {
+		b.refusedEdit = true
+		return 0
+	}
+
+	var text bytes.Buffer
+	for i := start; i <= end; i++ {
+		text.WriteByte('\n')
+		text.Write(b.LineBytes(i))
+	}
+	loc := Loc{utf8.RuneCount(b.LineBytes(end)), end}
+	b.MultipleReplace([]Delta{{text.Bytes(), loc, loc}})
+	return end - start + 1
 }
 
 var BracePairs = [][2]rune{
@@ -920,13 +1344,56 @@ var BracePairs = [][2]rune{
 	{'[', ']'},
 }
 
+// BracePairs returns the pairs of braces that are matched in this buffer,
+// which are set by the bracepairs option
+func (b *Buffer) BracePairs() [][2]rune {
+	pairs, _ := b.Settings["bracepairs"].(string)
+	runes := []rune(pairs)
+	if len(runes) == 0 || len(runes)%2 != 0 {
+		return BracePairs
+	}
+	bp := make([][2]rune, 0, len(runes)/2)
+	for i := 0; i < len(runes); i += 2 {
+		bp = append(bp, [2]rune{runes[i], runes[i+1]})
+	}
+	return bp
+}
+
+// nonCodeMask returns, for each rune of line y, whether the syntax
+// highlighting puts it inside a string or a comment
+// It returns nil if the line has not been highlighted
+func (b *Buffer) nonCodeMask(y int, groups map[highlight.Group]bool) []bool {
+	match := b.Match(y)
+	if len(match) == 0 {
+		return nil
+	}
+	n := utf8.RuneCount(b.LineBytes(y))
+	mask := make([]bool, n)
+	inside := false
+	for x := 0; x < n; x++ {
+		if g, ok := match[x]; ok {
+			nonCode, ok := groups[g]
+			if !ok {
+				name := g.String()
+				nonCode = strings.HasPrefix(name, "comment") || strings.HasPrefix(name, "constant.string")
+				groups[g] = nonCode
+			}
+			inside = nonCode
+		}
+		mask[x] = inside
+	}
+	return mask
+}
+
 // FindMatchingBrace returns the location in the buffer of the matching bracket
 // It is given a brace type containing the open and closing character, (for example
 // '{' and '}') as well as the location to match from
-// TODO: maybe can be more efficient with utf8 package
+// Braces inside strings and comments are skipped unless the brace being
+// matched is itself inside one, as far as the syntax highlighting knows
 // returns the location of the matching brace
-// if the boolean returned is true then the original matching brace is one character left
+// if the first boolean returned is true then the original matching brace is one character left
 // of the starting location
+// the second boolean is false if no matching brace was found
 func (b *Buffer) FindMatchingBrace(braceType [2]rune, start Loc) (Loc, bool, bool) {
 	curLine := []rune(string(b.LineBytes(start.Y)))
 	startChar := ' '
@@ -937,10 +1404,32 @@ func (b *Buffer) FindMatchingBrace(braceType [2]rune, start Loc) (Loc, bool, boo
 	if start.X-1 >= 0 && start.X-1 < len(curLine) {
 		leftChar = curLine[start.X-1]
 	}
+
+	groups := make(map[highlight.Group]bool)
+	// braceX is the position of the brace that is being matched
+	braceX := start.X
+	if startChar == braceType[0] || leftChar == braceType[0] {
+		if startChar != braceType[0] {
+			braceX = start.X - 1
+		}
+	} else if leftChar == braceType[1] {
+		braceX = start.X - 1
+	}
+	if mask := b.nonCodeMask(start.Y, groups); braceX >= 0 && braceX < len(mask) && mask[braceX] {
+		groups = nil
+	}
+	lineMask := func(y int) []bool {
+		if groups == nil {
+			return nil
+		}
+		return b.nonCodeMask(y, groups)
+	}
+
 	var i int
 	if startChar == braceType[0] || leftChar == braceType[0] {
 		for y := start.Y; y < b.LinesNum(); y++ {
 			l := []rune(string(b.LineBytes(y)))
+			mask := lineMask(y)
 			xInit := 0
 			if y == start.Y {
 				if startChar == braceType[0] {
@@ -950,6 +1439,9 @@ func (b *Buffer) FindMatchingBrace(braceType [2]rune, start Loc) (Loc, bool, boo
 				}
 			}
 			for x := xInit; x < len(l); x++ {
+				if x < len(mask) && mask[x] {
+					continue
+				}
 				r := l[x]
 				if r == braceType[0] {
 					i++
@@ -966,7 +1458,8 @@ func (b *Buffer) FindMatchingBrace(braceType [2]rune, start Loc) (Loc, bool, boo
 		}
 	} else if startChar == braceType[1] || leftChar == braceType[1] {
 		for y := start.Y; y >= 0; y-- {
-			l := []rune(string(b.lines[y].data))
+			l := []rune(string(b.LineBytes(y)))
+			mask := lineMask(y)
 			xInit := len(l) - 1
 			if y == start.Y {
 				if leftChar == braceType[1] {
@@ -976,6 +1469,9 @@ func (b *Buffer) FindMatchingBrace(braceType [2]rune, start Loc) (Loc, bool, boo
 				}
 			}
 			for x := xInit; x >= 0; x-- {
+				if x < len(mask) && mask[x] {
+					continue
+				}
 				r := l[x]
 				if r == braceType[0] {
 					i--
@@ -996,29 +1492,37 @@ func (b *Buffer) FindMatchingBrace(braceType [2]rune, start Loc) (Loc, bool, boo
 
 // Retab changes all tabs to spaces or vice versa
 func (b *Buffer) Retab() {
-	toSpaces := b.Settings["tabstospaces"].(bool)
-	tabsize := util.IntOpt(b.Settings["tabsize"])
-	dirty := false
+	b.RetabLines(0, b.LinesNum()-1)
+}
 
-	for i := 0; i < b.LinesNum(); i++ {
-		l := b.LineBytes(i)
+// RetabLines rewrites the leading whitespace of the lines from start to end
+// (inclusive) using tabs or spaces depending on the tabstospaces option,
+// keeping its width the same
+// Whitespace after the first non whitespace character is never touched
+// The conversion is a single undoable edit, and the number of lines that
+// changed is returned
+func (b *Buffer) RetabLines(start, end int) int {
+	if start > end {
+		start, end = end, start
+	}
+	tabsize := util.IntOpt(b.Settings["tabsize"])
 
-		ws := util.GetLeadingWhitespace(l)
-		if len(ws) != 0 {
-			if toSpaces {
-				ws = bytes.Replace(ws, []byte{'\t'}, bytes.Repeat([]byte{' '}, tabsize), -1)
-			} else {
-				ws = bytes.Replace(ws, bytes.Repeat([]byte{' '}, tabsize), []byte{'\t'}, -1)
-			}
+	var deltas []Delta
+	for i := end; i >= start; i-- {
+		ws := util.GetLeadingWhitespace(b.LineBytes(i))
+		if len(ws) == 0 {
+			continue
+		}
+		n := utf8.RuneCount(ws)
+		indent := b.indentOfWidth(util.StringWidth(ws, n, tabsize))
+		if indent != string(ws) {
+			deltas = append(deltas, Delta{[]byte(indent), Loc{0, i}, Loc{n, i}})
 		}
-
-		l = bytes.TrimLeft(l, " \t")
-		b.lines[i].data = append(ws, l...)
-		b.MarkModified(i, i)
-		dirty = true
 	}
-
-	b.isModified = dirty
+	if len(deltas) > 0 {
+		b.MultipleReplace(deltas)
+	}
+	return len(deltas)
 }
 
 // ParseCursorLocation turns a cursor location like 10:5 (LINE:COL)
@@ -1051,6 +1555,20 @@ func (b *Buffer) Line(i int) string {
 	return string(b.LineBytes(i))
 }
 
+// LineWidth returns the display width of the given line number, with tabs
+// expanded and wide runes taking two cells
+// Widths are cached per line, so repeated queries while scrolling are cheap
+func (b *Buffer) LineWidth(y int) int {
+	return b.lineWidth(y, util.IntOpt(b.Settings["tabsize"]))
+}
+
+// MaxLineWidth returns the display width of the widest line in the buffer
+// The maximum is updated as lines are edited and only recomputed from
+// scratch when the widest line shrinks or the tab size changes
+func (b *Buffer) MaxLineWidth() int {
+	return b.maxLineWidth(util.IntOpt(b.Settings["tabsize"]))
+}
+
 func (b *Buffer) Write(bytes []byte) (n int, err error) {
 	b.EventHandler.InsertBytes(b.End(), bytes)
 	return len(bytes), nil
@@ -1,13 +1,23 @@
 package buffer
 
 import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
+	"sync"
 	"testing"
 
 	testifyAssert "github.com/stretchr/testify/assert"
 	lua "github.com/yuin/gopher-lua"
+	"golang.org/x/crypto/openpgp"
 
+	"github.com/zyedidia/micro/internal/config"
 	ulua "github.com/zyedidia/micro/internal/lua"
+	"github.com/zyedidia/micro/internal/screen"
+	"github.com/zyedidia/micro/pkg/highlight"
 )
 
 type operation struct {
@@ -36,6 +46,14 @@ func init() {
 	ulua.L = lua.NewState()
 }
 
+var runtimeFilesOnce sync.Once
+
+// initRuntimeFiles loads the builtin syntax files for the tests that need
+// real filetype detection
+func initRuntimeFiles() {
+	runtimeFilesOnce.Do(config.InitRuntimeFiles)
+}
+
 func check(t *testing.T, before []string, operations []operation, after []string) {
 	var assert asserter
 	if t == nil {
@@ -111,3 +129,850 @@ func check(t *testing.T, before []string, operations []operation, after []string
 
 	b.Close()
 }
+
+func TestCheckReadPermission(t *testing.T) {
+	assert := testifyAssert.New(t)
+
+	denied := &os.PathError{Op: "open", Path: "/etc/shadow", Err: os.ErrPermission}
+	missing := &os.PathError{Op: "open", Path: "/nonexistent", Err: os.ErrNotExist}
+
+	sudo, err := checkReadPermission(nil, false)
+	assert.False(sudo)
+	assert.Nil(err)
+
+	// a missing file becomes an empty buffer, sudo is never needed
+	sudo, err = checkReadPermission(missing, true)
+	assert.False(sudo)
+	assert.Nil(err)
+
+	// without sudo the permission error must not be masked
+	sudo, err = checkReadPermission(denied, false)
+	assert.False(sudo)
+	assert.Equal(denied, err)
+
+	sudo, err = checkReadPermission(denied, true)
+	assert.True(sudo)
+	assert.Nil(err)
+}
+
+func TestModifiedHash(t *testing.T) {
+	assert := testifyAssert.New(t)
+
+	b := NewBufferFromString("foo bar\nbaz", "", BTDefault)
+	b.Settings["fastdirty"] = false
+	b.updateOrigHash()
+	assert.False(b.Modified())
+
+	b.Insert(Loc{3, 0}, "d")
+	assert.True(b.Modified())
+	b.UndoOneEvent()
+	assert.False(b.Modified())
+
+	// the same length but different text
+	b.ReplaceRange(Loc{0, 1}, Loc{3, 1}, "qux")
+	assert.True(b.Modified())
+	b.ReplaceRange(Loc{0, 1}, Loc{3, 1}, "baz")
+	assert.False(b.Modified())
+
+	b.ForceModified()
+	assert.True(b.Modified())
+
+	b.Close()
+}
+
+func BenchmarkModified(bm *testing.B) {
+	text := strings.Repeat("\tfmt.Println(\"some line of text\")\n", 40000)
+	b := NewBufferFromString(text, "", BTDefault)
+	b.Settings["fastdirty"] = false
+	b.updateOrigHash()
+
+	bm.ResetTimer()
+	for i := 0; i < bm.N; i++ {
+		// typing a character and deleting it again, with the status line
+		// asking whether the buffer is modified after each key
+		b.Insert(Loc{0, 20000}, "x")
+		b.Modified()
+		b.Remove(Loc{0, 20000}, Loc{1, 20000})
+		b.Modified()
+	}
+}
+
+func TestIsWritable(t *testing.T) {
+	assert := testifyAssert.New(t)
+
+	dir, err := ioutil.TempDir("", "micro-writable")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "file.txt")
+	assert.NoError(ioutil.WriteFile(name, []byte("text"), 0644))
+	assert.True(isWritable(name))
+
+	// the file must not be changed by the check
+	data, _ := ioutil.ReadFile(name)
+	assert.Equal("text", string(data))
+
+	if os.Geteuid() == 0 {
+		t.Skip("root can write to any file")
+	}
+	assert.NoError(os.Chmod(name, 0444))
+	assert.False(isWritable(name))
+}
+
+func TestReadonlyEdits(t *testing.T) {
+	assert := testifyAssert.New(t)
+
+	b := NewBufferFromString("foo bar", "", BTDefault)
+	b.Type.Readonly = true
+	assert.False(b.RefusedEdit())
+
+	b.Insert(Loc{0, 0}, "x")
+	assert.True(b.RefusedEdit())
+	assert.False(b.RefusedEdit())
+
+	b.Remove(Loc{0, 0}, Loc{3, 0})
+	b.ReplaceRange(Loc{0, 0}, Loc{3, 0}, "baz")
+	b.MultipleReplace([]Delta{{[]byte("baz"), Loc{0, 0}, Loc{3, 0}}})
+	assert.True(b.RefusedEdit())
+	assert.Equal("foo bar", string(b.Bytes()))
+
+	b.Type.Readonly = false
+	b.Insert(Loc{0, 0}, "x")
+	assert.False(b.RefusedEdit())
+	assert.Equal("xfoo bar", string(b.Bytes()))
+
+	b.Close()
+}
+
+func TestOpenCompressed(t *testing.T) {
+	assert := testifyAssert.New(t)
+
+	dir, err := ioutil.TempDir("", "micro-bz2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// "first line\nsecond line\n" compressed with bzip2
+	data := []byte{
+		0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59,
+		0x8b, 0x13, 0xe1, 0x84, 0x00, 0x00, 0x04, 0xd1, 0x80, 0x00,
+		0x10, 0x40, 0x00, 0x0f, 0x25, 0x9c, 0x00, 0x20, 0x00, 0x21,
+		0xa1, 0x32, 0x31, 0x94, 0x20, 0x1a, 0x00, 0x91, 0x2a, 0x31,
+		0x95, 0x68, 0xcb, 0x04, 0x82, 0xfd, 0x57, 0xf1, 0x77, 0x24,
+		0x53, 0x85, 0x09, 0x08, 0xb1, 0x3e, 0x18, 0x40,
+	}
+	name := filepath.Join(dir, "test.log.bz2")
+	ioutil.WriteFile(name, data, 0644)
+
+	btype := GetBufferType(name, BTDefault)
+	assert.Equal(BTBZIP2, btype)
+	b, err := NewBufferFromFile(name, btype, nil)
+	assert.Nil(err)
+	assert.Equal("first line\nsecond line\n", string(b.Bytes()))
+
+	// the buffer cannot be edited
+	b.Insert(Loc{0, 0}, "x")
+	assert.Equal("first line\nsecond line\n", string(b.Bytes()))
+	b.Close()
+
+	// a file that is not bzip2 is an error rather than an empty buffer
+	ioutil.WriteFile(name, []byte("plain text"), 0644)
+	_, err = NewBufferFromFile(name, btype, nil)
+	assert.NotNil(err)
+}
+
+func TestCompressedEncrypted(t *testing.T) {
+	assert := testifyAssert.New(t)
+
+	dir, err := ioutil.TempDir("", "micro-gzgpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// compressed then encrypted
+	name := filepath.Join(dir, "notes.txt.gz.gpg")
+	btype := GetBufferType(name, BTDefault)
+	assert.Equal(BTGPG, btype)
+	b := NewBufferFromString("", name, btype)
+	b.Settings["backup"] = false
+	b.Settings["password"] = "secret"
+	b.Insert(Loc{0, 0}, "compressed and encrypted\n")
+	assert.Nil(b.Save())
+	b.Close()
+
+	data, _ := ioutil.ReadFile(name)
+	assert.NotContains(string(data), "compressed")
+	// the encrypted data is gzip
+	md, err := openpgp.ReadMessage(bytes.NewReader(data), nil, func(keys []openpgp.Key, symmetric bool) ([]byte, error) {
+		return []byte("secret"), nil
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner, err := ioutil.ReadAll(md.UnverifiedBody)
+	assert.Nil(err)
+	if assert.True(len(inner) >= 2) {
+		assert.Equal([]byte{0x1f, 0x8b}, inner[:2])
+	}
+
+	passwords := []screen.Password{{Secret: "secret"}}
+	b, err = NewBufferFromFile(name, btype, passwords)
+	assert.Nil(err)
+	assert.Equal("compressed and encrypted\n", string(b.Bytes()))
+	b.Close()
+
+	// a wrong password is an error rather than an empty buffer
+	_, err = NewBufferFromFile(name, btype, []screen.Password{{Secret: "wrong"}})
+	assert.NotNil(err)
+
+	// and so is encrypted data that is not gzip
+	var encrypted bytes.Buffer
+	w, err := openpgp.SymmetricallyEncrypt(&encrypted, []byte("secret"), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("plain text"))
+	w.Close()
+	ioutil.WriteFile(name, encrypted.Bytes(), 0644)
+	_, err = NewBufferFromFile(name, btype, passwords)
+	assert.NotNil(err)
+
+	// a file that is not gzip is an error rather than an empty buffer
+	name = filepath.Join(dir, "log.txt.gz")
+	ioutil.WriteFile(name, []byte("plain text"), 0644)
+	_, err = NewBufferFromFile(name, GetBufferType(name, BTDefault), nil)
+	assert.NotNil(err)
+}
+
+func TestReplaceRange(t *testing.T) {
+	assert := testifyAssert.New(t)
+
+	b := NewBufferFromString("foo bar\nbaz", "", BTDefault)
+	c := b.GetActiveCursor()
+	c.GotoLoc(Loc{7, 0})
+	other := NewCursor(b, Loc{1, 1})
+	b.AddCursor(other)
+
+	undos := b.UndoStack.Len()
+	end := b.ReplaceRange(Loc{4, 0}, Loc{7, 0}, "qux\nquux")
+	assert.Equal(Loc{4, 1}, end)
+	assert.Equal("foo qux\nquux\nbaz", string(b.Bytes()))
+	assert.Equal(undos+1, b.UndoStack.Len())
+	assert.Equal(end, c.Loc)
+	assert.Equal(Loc{1, 2}, other.Loc)
+
+	b.UndoOneEvent()
+	assert.Equal("foo bar\nbaz", string(b.Bytes()))
+
+	end = b.ReplaceRange(Loc{3, 1}, Loc{0, 1}, "")
+	assert.Equal(Loc{0, 1}, end)
+	assert.Equal("foo bar\n", string(b.Bytes()))
+
+	b.Close()
+}
+
+func TestReplaceRegexSubmatches(t *testing.T) {
+	assert := testifyAssert.New(t)
+
+	b := NewBufferFromString("a=b\nfoo=bar baz=qux", "", BTDefault)
+	r := regexp.MustCompile(`(\w+)=(\w+)`)
+
+	assert.Equal([]byte("b=a"), b.ExpandReplacement(Loc{0, 0}, Loc{3, 0}, r, []byte("$2=$1")))
+
+	n, netrunes := b.ReplaceRegex(b.Start(), b.End(), r, []byte("$2=$1"))
+	assert.Equal(3, n)
+	assert.Equal(0, netrunes)
+	assert.Equal("b=a\nbar=foo qux=baz", string(b.Bytes()))
+
+	n, netrunes = b.ReplaceRegex(b.Start(), b.End(), r, []byte("${1}$$"))
+	assert.Equal(3, n)
+	assert.Equal(-7, netrunes)
+	assert.Equal("b$\nbar$ qux$", string(b.Bytes()))
+
+	b.Close()
+}
+
+func TestReplaceRegexInRange(t *testing.T) {
+	assert := testifyAssert.New(t)
+
+	b := NewBufferFromString("foo foo foo\nfoo foo", "", BTDefault)
+	r := regexp.MustCompile(`\bfoo\b`)
+
+	// the range cuts the first and the last foo in half, neither of
+	// them may be replaced
+	n, _ := b.ReplaceRegex(Loc{2, 0}, Loc{6, 1}, r, []byte("x"))
+	assert.Equal(3, n)
+	assert.Equal("foo x x\nx foo", string(b.Bytes()))
+
+	_, found := b.FindNextInRange(r, Loc{0, 0}, Loc{2, 0}, Loc{0, 0})
+	assert.False(found)
+	locs, found := b.FindNextInRange(r, Loc{0, 0}, b.End(), Loc{1, 0})
+	assert.True(found)
+	assert.Equal([2]Loc{{2, 1}, {5, 1}}, locs)
+
+	b.Close()
+}
+
+func TestReplaceRegexVariableWidth(t *testing.T) {
+	assert := testifyAssert.New(t)
+
+	text := "a bb ccc\nä bb\nccc a"
+	b := NewBufferFromString(text, "", BTDefault)
+	r := regexp.MustCompile(`(\pL+)`)
+
+	// every match on a line changes width by a different amount
+	n, netrunes := b.ReplaceRegex(b.Start(), b.End(), r, []byte("<$1$1>"))
+	assert.Equal(7, n)
+	assert.Equal(13+2*7, netrunes)
+	assert.Equal("<aa> <bbbb> <cccccc>\n<ää> <bbbb>\n<cccccc> <aa>", string(b.Bytes()))
+
+	b.UndoOneEvent()
+	assert.Equal(text, string(b.Bytes()))
+	b.RedoOneEvent()
+	assert.Equal("<aa> <bbbb> <cccccc>\n<ää> <bbbb>\n<cccccc> <aa>", string(b.Bytes()))
+
+	b.Close()
+}
+
+func TestReplaceRegexNewlines(t *testing.T) {
+	assert := testifyAssert.New(t)
+
+	text := "a,b,c\nd,e"
+	b := NewBufferFromString(text, "", BTDefault)
+	r := regexp.MustCompile(`,`)
+
+	n, _ := b.ReplaceRegex(b.Start(), b.End(), r, []byte(",\n"))
+	assert.Equal(3, n)
+	assert.Equal("a,\nb,\nc\nd,\ne", string(b.Bytes()))
+
+	b.UndoOneEvent()
+	assert.Equal(text, string(b.Bytes()))
+
+	b.Close()
+}
+
+func TestEachLineMatching(t *testing.T) {
+	assert := testifyAssert.New(t)
+
+	text := "a = [\n  1,\n  2\n]\nb = [\n  3\n]"
+	b := NewBufferFromString(text, "", BTDefault)
+	r := regexp.MustCompile(`^\s+\d+$`)
+	addComma := func(l string) string { return l + "," }
+
+	assert.Equal(1, b.EachLineMatchingInRange(0, 3, r, addComma))
+	assert.Equal("a = [\n  1,\n  2,\n]\nb = [\n  3\n]", string(b.Bytes()))
+
+	assert.Equal(1, b.EachLineMatching(r, addComma))
+	assert.Equal("a = [\n  1,\n  2,\n]\nb = [\n  3,\n]", string(b.Bytes()))
+
+	// both transformations are undone separately
+	b.UndoOneEvent()
+	b.UndoOneEvent()
+	assert.Equal(text, string(b.Bytes()))
+
+	// lines that are left unchanged are not counted
+	assert.Equal(0, b.EachLineMatching(r, func(l string) string { return l }))
+	assert.Equal(text, string(b.Bytes()))
+
+	b.Close()
+}
+
+func BenchmarkReplaceRegex(b *testing.B) {
+	var sb strings.Builder
+	for i := 0; i < 100000; i++ {
+		sb.WriteString("foo(bar, baz) = foo(qux) + foobar\n")
+	}
+	text := sb.String()
+	r := regexp.MustCompile(`foo\((\w+)`)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		buf := NewBufferFromString(text, "", BTDefault)
+		b.StartTimer()
+
+		buf.ReplaceRegex(buf.Start(), buf.End(), r, []byte("longer_function_name($1"))
+
+		b.StopTimer()
+		buf.Close()
+		b.StartTimer()
+	}
+}
+
+func TestRetabLines(t *testing.T) {
+	assert := testifyAssert.New(t)
+
+	text := "\tif x {\n  \t\ty := \"\t\"\n    }\nz  =  1"
+	b := NewBufferFromString(text, "", BTDefault)
+	b.Settings["tabsize"] = float64(4)
+
+	b.Settings["tabstospaces"] = true
+	// tabs advance to the next tab stop
+	assert.Equal(2, b.RetabLines(0, b.LinesNum()-1))
+	assert.Equal("    if x {\n        y := \"\t\"\n    }\nz  =  1", string(b.Bytes()))
+
+	b.Settings["tabstospaces"] = false
+	assert.Equal(1, b.RetabLines(1, 1))
+	assert.Equal("    if x {\n\t\ty := \"\t\"\n    }\nz  =  1", string(b.Bytes()))
+
+	// the whole conversion is undone at once
+	b.UndoOneEvent()
+	b.UndoOneEvent()
+	assert.Equal(text, string(b.Bytes()))
+
+	b.Close()
+}
+
+func TestRetabLinesInMiddle(t *testing.T) {
+	assert := testifyAssert.New(t)
+
+	text := "\ta\n\tb\n\t\tc\n\td\n\te"
+	b := NewBufferFromString(text, "", BTDefault)
+	b.Settings["tabsize"] = float64(2)
+	b.Settings["tabstospaces"] = true
+
+	// only the lines in the range change, even though the lines around
+	// them are indented with tabs too
+	assert.Equal(2, b.RetabLines(1, 2))
+	assert.Equal("\ta\n  b\n    c\n\td\n\te", string(b.Bytes()))
+	assert.Equal(1, b.RetabLines(3, 3))
+	assert.Equal("\ta\n  b\n    c\n  d\n\te", string(b.Bytes()))
+
+	b.Close()
+}
+
+func TestTrimTrailingWhitespace(t *testing.T) {
+	assert := testifyAssert.New(t)
+
+	text := "a  \n\tb\t\n  \nc"
+	b := NewBufferFromString(text, "", BTDefault)
+	c := b.GetActiveCursor()
+	c.Loc = Loc{3, 0}
+
+	assert.Equal(1, b.TrimTrailingWhitespace(1, 1))
+	assert.Equal("a  \n\tb\n  \nc", string(b.Bytes()))
+
+	assert.Equal(2, b.TrimTrailingWhitespace(0, b.LinesNum()-1))
+	assert.Equal("a\n\tb\n\nc", string(b.Bytes()))
+	assert.Equal(Loc{1, 0}, c.Loc)
+
+	b.UndoOneEvent()
+	assert.Equal("a  \n\tb\n  \nc", string(b.Bytes()))
+
+	b.Close()
+}
+
+func TestTrimTrailingWhitespaceLine(t *testing.T) {
+	assert := testifyAssert.New(t)
+
+	b := NewBufferFromString("a  \nb \t \nc ", "", BTDefault)
+	c := b.GetActiveCursor()
+	c.Loc = Loc{4, 1}
+	other := NewCursor(b, Loc{1, 0})
+	b.AddCursor(other)
+
+	assert.Equal(1, b.TrimTrailingWhitespace(1, 1))
+	assert.Equal("a  \nb\nc ", string(b.Bytes()))
+	// the cursor in the trimmed whitespace moves to the end of the line
+	assert.Equal(Loc{1, 1}, c.Loc)
+	assert.Equal(Loc{1, 0}, other.Loc)
+
+	// a line without trailing whitespace is not an edit
+	assert.Equal(0, b.TrimTrailingWhitespace(1, 1))
+
+	b.UndoOneEvent()
+	assert.Equal("a  \nb \t \nc ", string(b.Bytes()))
+
+	b.Close()
+}
+
+// highlightStringsAndComments highlights the buffer with a syntax that
+// only knows about double quoted strings and comments, and keeps it
+// highlighted as the buffer is edited
+func highlightStringsAndComments(t testing.TB, b *Buffer) {
+	syntax := []byte(`filetype: test
+rules:
+    - constant.string:
+        start: "\""
+        end: "\""
+        rules: []
+    - comment:
+        start: "//"
+        end: "$"
+        rules: []
+    - comment:
+        start: "/\\*"
+        end: "\\*/"
+        rules: []
+`)
+	f, err := highlight.ParseFile(syntax)
+	if err != nil {
+		t.Fatal(err)
+	}
+	def, err := highlight.ParseDef(f, &highlight.Header{FileType: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b.SyntaxDef = def
+	b.Highlighter = highlight.NewHighlighter(def)
+	b.Settings["syntax"] = true
+	b.Highlighter.HighlightStates(b)
+	b.Highlighter.HighlightMatches(b, 0, b.LinesNum())
+}
+
+func TestFindMatchingBrace(t *testing.T) {
+	assert := testifyAssert.New(t)
+
+	b := NewBufferFromString("f(\"(\", a) // )\n{ x(\"}\") }", "", BTDefault)
+	highlightStringsAndComments(t, b)
+
+	// braces in strings and comments are skipped
+	m, left, found := b.FindMatchingBrace([2]rune{'(', ')'}, Loc{1, 0})
+	assert.True(found)
+	assert.False(left)
+	assert.Equal(Loc{8, 0}, m)
+	m, _, found = b.FindMatchingBrace([2]rune{'{', '}'}, Loc{10, 1})
+	assert.True(found)
+	assert.Equal(Loc{0, 1}, m)
+
+	// unless the brace is itself inside a string
+	m, left, found = b.FindMatchingBrace([2]rune{'(', ')'}, Loc{4, 0})
+	assert.True(found)
+	assert.True(left)
+	assert.Equal(Loc{8, 0}, m)
+
+	_, _, found = b.FindMatchingBrace([2]rune{'[', ']'}, Loc{1, 0})
+	assert.False(found)
+
+	b.Settings["bracepairs"] = "()<>"
+	assert.Equal([][2]rune{{'(', ')'}, {'<', '>'}}, b.BracePairs())
+	b.Settings["bracepairs"] = "(){"
+	assert.Equal(BracePairs, b.BracePairs())
+
+	b.Close()
+}
+
+func TestFindMatchingBraceInString(t *testing.T) {
+	assert := testifyAssert.New(t)
+
+	b := NewBufferFromString(`foo( ")" )`, "", BTDefault)
+
+	// without highlighting the ) in the string is taken as the match
+	m, _, found := b.FindMatchingBrace([2]rune{'(', ')'}, Loc{3, 0})
+	assert.True(found)
+	assert.Equal(Loc{6, 0}, m)
+
+	highlightStringsAndComments(t, b)
+	m, left, found := b.FindMatchingBrace([2]rune{'(', ')'}, Loc{3, 0})
+	assert.True(found)
+	assert.False(left)
+	assert.Equal(Loc{9, 0}, m)
+
+	// and from the real closing paren back to the opening one
+	m, left, found = b.FindMatchingBrace([2]rune{'(', ')'}, Loc{10, 0})
+	assert.True(found)
+	assert.True(left)
+	assert.Equal(Loc{3, 0}, m)
+
+	b.Close()
+}
+
+func TestUpdateRulesKeepsHighlighting(t *testing.T) {
+	assert := testifyAssert.New(t)
+
+	initRuntimeFiles()
+	b := NewBufferFromString("package main\n\nfunc main() {}\n", "main.go", BTDefault)
+	assert.Equal("go", b.Settings["filetype"])
+	h := b.Highlighter
+	assert.NotNil(h)
+
+	// the rules have not changed, so nothing is highlighted again
+	b.UpdateRules()
+	assert.True(h == b.Highlighter)
+
+	// but they are once the highlighting has been cleared
+	b.ClearMatches()
+	b.UpdateRules()
+	assert.False(h == b.Highlighter)
+
+	b.Settings["filetype"] = "c"
+	h = b.Highlighter
+	b.UpdateRules()
+	assert.False(h == b.Highlighter)
+	assert.Equal("c", b.SyntaxDef.FileType)
+
+	b.Close()
+}
+
+func TestRehighlightDirtyLines(t *testing.T) {
+	assert := testifyAssert.New(t)
+
+	b := NewBufferFromString("a\nb\nc\nd\ne", "", BTDefault)
+	highlightStringsAndComments(t, b)
+	states := func() []highlight.State {
+		var s []highlight.State
+		for i := 0; i < b.LinesNum(); i++ {
+			s = append(s, b.State(i))
+		}
+		return s
+	}
+	fresh := func() []highlight.State {
+		c := NewBufferFromString(string(b.Bytes()), "", BTDefault)
+		highlightStringsAndComments(t, c)
+		for i := 0; i < b.LinesNum(); i++ {
+			assert.Equal(c.State(i), b.State(i), "line %d", i)
+		}
+		c.Close()
+		return states()
+	}
+
+	// opening a comment changes the state of every line below
+	b.Insert(Loc{0, 1}, "/*")
+	s := fresh()
+	assert.NotNil(s[4])
+
+	// and closing it again stops at the line where it is closed
+	b.Insert(Loc{1, 2}, "*/")
+	s = fresh()
+	assert.Nil(s[3])
+
+	b.Remove(Loc{0, 1}, Loc{2, 1})
+	s = fresh()
+	assert.Nil(s[1])
+
+	// no line is left marked dirty
+	for i := 0; i < b.LinesNum(); i++ {
+		assert.False(b.Rehighlight(i))
+	}
+
+	b.Close()
+}
+
+func BenchmarkUpdateRules(b *testing.B) {
+	initRuntimeFiles()
+	src := strings.Repeat("func f(a int) string {\n\t// comment\n\treturn \"str\" /* x */\n}\n", 5000)
+	buf := NewBufferFromString(src, "main.go", BTDefault)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.UpdateRules()
+	}
+	b.StopTimer()
+	buf.Close()
+}
+
+func BenchmarkEditHighlight(b *testing.B) {
+	initRuntimeFiles()
+	src := strings.Repeat("func f(a int) string {\n\t// comment\n\treturn \"str\" /* x */\n}\n", 5000)
+	buf := NewBufferFromString(src, "main.go", BTDefault)
+	buf.Settings["backup"] = false
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Insert(Loc{1, 10000}, "x")
+		buf.Remove(Loc{1, 10000}, Loc{2, 10000})
+	}
+	b.StopTimer()
+	buf.Close()
+}
+
+func BenchmarkHighlightStates(b *testing.B) {
+	initRuntimeFiles()
+	src := strings.Repeat("func f(a int) string {\n\t// comment\n\treturn \"str\" /* x */\n}\n", 5000)
+	buf := NewBufferFromString(src, "main.go", BTDefault)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Highlighter.HighlightStates(buf)
+	}
+	b.StopTimer()
+	buf.Close()
+}
+
+func TestMoveLines(t *testing.T) {
+	assert := testifyAssert.New(t)
+
+	b := NewBufferFromString("a\nb\nc\nd", "", BTDefault)
+
+	// the first line down and back up
+	b.MoveLinesDown(0, 1)
+	assert.Equal("b\na\nc\nd", string(b.Bytes()))
+	b.MoveLinesUp(1, 2)
+	assert.Equal("a\nb\nc\nd", string(b.Bytes()))
+
+	// the last line up and back down
+	b.MoveLinesUp(3, 4)
+	assert.Equal("a\nb\nd\nc", string(b.Bytes()))
+	b.MoveLinesDown(2, 3)
+	assert.Equal("a\nb\nc\nd", string(b.Bytes()))
+
+	// blocks at both ends
+	b.MoveLinesDown(1, 3)
+	assert.Equal("a\nd\nb\nc", string(b.Bytes()))
+	b.MoveLinesUp(2, 4)
+	assert.Equal("a\nb\nc\nd", string(b.Bytes()))
+	b.MoveLinesDown(0, 3)
+	assert.Equal("d\na\nb\nc", string(b.Bytes()))
+	b.MoveLinesUp(1, 4)
+	assert.Equal("a\nb\nc\nd", string(b.Bytes()))
+
+	// nothing below the last line or above the first one
+	b.MoveLinesDown(3, 4)
+	b.MoveLinesUp(0, 1)
+	assert.Equal("a\nb\nc\nd", string(b.Bytes()))
+
+	b.Close()
+}
+
+func TestDuplicateLines(t *testing.T) {
+	assert := testifyAssert.New(t)
+
+	b := NewBufferFromString("a\nb\nc", "", BTDefault)
+
+	assert.Equal(1, b.DuplicateLines(0, 0))
+	assert.Equal("a\na\nb\nc", string(b.Bytes()))
+
+	assert.Equal(2, b.DuplicateLines(3, 2))
+	assert.Equal("a\na\nb\nc\nb\nc", string(b.Bytes()))
+
+	// a single undo removes the copy
+	b.UndoOneEvent()
+	assert.Equal("a\na\nb\nc", string(b.Bytes()))
+
+	assert.Equal(0, b.DuplicateLines(3, 4))
+
+	b.Type.Readonly = true
+	assert.Equal(0, b.DuplicateLines(0, 0))
+	assert.True(b.RefusedEdit())
+
+	b.Close()
+}
+
+func TestEndsWithNewline(t *testing.T) {
+	assert := testifyAssert.New(t)
+
+	b := NewBufferFromString("a\r\nb\r\n", "", BTDefault)
+	assert.True(b.EndsWithNewline())
+	assert.Equal("dos", b.FileFormat())
+
+	b.Remove(Loc{1, 1}, Loc{0, 2})
+	assert.False(b.EndsWithNewline())
+
+	b.SetOptionNative("fileformat", "unix")
+	assert.Equal("unix", b.FileFormat())
+
+	b = NewBufferFromString("", "", BTDefault)
+	assert.False(b.EndsWithNewline())
+	b.Insert(Loc{0, 0}, "\n")
+	assert.True(b.EndsWithNewline())
+
+	b.Close()
+}
+
+func TestGetNameAbsPath(t *testing.T) {
+	assert := testifyAssert.New(t)
+
+	b := NewBufferFromString("", "dir/file.txt", BTDefault)
+	abs, _ := filepath.Abs("dir/file.txt")
+	assert.Equal("dir/file.txt", b.GetName())
+
+	b.SetOptionNative("abspath", true)
+	assert.Equal(abs, b.GetName())
+	assert.Equal("dir/file.txt", b.Path)
+
+	b.SetOptionNative("basename", true)
+	assert.Equal("file.txt", b.GetName())
+
+	b.Close()
+
+	// a named buffer without a file keeps its name
+	b = NewBufferFromString("", "", BTHelp)
+	b.SetName("Help options")
+	b.SetOptionNative("abspath", true)
+	assert.Equal("Help options", b.GetName())
+
+	b.Close()
+}
+
+func TestStatusName(t *testing.T) {
+	assert := testifyAssert.New(t)
+
+	b := NewBufferFromString("", "file.txt", BTDefault)
+	b.Settings["backup"] = false
+	assert.Equal("file.txt", b.StatusName())
+
+	b.Insert(Loc{0, 0}, "a")
+	assert.Equal("file.txt +", b.StatusName())
+
+	b.SetOptionNative("nameformat", "$(modified)$(name)")
+	assert.Equal("+ file.txt", b.StatusName())
+	b.Close()
+
+	// readonly buffers such as help are only marked if the format asks
+	b = NewBufferFromString("", "", BTHelp)
+	assert.Equal("No name", b.StatusName())
+	b.SetOptionNative("nameformat", "$(readonly)$(name)")
+	assert.Equal("[ro] No name", b.StatusName())
+	b.Close()
+}
+
+func TestFindAll(t *testing.T) {
+	assert := testifyAssert.New(t)
+
+	b := NewBufferFromString("héllo Hello\nnone\nhello.", "", BTDefault)
+
+	found, err := b.FindAll("hello", false)
+	assert.NoError(err)
+	assert.Equal([][2]Loc{{{0, 2}, {5, 2}}}, found)
+
+	// rune offsets after multibyte characters
+	found, err = b.FindAll(`[hH]\S+o`, true)
+	assert.NoError(err)
+	assert.Equal([][2]Loc{{{0, 0}, {5, 0}}, {{6, 0}, {11, 0}}, {{0, 2}, {5, 2}}}, found)
+
+	b.Settings["ignorecase"] = true
+	found, _ = b.FindAll("hello", false)
+	assert.Equal([][2]Loc{{{6, 0}, {11, 0}}, {{0, 2}, {5, 2}}}, found)
+
+	// matches that straddle the range are left out
+	r := regexp.MustCompile(`l+`)
+	assert.Equal([][2]Loc{{{8, 0}, {10, 0}}, {{2, 2}, {4, 2}}}, b.FindAllInRange(r, Loc{3, 0}, Loc{5, 2}))
+
+	_, err = b.FindAll("(", true)
+	assert.Error(err)
+
+	b.Close()
+}
+
+func TestReplaceRegexMultiline(t *testing.T) {
+	assert := testifyAssert.New(t)
+
+	b := NewBufferFromString("a\n\n\n\nbé\n\n\nc foo\nbar", "", BTDefault)
+
+	r := regexp.MustCompile(`foo\nbar`)
+	locs, found := b.FindNextMultiline(r, b.Start(), b.End(), b.Start())
+	assert.True(found)
+	assert.Equal([2]Loc{{2, 7}, {3, 8}}, locs)
+	assert.Equal([]byte("bar foo"), b.ExpandReplacement(locs[0], locs[1], regexp.MustCompile(`(foo)\n(bar)`), []byte("$2 $1")))
+
+	n, netrunes := b.ReplaceRegexMultiline(b.Start(), b.End(), regexp.MustCompile(`(\n\n)\n+`), []byte("$1"))
+	assert.Equal(2, n)
+	assert.Equal(-3, netrunes)
+	assert.Equal("a\n\nbé\n\nc foo\nbar", string(b.Bytes()))
+
+	// a single undo brings back every match
+	b.UndoOneEvent()
+	assert.Equal("a\n\n\n\nbé\n\n\nc foo\nbar", string(b.Bytes()))
+
+	// matches that leave the range are not replaced
+	n, _ = b.ReplaceRegexMultiline(Loc{0, 4}, Loc{4, 7}, r, []byte("x"))
+	assert.Equal(0, n)
+	n, _ = b.ReplaceRegexMultiline(Loc{1, 4}, b.End(), r, []byte("x"))
+	assert.Equal(1, n)
+	assert.Equal("a\n\n\n\nbé\n\n\nc x", string(b.Bytes()))
+
+	b.Close()
+}
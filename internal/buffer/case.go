@@ -0,0 +1,170 @@
+package buffer
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/zyedidia/micro/internal/util"
+)
+
+// The case styles that CycleCase rotates through, in order
+const (
+	CaseSnake  = "snake"
+	CaseCamel  = "camel"
+	CasePascal = "pascal"
+	CaseKebab  = "kebab"
+)
+
+var caseStyles = []string{CaseSnake, CaseCamel, CasePascal, CaseKebab}
+
+// isCaseChar returns whether the rune can be part of an identifier
+// in any of the supported case styles
+func isCaseChar(r rune) bool {
+	return util.IsWordChar(r) || r == '-'
+}
+
+// splitCaseWords splits an identifier into its words
+// Underscores and dashes separate words, as does a change from a lower
+// case letter to an upper case one. A run of upper case letters is kept
+// together as an acronym, so HTTPServer is split into HTTP and Server
+func splitCaseWords(word string) []string {
+	var words []string
+	runes := []rune(word)
+	start := 0
+	for i := 0; i <= len(runes); i++ {
+		if i == len(runes) || runes[i] == '_' || runes[i] == '-' {
+			if i > start {
+				words = append(words, string(runes[start:i]))
+			}
+			start = i + 1
+			continue
+		}
+		if i == start || !unicode.IsUpper(runes[i]) {
+			continue
+		}
+		prev := runes[i-1]
+		nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+		if !unicode.IsUpper(prev) || nextLower {
+			words = append(words, string(runes[start:i]))
+			start = i
+		}
+	}
+	return words
+}
+
+// detectCase returns the case style of the given identifier, or an
+// empty string if it cannot be determined
+// A single lower case word is reported as snake case
+func detectCase(word string) string {
+	switch {
+	case strings.Contains(word, "_"):
+		return CaseSnake
+	case strings.Contains(word, "-"):
+		return CaseKebab
+	}
+
+	r, _ := utf8.DecodeRuneInString(word)
+	if unicode.IsUpper(r) {
+		return CasePascal
+	} else if strings.IndexFunc(word, unicode.IsUpper) >= 0 {
+		return CaseCamel
+	} else if unicode.IsLetter(r) {
+		return CaseSnake
+	}
+	return ""
+}
+
+// convertCase converts an identifier to the given case style
+// Acronyms are treated like any other word, so converting HTTPServer
+// to camel case gives httpServer
+func convertCase(word, style string) string {
+	words := splitCaseWords(word)
+	for i, w := range words {
+		w = strings.ToLower(w)
+		if style == CasePascal || (style == CaseCamel && i > 0) {
+			r, size := utf8.DecodeRuneInString(w)
+			w = string(unicode.ToUpper(r)) + w[size:]
+		}
+		words[i] = w
+	}
+
+	switch style {
+	case CaseSnake:
+		return strings.Join(words, "_")
+	case CaseKebab:
+		return strings.Join(words, "-")
+	case CaseCamel, CasePascal:
+		return strings.Join(words, "")
+	}
+	return word
+}
+
+// nextCase returns the style that follows the given one when cycling
+func nextCase(style string) string {
+	for i, s := range caseStyles {
+		if s == style {
+			return caseStyles[(i+1)%len(caseStyles)]
+		}
+	}
+	return caseStyles[0]
+}
+
+// CycleCase converts the identifier under the cursor to the next case
+// style (snake_case, camelCase, PascalCase, kebab-case) as a single
+// undoable edit
+// It returns the new style, or an empty string if there is no identifier
+// under the cursor
+func (b *Buffer) CycleCase(c *Cursor) string {
+	if b.Type.Readonly {
+		return ""
+	}
+
+	line := []rune(string(b.LineBytes(c.Y)))
+	x := util.Clamp(c.X, 0, len(line))
+	if x == len(line) || !isCaseChar(line[x]) {
+		if x == 0 || !isCaseChar(line[x-1]) {
+			return ""
+		}
+		x--
+	}
+
+	start, end := x, x
+	for start > 0 && isCaseChar(line[start-1]) {
+		start--
+	}
+	for end < len(line) && isCaseChar(line[end]) {
+		end++
+	}
+	// dashes around an identifier are not part of it
+	for start < end && line[start] == '-' {
+		start++
+	}
+	for end > start && line[end-1] == '-' {
+		end--
+	}
+	if start == end {
+		return ""
+	}
+
+	word := string(line[start:end])
+	style := nextCase(detectCase(word))
+	converted := convertCase(word, style)
+	if converted == word {
+		// single words look the same in some styles, so try the others
+		for i := 0; i < len(caseStyles)-1 && converted == word; i++ {
+			style = nextCase(style)
+			converted = convertCase(word, style)
+		}
+		if converted == word {
+			return ""
+		}
+	}
+
+	b.MultipleReplace([]Delta{{[]byte(converted), Loc{start, c.Y}, Loc{end, c.Y}}})
+	c.ResetSelection()
+	c.Loc = Loc{util.Min(c.X, start+utf8.RuneCountInString(converted)), c.Y}
+	c.StoreVisualX()
+
+	return style
+}
@@ -0,0 +1,79 @@
+package buffer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitCaseWords(t *testing.T) {
+	assert.Equal(t, []string{"foo", "bar"}, splitCaseWords("foo_bar"))
+	assert.Equal(t, []string{"foo", "bar"}, splitCaseWords("foo-bar"))
+	assert.Equal(t, []string{"foo", "Bar"}, splitCaseWords("fooBar"))
+	assert.Equal(t, []string{"HTTP", "Server"}, splitCaseWords("HTTPServer"))
+	assert.Equal(t, []string{"get", "HTTP", "Response"}, splitCaseWords("getHTTPResponse"))
+	assert.Equal(t, []string{"parse", "URL"}, splitCaseWords("parseURL"))
+}
+
+func TestDetectCase(t *testing.T) {
+	assert.Equal(t, CaseSnake, detectCase("foo_bar"))
+	assert.Equal(t, CaseCamel, detectCase("fooBar"))
+	assert.Equal(t, CasePascal, detectCase("FooBar"))
+	assert.Equal(t, CaseKebab, detectCase("foo-bar"))
+	assert.Equal(t, CaseSnake, detectCase("foo"))
+	assert.Equal(t, "", detectCase("123"))
+}
+
+func TestConvertCase(t *testing.T) {
+	tests := []struct {
+		word  string
+		style string
+		want  string
+	}{
+		{"foo_bar_baz", CaseCamel, "fooBarBaz"},
+		{"foo_bar_baz", CasePascal, "FooBarBaz"},
+		{"foo_bar_baz", CaseKebab, "foo-bar-baz"},
+		{"fooBarBaz", CaseSnake, "foo_bar_baz"},
+		{"fooBarBaz", CasePascal, "FooBarBaz"},
+		{"fooBarBaz", CaseKebab, "foo-bar-baz"},
+		{"FooBarBaz", CaseSnake, "foo_bar_baz"},
+		{"FooBarBaz", CaseCamel, "fooBarBaz"},
+		{"FooBarBaz", CaseKebab, "foo-bar-baz"},
+		{"foo-bar-baz", CaseSnake, "foo_bar_baz"},
+		{"foo-bar-baz", CaseCamel, "fooBarBaz"},
+		{"foo-bar-baz", CasePascal, "FooBarBaz"},
+		{"HTTPServer", CaseSnake, "http_server"},
+		{"HTTPServer", CaseCamel, "httpServer"},
+		{"HTTPServer", CaseKebab, "http-server"},
+		{"getHTTPResponse", CasePascal, "GetHttpResponse"},
+		{"http_server", CasePascal, "HttpServer"},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.want, convertCase(test.word, test.style), test.word+" to "+test.style)
+	}
+}
+
+func TestCycleCase(t *testing.T) {
+	b := NewBufferFromString("x := foo_bar()", "", BTDefault)
+	c := b.GetActiveCursor()
+	c.Loc = Loc{6, 0}
+
+	assert.Equal(t, CaseCamel, b.CycleCase(c))
+	assert.Equal(t, "x := fooBar()", string(b.Bytes()))
+	assert.Equal(t, CasePascal, b.CycleCase(c))
+	assert.Equal(t, "x := FooBar()", string(b.Bytes()))
+	assert.Equal(t, CaseKebab, b.CycleCase(c))
+	assert.Equal(t, "x := foo-bar()", string(b.Bytes()))
+	assert.Equal(t, CaseSnake, b.CycleCase(c))
+	assert.Equal(t, "x := foo_bar()", string(b.Bytes()))
+
+	// each step is a single undoable edit
+	b.UndoOneEvent()
+	assert.Equal(t, "x := foo-bar()", string(b.Bytes()))
+
+	c.Loc = Loc{2, 0}
+	assert.Equal(t, "", b.CycleCase(c))
+
+	b.Close()
+}
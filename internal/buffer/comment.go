@@ -0,0 +1,117 @@
+package buffer
+
+import (
+	"bytes"
+	"strings"
+)
+
+// lineComments maps filetypes to the token that starts a line comment
+var lineComments = map[string]string{
+	"c":          "//",
+	"c++":        "//",
+	"cpp":        "//",
+	"csharp":     "//",
+	"d":          "//",
+	"elm":        "--",
+	"go":         "//",
+	"java":       "//",
+	"javascript": "//",
+	"julia":      "#",
+	"kotlin":     "//",
+	"lua":        "--",
+	"perl":       "#",
+	"php":        "//",
+	"python":     "#",
+	"python2":    "#",
+	"ruby":       "#",
+	"rust":       "//",
+	"shell":      "#",
+	"swift":      "//",
+	"typescript": "//",
+	"yaml":       "#",
+}
+
+// blockComments lists the filetypes that use /* */ block comments
+var blockComments = map[string]bool{
+	"c":          true,
+	"c++":        true,
+	"cpp":        true,
+	"csharp":     true,
+	"css":        true,
+	"d":          true,
+	"go":         true,
+	"java":       true,
+	"javascript": true,
+	"kotlin":     true,
+	"php":        true,
+	"rust":       true,
+	"swift":      true,
+	"typescript": true,
+}
+
+// lineCommentToken returns the line comment token for this buffer
+// The commenttype option set by the comment plugin takes precedence over
+// the builtin list of filetypes
+func (b *Buffer) lineCommentToken() string {
+	if ct, ok := b.Settings["commenttype"].(string); ok {
+		if i := strings.Index(ct, "%s"); i > 0 && strings.TrimSpace(ct[i+2:]) == "" {
+			return strings.TrimSpace(ct[:i])
+		}
+	}
+	return lineComments[b.FileType()]
+}
+
+// inBlockComment returns whether line y is inside a /* */ comment that
+// started on an earlier line
+func (b *Buffer) inBlockComment(y int) bool {
+	for i := y - 1; i >= 0; i-- {
+		l := b.LineBytes(i)
+		open := bytes.LastIndex(l, []byte("/*"))
+		close := bytes.LastIndex(l, []byte("*/"))
+		if close >= 0 && close > open {
+			return false
+		}
+		if open >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// CommentContinuation returns the comment prefix that a new line opened
+// after line y should start with, after its indentation, if line y is a
+// comment
+// For a line comment this is the comment token and the space following
+// it, and inside a /* */ block comment it is a leading *
+// It returns an empty string if line y is not a comment, if the comment
+// ends on it, or if the autocomment option is off
+func (b *Buffer) CommentContinuation(y int) string {
+	if !b.Settings["autocomment"].(bool) {
+		return ""
+	}
+
+	line := b.LineBytes(y)
+	rest := bytes.TrimLeft(line, " \t")
+
+	if token := b.lineCommentToken(); token != "" && bytes.HasPrefix(rest, []byte(token)) {
+		after := rest[len(token):]
+		space := after[:len(after)-len(bytes.TrimLeft(after, " \t"))]
+		return token + string(space)
+	}
+
+	if !blockComments[b.FileType()] || bytes.Contains(rest, []byte("*/")) {
+		return ""
+	}
+	if bytes.HasPrefix(rest, []byte("/*")) {
+		return " * "
+	}
+	if bytes.HasPrefix(rest, []byte("*")) && b.inBlockComment(y) {
+		after := rest[1:]
+		space := after[:len(after)-len(bytes.TrimLeft(after, " \t"))]
+		if len(space) == 0 {
+			space = []byte{' '}
+		}
+		return "*" + string(space)
+	}
+	return ""
+}
@@ -0,0 +1,49 @@
+package buffer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommentContinuationLine(t *testing.T) {
+	b := NewBufferFromString("\t// hello\n\t//\nx := 1 // trailing\n# shell", "", BTDefault)
+	b.Settings["filetype"] = "go"
+
+	assert.Equal(t, "", b.CommentContinuation(0))
+	b.Settings["autocomment"] = true
+
+	assert.Equal(t, "// ", b.CommentContinuation(0))
+	assert.Equal(t, "//", b.CommentContinuation(1))
+	assert.Equal(t, "", b.CommentContinuation(2))
+	assert.Equal(t, "", b.CommentContinuation(3))
+
+	// the comment plugin's commenttype takes precedence
+	b.Settings["commenttype"] = "# %s"
+	assert.Equal(t, "# ", b.CommentContinuation(3))
+	b.Settings["commenttype"] = "<!-- %s -->"
+	assert.Equal(t, "// ", b.CommentContinuation(0))
+
+	b.Close()
+}
+
+func TestCommentContinuationBlock(t *testing.T) {
+	b := NewBufferFromString(strings.Join([]string{
+		"/**",
+		" * Doc",
+		" */",
+		" * not a comment",
+		"/* one line */",
+	}, "\n"), "", BTDefault)
+	b.Settings["filetype"] = "c"
+	b.Settings["autocomment"] = true
+
+	assert.Equal(t, " * ", b.CommentContinuation(0))
+	assert.Equal(t, "* ", b.CommentContinuation(1))
+	assert.Equal(t, "", b.CommentContinuation(2))
+	assert.Equal(t, "", b.CommentContinuation(3))
+	assert.Equal(t, "", b.CommentContinuation(4))
+
+	b.Close()
+}
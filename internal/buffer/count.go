@@ -0,0 +1,54 @@
+package buffer
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// countWords returns the number of words in b, which are separated by
+// white space
+func countWords(b []byte) int {
+	words := 0
+	inWord := false
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		b = b[size:]
+		if unicode.IsSpace(r) {
+			inWord = false
+		} else if !inWord {
+			inWord = true
+			words++
+		}
+	}
+	return words
+}
+
+// Count returns the number of characters, words and lines in the text
+// from start to end, one line at a time so that the text is not copied
+// Line breaks count as one character each, and a selection that ends at
+// the start of a line does not count that line
+func (b *Buffer) Count(start, end Loc) (chars, words, lines int) {
+	start, end = clamp(start, b.LineArray), clamp(end, b.LineArray)
+	if end.LessThan(start) {
+		start, end = end, start
+	}
+
+	for y := start.Y; y <= end.Y; y++ {
+		l := b.LineBytes(y)
+		if y == end.Y {
+			l = l[:runeToByteIndex(end.X, l)]
+		}
+		if y == start.Y {
+			l = l[runeToByteIndex(start.X, l):]
+		}
+		chars += utf8.RuneCount(l)
+		words += countWords(l)
+	}
+	chars += end.Y - start.Y
+
+	lines = end.Y - start.Y + 1
+	if end.X == 0 && end.Y > start.Y {
+		lines--
+	}
+	return chars, words, lines
+}
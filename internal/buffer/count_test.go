@@ -0,0 +1,34 @@
+package buffer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCount(t *testing.T) {
+	b := NewBufferFromString("Hello, wörld!\n\tsecond  line\n\nlast\n", "", BTDefault)
+
+	chars, words, lines := b.Count(b.Start(), b.End())
+	assert.Equal(t, 34, chars)
+	assert.Equal(t, 5, words)
+	assert.Equal(t, 4, lines)
+
+	// a word cut by the selection still counts
+	chars, words, lines = b.Count(Loc{9, 0}, Loc{3, 1})
+	assert.Equal(t, 8, chars)
+	assert.Equal(t, 2, words)
+	assert.Equal(t, 2, lines)
+
+	chars, words, lines = b.Count(Loc{0, 1}, Loc{0, 2})
+	assert.Equal(t, 14, chars)
+	assert.Equal(t, 2, words)
+	assert.Equal(t, 1, lines)
+
+	chars, words, lines = b.Count(Loc{2, 0}, Loc{2, 0})
+	assert.Equal(t, 0, chars)
+	assert.Equal(t, 0, words)
+	assert.Equal(t, 1, lines)
+
+	b.Close()
+}
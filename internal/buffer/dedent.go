@@ -0,0 +1,105 @@
+package buffer
+
+import (
+	"bytes"
+	"unicode/utf8"
+
+	"github.com/zyedidia/micro/internal/util"
+)
+
+var pythonDedentKeywords = map[string][]string{
+	"else":    {"if", "elif", "for", "while", "try", "except"},
+	"elif":    {"if", "elif"},
+	"except":  {"try", "except"},
+	"finally": {"try", "except", "else"},
+}
+
+// dedentKeywords maps a filetype to the keywords that continue a block
+// and, for each of them, the keywords of the lines they line up with
+var dedentKeywords = map[string]map[string][]string{
+	"python":  pythonDedentKeywords,
+	"python2": pythonDedentKeywords,
+}
+
+// leadingKeyword returns the first word of a line if it stands on its own,
+// that is if it is followed by a non word character or the end of the line
+func leadingKeyword(line []byte) string {
+	line = bytes.TrimLeft(line, " \t")
+	end := 0
+	for end < len(line) {
+		r, size := utf8.DecodeRune(line[end:])
+		if !util.IsWordChar(r) {
+			break
+		}
+		end += size
+	}
+	return string(line[:end])
+}
+
+// SmartDedent returns the indentation width that line y should have when
+// it starts with a keyword that continues a block, such as else in Python,
+// so that it lines up with the line that opened the block
+// It returns -1 if the line does not start with such a keyword, if no
+// opener is found, or if the filetype has no keywords or autoindent is off
+func (b *Buffer) SmartDedent(y int) int {
+	if !b.Settings["autoindent"].(bool) {
+		return -1
+	}
+	keywords, ok := dedentKeywords[b.FileType()]
+	if !ok {
+		return -1
+	}
+	openers, ok := keywords[leadingKeyword(b.LineBytes(y))]
+	if !ok {
+		return -1
+	}
+
+	tabsize := util.IntOpt(b.Settings["tabsize"])
+	indentWidth := func(l []byte) int {
+		ws := util.GetLeadingWhitespace(l)
+		return util.StringWidth(ws, utf8.RuneCount(ws), tabsize)
+	}
+
+	// Only lines indented no deeper than the keyword can open its block.
+	// Each plain statement at that depth means the block is further out,
+	// but a different block header cannot be crossed
+	threshold := indentWidth(b.LineBytes(y))
+	for i := y - 1; i >= 0; i-- {
+		l := b.LineBytes(i)
+		trimmed := bytes.TrimSpace(l)
+		if len(trimmed) == 0 || trimmed[0] == '#' {
+			continue
+		}
+		w := indentWidth(l)
+		if w > threshold {
+			continue
+		}
+
+		kw := leadingKeyword(l)
+		for _, o := range openers {
+			if kw == o {
+				return w
+			}
+		}
+		if bytes.HasSuffix(trimmed, []byte{':'}) {
+			return -1
+		}
+		threshold = w - 1
+		if threshold < 0 {
+			break
+		}
+	}
+	return -1
+}
+
+// SetLineIndent replaces the leading whitespace of line y with an
+// indentation of the given width, using tabs or spaces depending on the
+// tabstospaces option
+func (b *Buffer) SetLineIndent(y, width int) {
+	ws := util.GetLeadingWhitespace(b.LineBytes(y))
+	indent := b.indentOfWidth(width)
+	if indent == string(ws) {
+		return
+	}
+	b.ReplaceRange(Loc{0, y}, Loc{utf8.RuneCount(ws), y}, indent)
+}
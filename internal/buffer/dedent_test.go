@@ -0,0 +1,75 @@
+package buffer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var pythonFixture = strings.Join([]string{
+	"def f(a, b):",
+	"    if a:",
+	"        if b:",
+	"            x = 1",
+	"            else:",
+	"        y = 2",
+	"        else:",
+	"    for i in range(3):",
+	"        pass",
+	"        else:",
+	"    try:",
+	"        g()",
+	"        except ValueError:",
+	"        return 1",
+	"# comment",
+	"",
+	"        finally:",
+	"    return 2",
+	"    else:",
+}, "\n")
+
+func TestSmartDedent(t *testing.T) {
+	b := NewBufferFromString(pythonFixture, "", BTDefault)
+	b.Settings["filetype"] = "python"
+	b.Settings["tabstospaces"] = true
+
+	// else lines up with the innermost if
+	assert.Equal(t, 8, b.SmartDedent(4))
+	// after the inner block ends it lines up with the outer if
+	assert.Equal(t, 4, b.SmartDedent(6))
+	// for/else
+	assert.Equal(t, 4, b.SmartDedent(9))
+	assert.Equal(t, 4, b.SmartDedent(12))
+	assert.Equal(t, 4, b.SmartDedent(16))
+	// the def header can't be crossed
+	assert.Equal(t, -1, b.SmartDedent(18))
+	// not a keyword line
+	assert.Equal(t, -1, b.SmartDedent(3))
+
+	b.SetLineIndent(4, b.SmartDedent(4))
+	assert.Equal(t, "        else:", b.Line(4))
+	// once lined up it stays there
+	assert.Equal(t, 8, b.SmartDedent(4))
+
+	b.Settings["autoindent"] = false
+	assert.Equal(t, -1, b.SmartDedent(6))
+	b.Settings["autoindent"] = true
+	b.Settings["filetype"] = "go"
+	assert.Equal(t, -1, b.SmartDedent(6))
+
+	b.Close()
+}
+
+func TestSetLineIndent(t *testing.T) {
+	b := NewBufferFromString("\t\t  x", "", BTDefault)
+	b.Settings["tabsize"] = float64(4)
+
+	b.SetLineIndent(0, 6)
+	assert.Equal(t, "\t  x", b.Line(0))
+	b.Settings["tabstospaces"] = true
+	b.SetLineIndent(0, 2)
+	assert.Equal(t, "  x", b.Line(0))
+
+	b.Close()
+}
@@ -32,6 +32,9 @@ type TextEvent struct {
 	EventType int
 	Deltas    []Delta
 	Time      time.Time
+	// Backward is set for removals made with the cursor after the removed
+	// text, as with backspace
+	Backward bool
 }
 
 // A Delta is a change to the buffer
@@ -42,7 +45,12 @@ type Delta struct {
 }
 
 // DoTextEvent runs a text event
+// Events that would modify a protected line range are ignored
 func (eh *EventHandler) DoTextEvent(t *TextEvent, useUndo bool) {
+	if eh.buf.touchesProtected(t) {
+		return
+	}
+
 	oldl := eh.buf.LinesNum()
 
 	if useUndo {
@@ -123,7 +131,7 @@ func ExecuteTextEvent(t *TextEvent, buf *SharedBuffer) {
 			t.Deltas[i].Text = buf.remove(d.Start, d.End)
 			buf.insert(d.Start, d.Text)
 			t.Deltas[i].Start = d.Start
-			t.Deltas[i].End = Loc{d.Start.X + utf8.RuneCount(d.Text), d.Start.Y}
+			t.Deltas[i].End = textEnd(d.Start, d.Text)
 		}
 		for i, j := 0, len(t.Deltas)-1; i < j; i, j = i+1, j-1 {
 			t.Deltas[i], t.Deltas[j] = t.Deltas[j], t.Deltas[i]
@@ -131,6 +139,16 @@ func ExecuteTextEvent(t *TextEvent, buf *SharedBuffer) {
 	}
 }
 
+// textEnd returns the location just after the given text once it has been
+// inserted at start
+func textEnd(start Loc, text []byte) Loc {
+	nl := bytes.Count(text, []byte{'\n'})
+	if nl == 0 {
+		return Loc{start.X + utf8.RuneCount(text), start.Y}
+	}
+	return Loc{utf8.RuneCount(text[bytes.LastIndexByte(text, '\n')+1:]), start.Y + nl}
+}
+
 // UndoTextEvent undoes a text event
 func (eh *EventHandler) UndoTextEvent(t *TextEvent) {
 	t.EventType = -t.EventType
@@ -144,6 +162,9 @@ type EventHandler struct {
 	active    int
 	UndoStack *TEStack
 	RedoStack *TEStack
+
+	// the edit that Buffer.RepeatLastEdit makes again
+	lastEdit lastEdit
 }
 
 // NewEventHandler returns a new EventHandler
@@ -199,6 +220,16 @@ func (eh *EventHandler) InsertBytes(start Loc, text []byte) {
 
 // Remove creates a remove text event and executes it
 func (eh *EventHandler) Remove(start, end Loc) {
+	eh.remove(start, end, false)
+}
+
+// RemoveBackward creates a remove text event like Remove, for removals
+// made with the cursor after the removed text such as backspace
+func (eh *EventHandler) RemoveBackward(start, end Loc) {
+	eh.remove(start, end, true)
+}
+
+func (eh *EventHandler) remove(start, end Loc, backward bool) {
 	if start == end {
 		return
 	}
@@ -209,25 +240,75 @@ func (eh *EventHandler) Remove(start, end Loc) {
 		EventType: TextEventRemove,
 		Deltas:    []Delta{{[]byte{}, start, end}},
 		Time:      time.Now(),
+		Backward:  backward,
 	}
 	eh.DoTextEvent(e, true)
 }
 
 // MultipleReplace creates an multiple insertions executes them
+// The deltas are applied in order as a single undoable event, so any
+// delta that comes later in the buffer than another should come first
+// in the list, which keeps all locations valid without adjusting them
 func (eh *EventHandler) MultipleReplace(deltas []Delta) {
+	eh.replace(deltas)
+}
+
+// replace executes a replace event for the deltas and returns false if it
+// was ignored because it touches a protected line range
+func (eh *EventHandler) replace(deltas []Delta) bool {
 	e := &TextEvent{
 		C:         *eh.cursors[eh.active],
 		EventType: TextEventReplace,
 		Deltas:    deltas,
 		Time:      time.Now(),
 	}
+	if eh.buf.touchesProtected(e) {
+		return false
+	}
 	eh.Execute(e)
+	return true
+}
+
+// ReplaceRange replaces the text from start to end with text as a single
+// undoable event, and moves the cursors the same way as removing the range
+// and then inserting the text would
+// It returns the location just after the new text, where a cursor at the
+// end of the range ends up, or end if nothing was replaced
+func (eh *EventHandler) ReplaceRange(start, end Loc, text string) Loc {
+	if end.LessThan(start) {
+		start, end = end, start
+	}
+	t := []byte(text)
+	if !eh.replace([]Delta{{t, start, end}}) {
+		return end
+	}
+	newEnd := textEnd(start, t)
+
+	move := func(loc Loc) Loc {
+		if loc.LessThan(start) {
+			return loc
+		} else if loc.LessThan(end) {
+			return newEnd
+		} else if loc.Y == end.Y {
+			return Loc{loc.X - end.X + newEnd.X, newEnd.Y}
+		}
+		return Loc{loc.X, loc.Y - end.Y + newEnd.Y}
+	}
+	for _, c := range eh.cursors {
+		c.Loc = move(c.Loc)
+		c.CurSelection[0] = move(c.CurSelection[0])
+		c.CurSelection[1] = move(c.CurSelection[1])
+		c.OrigSelection[0] = move(c.OrigSelection[0])
+		c.OrigSelection[1] = move(c.OrigSelection[1])
+		c.Relocate()
+		c.LastVisualX = c.GetVisualX()
+	}
+	return newEnd
 }
 
 // Replace deletes from start to end and replaces it with the given string
 func (eh *EventHandler) Replace(start, end Loc, replace string) {
-	eh.Remove(start, end)
-	eh.Insert(start, replace)
+	eh.ReplaceRange(start, end, replace)
 }
 
 // Execute a textevent and add it to the undo stack
@@ -246,6 +327,7 @@ func (eh *EventHandler) Execute(t *TextEvent) {
 		return
 	}
 
+	eh.lastEdit.record(t, eh.buf.LineArray)
 	ExecuteTextEvent(t, eh.buf)
 }
 
@@ -269,18 +351,23 @@ func (eh *EventHandler) Undo() {
 			return
 		}
 
-		eh.UndoOneEvent()
+		if !eh.UndoOneEvent() {
+			return
+		}
 	}
 }
 
-// UndoOneEvent undoes one event
-func (eh *EventHandler) UndoOneEvent() {
+// UndoOneEvent undoes one event and returns whether it did
+// An event whose undo would modify a protected line is left on the undo
+// stack, so that the history still matches the text
+func (eh *EventHandler) UndoOneEvent() bool {
+	t := eh.UndoStack.Peek()
+	if t == nil || eh.buf.undoTouchesProtected(t) {
+		return false
+	}
 	// This event should be undone
 	// Pop it off the stack
-	t := eh.UndoStack.Pop()
-	if t == nil {
-		return
-	}
+	eh.UndoStack.Pop()
 	// Undo it
 	// Modifies the text event
 	eh.UndoTextEvent(t)
@@ -296,6 +383,7 @@ func (eh *EventHandler) UndoOneEvent() {
 
 	// Push it to the redo stack
 	eh.RedoStack.Push(t)
+	return true
 }
 
 // Redo the first event in the redo stack
@@ -318,16 +406,21 @@ func (eh *EventHandler) Redo() {
 			return
 		}
 
-		eh.RedoOneEvent()
+		if !eh.RedoOneEvent() {
+			return
+		}
 	}
 }
 
-// RedoOneEvent redoes one event
-func (eh *EventHandler) RedoOneEvent() {
-	t := eh.RedoStack.Pop()
-	if t == nil {
-		return
+// RedoOneEvent redoes one event and returns whether it did
+// Like undo, an event that would modify a protected line stays on the
+// redo stack
+func (eh *EventHandler) RedoOneEvent() bool {
+	t := eh.RedoStack.Peek()
+	if t == nil || eh.buf.undoTouchesProtected(t) {
+		return false
 	}
+	eh.RedoStack.Pop()
 
 	teCursor := t.C
 	if teCursor.Num >= 0 && teCursor.Num < len(eh.cursors) {
@@ -341,4 +434,5 @@ func (eh *EventHandler) RedoOneEvent() {
 	eh.UndoTextEvent(t)
 
 	eh.UndoStack.Push(t)
+	return true
 }
@@ -0,0 +1,61 @@
+package buffer
+
+import (
+	"crypto/md5"
+	"os"
+)
+
+// An ExternalChange is a way in which the file of a buffer was changed on
+// disk by another program
+type ExternalChange int
+
+const (
+	// ChangeNone means that the file did not change
+	ChangeNone ExternalChange = iota
+	// ChangeModified means that the file was written to
+	ChangeModified
+	// ChangeDeleted means that the file no longer exists, or that it was
+	// replaced by something that is not a regular file such as a directory
+	ChangeDeleted
+	// ChangeTruncated means that the file was emptied while the buffer is
+	// not empty, which can be another program truncating it by mistake
+	ChangeTruncated
+)
+
+// ExternalChange returns how the file being edited changed since it was
+// last opened, saved or checked with UpdateModTime
+// A file that did not exist then is not reported as deleted
+func (b *Buffer) ExternalChange() ExternalChange {
+	if b.Path == "" {
+		return ChangeNone
+	}
+	info, err := fsFor(b.Path).Stat(b.Path)
+	if err != nil {
+		if os.IsNotExist(err) && b.onDisk {
+			return ChangeDeleted
+		}
+		return ChangeNone
+	}
+	if !info.Mode().IsRegular() {
+		if b.onDisk {
+			return ChangeDeleted
+		}
+		return ChangeNone
+	}
+	if info.ModTime() == b.ModTime {
+		return ChangeNone
+	}
+	if info.Size() == 0 && b.End() != b.Start() {
+		return ChangeTruncated
+	}
+	return ChangeModified
+}
+
+// ForceModified makes the buffer count as modified until it is saved, for
+// when its file on disk no longer has the buffer's contents
+func (b *Buffer) ForceModified() {
+	b.isModified = true
+	b.origHash = [md5.Size]byte{}
+	b.hashedEdits = b.edits
+	b.hashModified = true
+}
@@ -0,0 +1,61 @@
+package buffer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExternalChange(t *testing.T) {
+	dir, err := ioutil.TempDir("", "micro-extchange")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "test.txt")
+	ioutil.WriteFile(name, []byte("text\n"), 0644)
+	b := NewBufferFromString("text\n", name, BTDefault)
+	defer b.Close()
+	assert.Equal(t, ChangeNone, b.ExternalChange())
+
+	later := time.Now().Add(time.Minute)
+	ioutil.WriteFile(name, []byte("other text\n"), 0644)
+	os.Chtimes(name, later, later)
+	assert.Equal(t, ChangeModified, b.ExternalChange())
+	assert.True(t, b.ExternallyModified())
+
+	later = later.Add(time.Minute)
+	ioutil.WriteFile(name, nil, 0644)
+	os.Chtimes(name, later, later)
+	assert.Equal(t, ChangeTruncated, b.ExternalChange())
+
+	os.Remove(name)
+	assert.Equal(t, ChangeDeleted, b.ExternalChange())
+	os.Mkdir(name, 0755)
+	assert.Equal(t, ChangeDeleted, b.ExternalChange())
+
+	// once acknowledged, the missing file is not reported again
+	os.Remove(name)
+	b.UpdateModTime()
+	assert.Equal(t, ChangeNone, b.ExternalChange())
+	assert.False(t, b.Modified())
+	b.ForceModified()
+	assert.True(t, b.Modified())
+}
+
+func TestExternalChangeNewFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "micro-extchange")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	b := NewBufferFromString("", filepath.Join(dir, "new.txt"), BTDefault)
+	defer b.Close()
+	assert.Equal(t, ChangeNone, b.ExternalChange())
+}
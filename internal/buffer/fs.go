@@ -0,0 +1,83 @@
+package buffer
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/zyedidia/micro/internal/remote"
+)
+
+// A fileSystem reads and writes the files of buffers, either on the local
+// disk or on another machine
+type fileSystem interface {
+	Open(name string) (io.ReadCloser, error)
+	// Create opens the file for writing, truncating it if it exists
+	Create(name string) (io.WriteCloser, error)
+	Stat(name string) (os.FileInfo, error)
+}
+
+type localFS struct{}
+
+func (localFS) Open(name string) (io.ReadCloser, error) {
+	return os.Open(name)
+}
+
+func (localFS) Create(name string) (io.WriteCloser, error) {
+	return os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+}
+
+func (localFS) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+type remoteFS struct{}
+
+func (remoteFS) Open(name string) (io.ReadCloser, error) {
+	return remote.Open(name)
+}
+
+func (remoteFS) Create(name string) (io.WriteCloser, error) {
+	return remote.Create(name)
+}
+
+func (remoteFS) Stat(name string) (os.FileInfo, error) {
+	return remote.Stat(name)
+}
+
+// remoteFiles holds the files with paths such as ssh://host/path
+var remoteFiles fileSystem = remoteFS{}
+
+// fsFor returns the file system that holds the given file
+func fsFor(name string) fileSystem {
+	if remote.IsRemote(name) {
+		return remoteFiles
+	}
+	return localFS{}
+}
+
+// absolutePath returns the absolute path of the given file, which remote
+// paths already are
+func absolutePath(name string) string {
+	if remote.IsRemote(name) {
+		return name
+	}
+	abs, _ := filepath.Abs(name)
+	return abs
+}
+
+// modTime returns the modification time of the given file, or the current
+// time if it cannot be read
+func modTime(name string) (time.Time, error) {
+	info, err := fsFor(name).Stat(name)
+	if err != nil {
+		return time.Now(), err
+	}
+	return info.ModTime(), nil
+}
+
+// IsRemote returns whether the buffer's file is on another machine
+func (b *Buffer) IsRemote() bool {
+	return remote.IsRemote(b.Path)
+}
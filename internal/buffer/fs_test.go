@@ -0,0 +1,98 @@
+package buffer
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memFS keeps files in memory in place of a remote machine
+type memFS struct {
+	files map[string][]byte
+	times map[string]time.Time
+}
+
+type memWriter struct {
+	bytes.Buffer
+	fs   *memFS
+	name string
+}
+
+func (w *memWriter) Close() error {
+	w.fs.files[w.name] = w.Bytes()
+	w.fs.times[w.name] = w.fs.times[w.name].Add(time.Second)
+	return nil
+}
+
+type memInfo struct {
+	os.FileInfo
+	size    int64
+	modTime time.Time
+}
+
+func (i memInfo) Size() int64        { return i.size }
+func (i memInfo) ModTime() time.Time { return i.modTime }
+func (i memInfo) IsDir() bool        { return false }
+func (i memInfo) Mode() os.FileMode  { return 0644 }
+
+func (fs *memFS) Open(name string) (io.ReadCloser, error) {
+	data, ok := fs.files[name]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (fs *memFS) Create(name string) (io.WriteCloser, error) {
+	return &memWriter{fs: fs, name: name}, nil
+}
+
+func (fs *memFS) Stat(name string) (os.FileInfo, error) {
+	data, ok := fs.files[name]
+	if !ok {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
+	return memInfo{size: int64(len(data)), modTime: fs.times[name]}, nil
+}
+
+func TestRemoteFile(t *testing.T) {
+	name := "ssh://me@example.com/home/me/notes.txt"
+	fs := &memFS{
+		files: map[string][]byte{name: []byte("one\ntwo\n")},
+		times: map[string]time.Time{name: time.Unix(1000, 0)},
+	}
+	defer func(old fileSystem) { remoteFiles = old }(remoteFiles)
+	remoteFiles = fs
+
+	b, err := NewBufferFromFile(name, BTDefault, nil)
+	assert.NoError(t, err)
+	defer b.Close()
+	b.Settings["backup"] = false
+	assert.Equal(t, "one\ntwo\n", string(b.Bytes()))
+	assert.Equal(t, name, b.AbsPath)
+	assert.True(t, b.IsRemote())
+	assert.Equal(t, ChangeNone, b.ExternalChange())
+
+	b.Insert(Loc{0, 0}, "zero\n")
+	assert.NoError(t, b.Save())
+	assert.Equal(t, "zero\none\ntwo\n", string(fs.files[name]))
+	assert.Equal(t, ChangeNone, b.ExternalChange())
+	assert.False(t, b.Modified())
+
+	fs.files[name] = []byte("changed\n")
+	fs.times[name] = fs.times[name].Add(time.Minute)
+	assert.Equal(t, ChangeModified, b.ExternalChange())
+	assert.Equal(t, ErrChangedOnDisk, b.Save())
+	assert.NoError(t, b.Reload())
+	assert.Equal(t, "changed\n", string(b.Bytes()))
+
+	missing, err := NewBufferFromFile("ssh://me@example.com/new.txt", BTDefault, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "", string(missing.Bytes()))
+	missing.Close()
+}
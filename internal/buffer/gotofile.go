@@ -0,0 +1,174 @@
+package buffer
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"unicode"
+
+	"github.com/zyedidia/micro/internal/util"
+)
+
+// isPathChar returns whether the rune can be part of a file path, including
+// a :line:col suffix
+func isPathChar(r rune) bool {
+	if unicode.IsLetter(r) || unicode.IsDigit(r) {
+		return true
+	}
+	switch r {
+	case '/', '.', '_', '-', '~', '+', ':', '@', '%':
+		return true
+	case '\\':
+		return runtime.GOOS == "windows"
+	}
+	return false
+}
+
+// PathUnderCursor returns the file path under the cursor, along with a
+// :line or :line:col suffix if there is one
+// It returns an empty string if there is no path under the cursor
+func (b *Buffer) PathUnderCursor(c *Cursor) string {
+	line := []rune(string(b.LineBytes(c.Y)))
+	x := util.Clamp(c.X, 0, len(line))
+	if x == len(line) || !isPathChar(line[x]) {
+		if x == 0 || !isPathChar(line[x-1]) {
+			return ""
+		}
+		x--
+	}
+
+	start, end := x, x
+	for start > 0 && isPathChar(line[start-1]) {
+		start--
+	}
+	for end < len(line) && isPathChar(line[end]) {
+		end++
+	}
+
+	// punctuation that ends a sentence is not part of the path
+	return strings.TrimRight(string(line[start:end]), ".:")
+}
+
+// ResolvePath finds the file that the given path refers to
+// Relative paths are looked up in the buffer's directory first and then
+// in each directory of the `gfpath` option, which are themselves relative
+// to the buffer's directory unless they are absolute
+// A :line:col suffix is kept on the returned path
+func (b *Buffer) ResolvePath(path string) (string, bool) {
+	name, cursorPos := util.GetPathAndCursorPosition(path)
+	name, err := util.ReplaceHome(name)
+	if err != nil || name == "" {
+		return "", false
+	}
+
+	var candidates []string
+	if filepath.IsAbs(name) {
+		candidates = append(candidates, name)
+	} else {
+		base := "."
+		if b.AbsPath != "" {
+			base = filepath.Dir(b.AbsPath)
+		}
+		candidates = append(candidates, filepath.Join(base, name))
+
+		gfpath, _ := b.Settings["gfpath"].(string)
+		for _, dir := range strings.Split(gfpath, ",") {
+			dir = strings.TrimSpace(dir)
+			if dir == "" {
+				continue
+			}
+			dir, err = util.ReplaceHome(dir)
+			if err != nil {
+				continue
+			}
+			if !filepath.IsAbs(dir) {
+				dir = filepath.Join(base, dir)
+			}
+			candidates = append(candidates, filepath.Join(dir, name))
+		}
+	}
+
+	for _, c := range candidates {
+		if info, err := os.Stat(c); err == nil && !info.IsDir() {
+			if cursorPos != nil {
+				c += ":" + strings.Join(cursorPos, ":")
+			}
+			return c, true
+		}
+	}
+	return "", false
+}
+
+// ConvertPaths rewrites the file paths in the lines from start to end
+// (inclusive) to be absolute, or relative to base, as a single undoable edit
+// Relative paths are taken to be relative to base, which defaults to the
+// buffer's directory; only words containing a path separator count as
+// paths, and URLs are left alone
+// It returns the number of paths that were rewritten
+func (b *Buffer) ConvertPaths(start, end int, toAbsolute bool, base string) int {
+	if start > end {
+		start, end = end, start
+	}
+	if base == "" {
+		base = "."
+		if b.AbsPath != "" {
+			base = filepath.Dir(b.AbsPath)
+		}
+	}
+	base, err := filepath.Abs(base)
+	if err != nil {
+		return 0
+	}
+
+	var deltas []Delta
+	for i := end; i >= start; i-- {
+		line := []rune(string(b.LineBytes(i)))
+		// words are collected left to right and replaced right to left
+		var words [][2]int
+		for x := 0; x < len(line); {
+			if !isPathChar(line[x]) {
+				x++
+				continue
+			}
+			wstart := x
+			for x < len(line) && isPathChar(line[x]) {
+				x++
+			}
+			// punctuation that ends a sentence is not part of the path
+			wend := x
+			for wend > wstart && (line[wend-1] == '.' || line[wend-1] == ':') {
+				wend--
+			}
+			words = append(words, [2]int{wstart, wend})
+		}
+
+		for j := len(words) - 1; j >= 0; j-- {
+			w := words[j]
+			path := string(line[w[0]:w[1]])
+			if !strings.ContainsRune(path, '/') && !strings.ContainsRune(path, filepath.Separator) {
+				continue
+			}
+			if strings.Contains(path, "://") || strings.HasPrefix(path, "~") {
+				continue
+			}
+
+			var converted string
+			if toAbsolute && !filepath.IsAbs(path) {
+				converted = filepath.Join(base, path)
+			} else if !toAbsolute && filepath.IsAbs(path) {
+				converted, err = filepath.Rel(base, path)
+				if err != nil {
+					continue
+				}
+			} else {
+				continue
+			}
+			deltas = append(deltas, Delta{[]byte(converted), Loc{w[0], i}, Loc{w[1], i}})
+		}
+	}
+	if len(deltas) > 0 {
+		b.MultipleReplace(deltas)
+	}
+	return len(deltas)
+}
@@ -0,0 +1,91 @@
+package buffer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPathUnderCursor(t *testing.T) {
+	b := NewBufferFromString(`see "src/main.go:12:3", or ../README.md.`, "", BTDefault)
+	c := b.GetActiveCursor()
+
+	c.Loc = Loc{8, 0}
+	assert.Equal(t, "src/main.go:12:3", b.PathUnderCursor(c))
+	c.Loc = Loc{5, 0}
+	assert.Equal(t, "src/main.go:12:3", b.PathUnderCursor(c))
+	c.Loc = Loc{30, 0}
+	assert.Equal(t, "../README.md", b.PathUnderCursor(c))
+	// just after the path
+	c.Loc = Loc{21, 0}
+	assert.Equal(t, "src/main.go:12:3", b.PathUnderCursor(c))
+	c.Loc = Loc{23, 0}
+	assert.Equal(t, "", b.PathUnderCursor(c))
+
+	b.Close()
+}
+
+func TestResolvePath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "micro-gf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.MkdirAll(filepath.Join(dir, "src"), os.ModePerm)
+	os.MkdirAll(filepath.Join(dir, "include"), os.ModePerm)
+	ioutil.WriteFile(filepath.Join(dir, "src", "main.go"), []byte{}, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "include", "util.h"), []byte{}, 0644)
+
+	b := NewBufferFromString("", filepath.Join(dir, "notes.txt"), BTDefault)
+
+	path, ok := b.ResolvePath("src/main.go")
+	assert.True(t, ok)
+	assert.Equal(t, filepath.Join(dir, "src", "main.go"), path)
+
+	path, ok = b.ResolvePath("src/main.go:12")
+	assert.True(t, ok)
+	assert.Equal(t, filepath.Join(dir, "src", "main.go")+":12:0", path)
+
+	_, ok = b.ResolvePath("util.h")
+	assert.False(t, ok)
+	b.Settings["gfpath"] = "src, include"
+	path, ok = b.ResolvePath("util.h")
+	assert.True(t, ok)
+	assert.Equal(t, filepath.Join(dir, "include", "util.h"), path)
+
+	path, ok = b.ResolvePath(filepath.Join(dir, "src", "main.go"))
+	assert.True(t, ok)
+	assert.Equal(t, filepath.Join(dir, "src", "main.go"), path)
+
+	// directories are not files
+	_, ok = b.ResolvePath("src")
+	assert.False(t, ok)
+
+	b.Close()
+}
+
+func TestConvertPaths(t *testing.T) {
+	base := filepath.FromSlash("/home/user/project")
+	b := NewBufferFromString("include = src/main.go, lib/util.go:12\nurl = https://example.com/a\nname = plain", "", BTDefault)
+
+	assert.Equal(t, 2, b.ConvertPaths(0, 2, true, base))
+	main := filepath.Join(base, "src", "main.go")
+	util := filepath.Join(base, "lib", "util.go") + ":12"
+	assert.Equal(t, "include = "+main+", "+util+"\nurl = https://example.com/a\nname = plain", string(b.Bytes()))
+
+	// absolute paths are left alone when converting to absolute
+	assert.Equal(t, 0, b.ConvertPaths(0, 0, true, base))
+
+	assert.Equal(t, 2, b.ConvertPaths(0, 0, false, filepath.Join(base, "src")))
+	assert.Equal(t, "include = main.go, "+filepath.Join("..", "lib", "util.go")+":12\nurl = https://example.com/a\nname = plain", string(b.Bytes()))
+
+	b.UndoOneEvent()
+	b.UndoOneEvent()
+	assert.Equal(t, "include = src/main.go, lib/util.go:12\nurl = https://example.com/a\nname = plain", string(b.Bytes()))
+
+	b.Close()
+}
@@ -0,0 +1,118 @@
+package buffer
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/zyedidia/micro/internal/util"
+)
+
+// A Heading is an entry in the table of contents of a buffer
+type Heading struct {
+	// Level is 1 for top level headings and increases for nested ones
+	Level int
+	Text  string
+	Line  int
+}
+
+// headingPatterns are the builtin patterns that match headings for
+// filetypes whose headingpattern option is empty
+var headingPatterns = map[string]string{
+	"markdown": `^(?P<level>#{1,6})\s+(?P<text>.*?)[\s#]*$`,
+	"go":       `^(?:func\s+(?:\([^)]*\)\s*)?|type\s+)(?P<text>\w+)`,
+	"python":   `^\s*(?:async\s+)?(?:def|class)\s+(?P<text>\w+)`,
+	"python2":  `^\s*(?:def|class)\s+(?P<text>\w+)`,
+	"lua":      `^\s*(?:local\s+)?function\s+(?P<text>[\w.:]+)`,
+	"shell":    `^\s*(?:function\s+)?(?P<text>[\w-]+)\s*\(\)`,
+	"rust":     `^\s*(?:pub(?:\([^)]*\))?\s+)?(?:fn|struct|enum|trait|impl|mod)\s+(?P<text>\w+)`,
+}
+
+// headingRegex returns the regular expression that matches headings in
+// this buffer, or nil if there is none
+func (b *Buffer) headingRegex() *regexp.Regexp {
+	pattern, _ := b.Settings["headingpattern"].(string)
+	if pattern == "" {
+		pattern = headingPatterns[b.FileType()]
+	}
+	if pattern == "" {
+		return nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil
+	}
+	return re
+}
+
+// subexpIndex returns the index of the named group in re, or -1
+func subexpIndex(re *regexp.Regexp, name string) int {
+	for i, n := range re.SubexpNames() {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Headings returns the table of contents of the buffer: the lines that
+// match the headingpattern option, or the builtin pattern for the
+// filetype if the option is empty
+// The text of a heading is the pattern's `text` group, or the whole
+// match, and its level is the length of the `level` group, such as the
+// number of # in Markdown, or otherwise one more than the indentation
+// depth of the line
+func (b *Buffer) Headings() []Heading {
+	re := b.headingRegex()
+	if re == nil {
+		return nil
+	}
+	levelGroup := subexpIndex(re, "level")
+	textGroup := subexpIndex(re, "text")
+
+	_, unit := b.IndentUnit()
+	tabsize := util.IntOpt(b.Settings["tabsize"])
+	markdown := b.FileType() == "markdown"
+	fenced := false
+
+	var headings []Heading
+	for i := 0; i < b.LinesNum(); i++ {
+		l := b.LineBytes(i)
+		// # starts a comment rather than a heading in a code block
+		if markdown {
+			trimmed := bytes.TrimLeft(l, " \t")
+			if bytes.HasPrefix(trimmed, []byte("```")) || bytes.HasPrefix(trimmed, []byte("~~~")) {
+				fenced = !fenced
+			}
+			if fenced {
+				continue
+			}
+		}
+
+		m := re.FindSubmatchIndex(l)
+		if m == nil {
+			continue
+		}
+
+		text := l[m[0]:m[1]]
+		if textGroup >= 0 && m[2*textGroup] >= 0 {
+			text = l[m[2*textGroup]:m[2*textGroup+1]]
+		}
+
+		level := 1
+		if levelGroup >= 0 && m[2*levelGroup] >= 0 {
+			level = utf8.RuneCount(l[m[2*levelGroup]:m[2*levelGroup+1]])
+		} else if unit > 0 {
+			ws := util.GetLeadingWhitespace(l)
+			level += util.StringWidth(ws, utf8.RuneCount(ws), tabsize) / unit
+		}
+
+		headings = append(headings, Heading{
+			Level: level,
+			Text:  strings.TrimSpace(string(text)),
+			Line:  i,
+		})
+	}
+	return headings
+}
@@ -0,0 +1,61 @@
+package buffer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const tocMarkdown = `# Title
+
+Some text.
+
+## Install
+
+### From source ###
+
+` + "```sh" + `
+# not a heading
+make install
+` + "```" + `
+
+## Usage
+#hashtag is not a heading either
+
+####### too deep
+`
+
+func TestHeadingsMarkdown(t *testing.T) {
+	b := NewBufferFromString(tocMarkdown, "README.md", BTDefault)
+	b.Settings["filetype"] = "markdown"
+
+	assert.Equal(t, []Heading{
+		{1, "Title", 0},
+		{2, "Install", 4},
+		{3, "From source", 6},
+		{2, "Usage", 13},
+	}, b.Headings())
+
+	b.Close()
+}
+
+func TestHeadingsPattern(t *testing.T) {
+	b := NewBufferFromString("class A:\n    def f(self):\n        pass\n\ndef g():\n    pass\n", "", BTDefault)
+	b.Settings["filetype"] = "python"
+
+	assert.Equal(t, []Heading{
+		{1, "A", 0},
+		{2, "f", 1},
+		{1, "g", 4},
+	}, b.Headings())
+
+	// the option takes precedence over the builtin pattern
+	b.Settings["headingpattern"] = `^class (?P<text>\w+)`
+	assert.Equal(t, []Heading{{1, "A", 0}}, b.Headings())
+
+	b.Settings["filetype"] = "unknown"
+	b.Settings["headingpattern"] = ""
+	assert.Empty(t, b.Headings())
+
+	b.Close()
+}
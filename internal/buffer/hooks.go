@@ -0,0 +1,50 @@
+package buffer
+
+import (
+	"errors"
+
+	luar "layeh.com/gopher-luar"
+
+	"github.com/zyedidia/micro/internal/config"
+	ulua "github.com/zyedidia/micro/internal/lua"
+	"github.com/zyedidia/micro/internal/screen"
+)
+
+// ErrSaveCanceled is returned when a plugin cancels a save from its
+// preBufferSave callback
+var ErrSaveCanceled = errors.New("Save canceled by a plugin")
+
+// preSaveHook runs the preBufferSave callback of the plugins, which can
+// change the buffer before it is written, and returns false if one of them
+// canceled the save
+// A plugin that fails does not keep the buffer from being saved
+func (b *Buffer) preSaveHook() bool {
+	ok, err := config.RunPluginFnBool("preBufferSave", luar.New(ulua.L, b))
+	if err != nil {
+		screen.TermMessage(err)
+	}
+	return ok
+}
+
+// saveHook runs the onBufferSave callback of the plugins after the buffer
+// was written
+func (b *Buffer) saveHook() {
+	if err := config.RunPluginFn("onBufferSave", luar.New(ulua.L, b)); err != nil {
+		screen.TermMessage(err)
+	}
+}
+
+// editHook runs the onBufferEdit callback of the plugins after the text of
+// the buffer was changed
+// Edits that the callbacks make themselves do not run it again
+func (b *Buffer) editHook() {
+	if b.inEditHook {
+		return
+	}
+	b.inEditHook = true
+	defer func() { b.inEditHook = false }()
+
+	if err := config.RunPluginFn("onBufferEdit", luar.New(ulua.L, b)); err != nil {
+		screen.TermMessage(err)
+	}
+}
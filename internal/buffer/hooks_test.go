@@ -0,0 +1,87 @@
+package buffer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	lua "github.com/yuin/gopher-lua"
+	"github.com/zyedidia/micro/internal/config"
+	ulua "github.com/zyedidia/micro/internal/lua"
+)
+
+const hooksPlugin = `
+cancel = false
+saved = 0
+edits = 0
+
+function preBufferSave(buf)
+	if cancel then
+		return false
+	end
+	buf:Insert(buf:Start(), "-- header\n")
+end
+
+function onBufferSave(buf)
+	saved = saved + 1
+end
+
+function onBufferEdit(buf)
+	edits = edits + 1
+	buf:Insert(buf:End(), "")
+end
+`
+
+// loadHooksPlugin loads a plugin with the buffer callbacks and returns a
+// function that removes it again
+func loadHooksPlugin(t *testing.T) func() {
+	if err := ulua.LoadFile("testhooks", "testhooks.lua", []byte(hooksPlugin)); err != nil {
+		t.Fatal(err)
+	}
+	plugins := config.Plugins
+	config.Plugins = []*config.Plugin{{Name: "testhooks", Loaded: true}}
+	return func() { config.Plugins = plugins }
+}
+
+func hookNumber(name string) int {
+	return int(ulua.L.GetField(ulua.L.GetGlobal("testhooks"), name).(lua.LNumber))
+}
+
+func TestSaveHooks(t *testing.T) {
+	defer loadHooksPlugin(t)()
+
+	dir, err := ioutil.TempDir("", "micro-hooks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "file.lua")
+
+	b := NewBufferFromString("print(1)\n", "", BTDefault)
+	b.Settings["backup"] = false
+	assert.NoError(t, b.SaveAs(name))
+	data, err := ioutil.ReadFile(name)
+	assert.NoError(t, err)
+	assert.Equal(t, "-- header\nprint(1)\n", string(data))
+	assert.Equal(t, 1, hookNumber("saved"))
+
+	ulua.L.SetField(ulua.L.GetGlobal("testhooks"), "cancel", lua.LTrue)
+	b.Insert(b.End(), "print(2)\n")
+	assert.Equal(t, ErrSaveCanceled, b.Save())
+	assert.True(t, b.Modified())
+	assert.Equal(t, 1, hookNumber("saved"))
+}
+
+func TestEditHook(t *testing.T) {
+	defer loadHooksPlugin(t)()
+
+	b := NewBufferFromString("abc", "", BTDefault)
+	b.Insert(Loc{3, 0}, "d")
+	b.Remove(Loc{0, 0}, Loc{1, 0})
+	b.ReplaceRange(Loc{0, 0}, Loc{1, 0}, "x")
+	// the edit made by the callback itself does not count
+	assert.Equal(t, 3, hookNumber("edits"))
+	assert.Equal(t, "xcd", string(b.Bytes()))
+}
@@ -0,0 +1,97 @@
+package buffer
+
+import (
+	"bytes"
+
+	"github.com/zyedidia/micro/internal/config"
+	"github.com/zyedidia/micro/internal/util"
+)
+
+// indentDetectLines is the number of lines that DetectIndent looks at
+const indentDetectLines = 1000
+
+// DetectIndent guesses how the buffer is indented from its first lines
+// It returns "tab" or "space" and, for spaces, the most common step
+// between the indentation of consecutive lines
+// The last value is false if there is not enough indentation to tell
+func (b *Buffer) DetectIndent() (string, int, bool) {
+	tabs, spaces := 0, 0
+	steps := make(map[int]int)
+	prev := 0
+	for i := 0; i < b.LinesNum() && i < indentDetectLines; i++ {
+		l := b.LineBytes(i)
+		rest := bytes.TrimLeft(l, " \t")
+		// blank lines and the inside of /* */ comments say nothing
+		if len(rest) == 0 || rest[0] == '*' {
+			continue
+		}
+		ws := l[:len(l)-len(rest)]
+		if len(ws) > 0 && ws[0] == '\t' {
+			tabs++
+			continue
+		}
+		if bytes.IndexByte(ws, '\t') >= 0 {
+			continue
+		}
+		if len(ws) > 0 {
+			spaces++
+		}
+		// a step of one space is more likely alignment than indentation
+		d := len(ws) - prev
+		if d < 0 {
+			d = -d
+		}
+		if d > 1 {
+			steps[d]++
+		}
+		prev = len(ws)
+	}
+
+	if tabs == 0 && spaces == 0 {
+		return "", 0, false
+	}
+	if tabs >= spaces {
+		return "tab", util.IntOpt(b.Settings["tabsize"]), true
+	}
+
+	size, count := 0, 0
+	for s, n := range steps {
+		if n > count || (n == count && s < size) {
+			size, count = s, n
+		}
+	}
+	if size == 0 {
+		return "", 0, false
+	}
+	return "space", size, true
+}
+
+// IndentUnit returns the indentation style of the buffer, "tab" or
+// "space", and the size of one level of indentation, for instance to pass
+// on to an external formatter
+// If the tabstospaces or tabsize option has been changed from its default
+// value that is what is returned, otherwise the indentation is detected
+// from the buffer's text when possible
+func (b *Buffer) IndentUnit() (string, int) {
+	style := "tab"
+	if b.Settings["tabstospaces"].(bool) {
+		style = "space"
+	}
+	size := util.IntOpt(b.Settings["tabsize"])
+
+	if b.isDefaultOption("tabstospaces") && b.isDefaultOption("tabsize") {
+		if s, n, ok := b.DetectIndent(); ok {
+			return s, n
+		}
+	}
+	return style, size
+}
+
+// isDefaultOption returns whether the option still has its default value
+// and has not been set since the buffer was opened
+func (b *Buffer) isDefaultOption(option string) bool {
+	if b.setOptions[option] {
+		return false
+	}
+	return b.Settings[option] == config.DefaultCommonSettings()[option]
+}
@@ -0,0 +1,62 @@
+package buffer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectIndent(t *testing.T) {
+	b := NewBufferFromString("function f() {\n  if (x) {\n    /*\n     * y\n     */\n    g();\n  }\n}\n", "", BTDefault)
+	style, size, ok := b.DetectIndent()
+	assert.True(t, ok)
+	assert.Equal(t, "space", style)
+	assert.Equal(t, 2, size)
+	b.Close()
+
+	b = NewBufferFromString("func f() {\n\tif x {\n\t\ty()\n\t}\n}\n", "", BTDefault)
+	b.Settings["tabsize"] = float64(8)
+	style, size, ok = b.DetectIndent()
+	assert.True(t, ok)
+	assert.Equal(t, "tab", style)
+	assert.Equal(t, 8, size)
+	b.Close()
+
+	b = NewBufferFromString("no\nindentation\n", "", BTDefault)
+	_, _, ok = b.DetectIndent()
+	assert.False(t, ok)
+	b.Close()
+}
+
+func TestIndentUnit(t *testing.T) {
+	b := NewBufferFromString("a:\n    b:\n        c: 1\n    d: 2\n", "", BTDefault)
+
+	// detected when the options have their default values
+	style, size := b.IndentUnit()
+	assert.Equal(t, "space", style)
+	assert.Equal(t, 4, size)
+
+	// an option that was set explicitly wins
+	b.SetOptionNative("tabsize", float64(2))
+	style, size = b.IndentUnit()
+	assert.Equal(t, "tab", style)
+	assert.Equal(t, 2, size)
+
+	b.Close()
+
+	// as does one that differs from its default
+	b = NewBufferFromString("a:\n    b: 1\n", "", BTDefault)
+	b.Settings["tabstospaces"] = true
+	b.Settings["tabsize"] = float64(2)
+	style, size = b.IndentUnit()
+	assert.Equal(t, "space", style)
+	assert.Equal(t, 2, size)
+	b.Close()
+
+	// and no indentation falls back to the options
+	b = NewBufferFromString("a\nb\n", "", BTDefault)
+	style, size = b.IndentUnit()
+	assert.Equal(t, "tab", style)
+	assert.Equal(t, 4, size)
+	b.Close()
+}
@@ -0,0 +1,50 @@
+package buffer
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/zyedidia/micro/internal/util"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/transform"
+)
+
+// InsertFile inserts the contents of the file at path at loc as a single
+// undoable edit, decoded with the buffer's encoding and with its line
+// endings converted to the buffer's fileformat
+// A ~ at the start of path is expanded to the home directory
+// It returns the location just after the inserted text
+func (b *Buffer) InsertFile(loc Loc, path string) (Loc, error) {
+	path, err := util.ReplaceHome(path)
+	if err != nil {
+		return loc, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return loc, err
+	}
+	if info.IsDir() {
+		return loc, errors.New(path + " is a directory")
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return loc, err
+	}
+	enc, err := htmlindex.Get(b.Settings["encoding"].(string))
+	if err != nil {
+		return loc, err
+	}
+	if data, _, err = transform.Bytes(enc.NewDecoder(), data); err != nil {
+		return loc, err
+	}
+
+	// the lines of the buffer never end with \r, whatever its fileformat
+	text := strings.Replace(string(data), "\r\n", "\n", -1)
+	loc = clamp(loc, b.LineArray)
+	b.Insert(loc, text)
+	return loc.MoveLA(utf8.RuneCountInString(text), b.LineArray), nil
+}
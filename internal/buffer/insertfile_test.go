@@ -0,0 +1,39 @@
+package buffer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInsertFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "micro-insertfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "snippet.txt")
+	assert.NoError(t, ioutil.WriteFile(name, []byte("one\r\ntwo é\r\n"), 0644))
+
+	b := NewBufferFromString("ab\ncd", "", BTDefault)
+	end, err := b.InsertFile(Loc{1, 0}, name)
+	assert.NoError(t, err)
+	assert.Equal(t, Loc{0, 2}, end)
+	assert.Equal(t, "aone\ntwo é\nb\ncd", string(b.Bytes()))
+
+	// a single undo removes the whole file
+	b.UndoOneEvent()
+	assert.Equal(t, "ab\ncd", string(b.Bytes()))
+
+	_, err = b.InsertFile(Loc{0, 0}, dir)
+	assert.Error(t, err)
+	_, err = b.InsertFile(Loc{0, 0}, filepath.Join(dir, "missing"))
+	assert.True(t, os.IsNotExist(err))
+	assert.Equal(t, "ab\ncd", string(b.Bytes()))
+
+	b.Close()
+}
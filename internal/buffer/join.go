@@ -0,0 +1,164 @@
+package buffer
+
+import (
+	"bytes"
+	"regexp"
+	"unicode/utf8"
+
+	"github.com/zyedidia/micro/internal/util"
+)
+
+// JoinWithSeparator joins the lines from start to end (inclusive) into a
+// single line, putting sep between them, as a single undoable edit
+// Whitespace around every joined line is trimmed, except for the
+// indentation of the first line
+// It returns the location where the last line was joined, just before its
+// separator, which is where the cursor goes after a join
+func (b *Buffer) JoinWithSeparator(start, end int, sep string) Loc {
+	if start > end {
+		start, end = end, start
+	}
+	if start == end {
+		return Loc{utf8.RuneCount(b.LineBytes(start)), start}
+	}
+
+	parts := make([][]byte, 0, end-start+1)
+	for i := start; i <= end; i++ {
+		l := b.LineBytes(i)
+		if i == start {
+			l = bytes.TrimRight(l, " \t")
+		} else {
+			l = bytes.TrimSpace(l)
+		}
+		parts = append(parts, l)
+	}
+
+	joined := bytes.Join(parts, []byte(sep))
+	last := len(joined) - len(parts[len(parts)-1]) - len(sep)
+	endLoc := Loc{utf8.RuneCount(b.LineBytes(end)), end}
+	b.MultipleReplace([]Delta{{joined, Loc{0, start}, endLoc}})
+	return Loc{utf8.RuneCount(joined[:last]), start}
+}
+
+// JoinLines joins the lines from start to end (inclusive) into a single
+// line as a single undoable edit, with a space between them, or nothing if
+// the joinspace option is off, see JoinWithSeparator
+func (b *Buffer) JoinLines(start, end int) Loc {
+	sep := ""
+	if b.Settings["joinspace"].(bool) {
+		sep = " "
+	}
+	return b.JoinWithSeparator(start, end, sep)
+}
+
+// SqueezeBlankLinesAround replaces the run of blank lines around line y
+// with a single empty line, as a single undoable edit
+// It returns the number of lines removed, which is 0 if line y is not
+// blank
+func (b *Buffer) SqueezeBlankLinesAround(y int) int {
+	isBlank := func(i int) bool {
+		return len(bytes.TrimSpace(b.LineBytes(i))) == 0
+	}
+	if !isBlank(y) {
+		return 0
+	}
+
+	start, end := y, y
+	for start > 0 && isBlank(start-1) {
+		start--
+	}
+	for end < b.LinesNum()-1 && isBlank(end+1) {
+		end++
+	}
+
+	endLoc := Loc{utf8.RuneCount(b.LineBytes(end)), end}
+	if start == end && endLoc.X == 0 {
+		return 0
+	}
+	b.MultipleReplace([]Delta{{[]byte{}, Loc{0, start}, endLoc}})
+	return end - start
+}
+
+// SqueezeBlankLines replaces every run of two or more blank lines from
+// start to end (inclusive) with a single empty line, as a single undoable
+// edit
+// It returns the number of lines removed
+func (b *Buffer) SqueezeBlankLines(start, end int) int {
+	if start > end {
+		start, end = end, start
+	}
+	start = util.Max(start, 0)
+	end = util.Min(end, b.LinesNum()-1)
+
+	removed := 0
+	var deltas []Delta
+	for y := end; y >= start; y-- {
+		if !b.isBlankLine(y) {
+			continue
+		}
+		first := y
+		for first > start && b.isBlankLine(first-1) {
+			first--
+		}
+		if first < y {
+			endLoc := Loc{utf8.RuneCount(b.LineBytes(y)), y}
+			deltas = append(deltas, Delta{[]byte{}, Loc{0, first}, endLoc})
+			removed += y - first
+		}
+		y = first
+	}
+	if len(deltas) > 0 {
+		b.MultipleReplace(deltas)
+	}
+	return removed
+}
+
+// squeezableSpaces matches lines with whitespace between words that
+// SqueezeSpaces changes, and spaceRun the whitespace it replaces
+var (
+	squeezableSpaces = regexp.MustCompile(`\S(?:[ \t]*\t|  )[ \t]*\S`)
+	spaceRun         = regexp.MustCompile(`[ \t]+`)
+)
+
+// SqueezeSpaces replaces every run of spaces and tabs between the words of
+// the lines from start to end (inclusive) with a single space, as a single
+// undoable edit
+// The indentation and trailing whitespace of the lines are kept
+// It returns the number of lines that were changed
+func (b *Buffer) SqueezeSpaces(start, end int) int {
+	return b.EachLineMatchingInRange(start, end, squeezableSpaces, func(l string) string {
+		indent := len(util.GetLeadingWhitespace([]byte(l)))
+		body := bytes.TrimRight([]byte(l[indent:]), " \t")
+		trailing := l[indent+len(body):]
+		return l[:indent] + string(spaceRun.ReplaceAll(body, []byte{' '})) + trailing
+	})
+}
+
+// BreakLine splits the line at loc into two lines as a single undoable
+// edit, and indents the new line like the one that was split
+// Spaces and tabs around loc are removed, and a break inside the
+// indentation moves the whole line down instead
+// It returns the location of the start of the text after the break
+func (b *Buffer) BreakLine(loc Loc) Loc {
+	l := b.LineBytes(loc.Y)
+	line := []rune(string(l))
+	ws := util.GetLeadingWhitespace(l)
+	indent := utf8.RuneCount(ws)
+	x := util.Clamp(loc.X, 0, len(line))
+
+	if x <= indent {
+		b.MultipleReplace([]Delta{{[]byte{'\n'}, Loc{0, loc.Y}, Loc{0, loc.Y}}})
+		return Loc{indent, loc.Y + 1}
+	}
+
+	start, end := x, x
+	for start > indent && util.IsWhitespace(line[start-1]) {
+		start--
+	}
+	for end < len(line) && util.IsWhitespace(line[end]) {
+		end++
+	}
+	text := append([]byte{'\n'}, ws...)
+	b.MultipleReplace([]Delta{{text, Loc{start, loc.Y}, Loc{end, loc.Y}}})
+	return Loc{indent, loc.Y + 1}
+}
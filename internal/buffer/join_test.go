@@ -0,0 +1,120 @@
+package buffer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJoinWithSeparator(t *testing.T) {
+	b := NewBufferFromString("  a  \n\tb\n  c \nd", "", BTDefault)
+
+	assert.Equal(t, Loc{5, 0}, b.JoinWithSeparator(0, 2, ","))
+	assert.Equal(t, "  a,b,c\nd", string(b.Bytes()))
+
+	b.UndoOneEvent()
+	assert.Equal(t, "  a  \n\tb\n  c \nd", string(b.Bytes()))
+
+	b.JoinWithSeparator(3, 1, " -> ")
+	assert.Equal(t, "  a  \n\tb -> c -> d", string(b.Bytes()))
+
+	// a single line is left alone
+	b.JoinWithSeparator(0, 0, ",")
+	assert.Equal(t, "  a  \n\tb -> c -> d", string(b.Bytes()))
+
+	b.Close()
+}
+
+func TestJoinLines(t *testing.T) {
+	b := NewBufferFromString("a\n  bé \nc\nd", "", BTDefault)
+
+	assert.Equal(t, Loc{4, 0}, b.JoinLines(0, 2))
+	assert.Equal(t, "a bé c\nd", string(b.Bytes()))
+
+	// a single undo brings all the lines back
+	b.Undo()
+	assert.Equal(t, "a\n  bé \nc\nd", string(b.Bytes()))
+
+	b.Settings["joinspace"] = false
+	assert.Equal(t, Loc{1, 2}, b.JoinLines(2, 3))
+	assert.Equal(t, "a\n  bé \ncd", string(b.Bytes()))
+
+	b.Close()
+}
+
+func TestSqueezeBlankLinesAround(t *testing.T) {
+	b := NewBufferFromString("\n \n\na\n\n\t\n\nb\n\n", "", BTDefault)
+
+	// a non blank line is left alone
+	assert.Equal(t, 0, b.SqueezeBlankLinesAround(3))
+
+	assert.Equal(t, 2, b.SqueezeBlankLinesAround(5))
+	assert.Equal(t, "\n \n\na\n\nb\n\n", string(b.Bytes()))
+	b.UndoOneEvent()
+	assert.Equal(t, "\n \n\na\n\n\t\n\nb\n\n", string(b.Bytes()))
+	b.SqueezeBlankLinesAround(5)
+
+	// runs at the start and end of the buffer
+	assert.Equal(t, 2, b.SqueezeBlankLinesAround(0))
+	assert.Equal(t, "\na\n\nb\n\n", string(b.Bytes()))
+	assert.Equal(t, 1, b.SqueezeBlankLinesAround(5))
+	assert.Equal(t, "\na\n\nb\n", string(b.Bytes()))
+
+	// a single empty line has nothing to squeeze
+	assert.Equal(t, 0, b.SqueezeBlankLinesAround(2))
+
+	b.Close()
+}
+
+func TestSqueezeBlankLines(t *testing.T) {
+	b := NewBufferFromString("a\n\n \n\nb\n\nc\n\t\n\n", "", BTDefault)
+
+	assert.Equal(t, 4, b.SqueezeBlankLines(0, b.LinesNum()-1))
+	assert.Equal(t, "a\n\nb\n\nc\n", string(b.Bytes()))
+
+	b.UndoOneEvent()
+	assert.Equal(t, "a\n\n \n\nb\n\nc\n\t\n\n", string(b.Bytes()))
+
+	// runs are cut at the ends of the range
+	assert.Equal(t, 1, b.SqueezeBlankLines(6, 2))
+	assert.Equal(t, "a\n\n\nb\n\nc\n\t\n\n", string(b.Bytes()))
+
+	b.Close()
+}
+
+func TestSqueezeSpaces(t *testing.T) {
+	b := NewBufferFromString("\t  a  b\tc d  \nx y\n  p \t q", "", BTDefault)
+
+	assert.Equal(t, 2, b.SqueezeSpaces(0, 2))
+	assert.Equal(t, "\t  a b c d  \nx y\n  p q", string(b.Bytes()))
+
+	b.UndoOneEvent()
+	assert.Equal(t, "\t  a  b\tc d  \nx y\n  p \t q", string(b.Bytes()))
+
+	b.Close()
+}
+
+func TestBreakLine(t *testing.T) {
+	b := NewBufferFromString("\tfoo(a,  b)\n", "", BTDefault)
+
+	// whitespace around the break goes away
+	assert.Equal(t, Loc{1, 1}, b.BreakLine(Loc{7, 0}))
+	assert.Equal(t, "\tfoo(a,\n\tb)\n", string(b.Bytes()))
+	b.UndoOneEvent()
+	assert.Equal(t, "\tfoo(a,  b)\n", string(b.Bytes()))
+
+	assert.Equal(t, Loc{1, 1}, b.BreakLine(Loc{5, 0}))
+	assert.Equal(t, "\tfoo(\n\ta,  b)\n", string(b.Bytes()))
+	b.UndoOneEvent()
+
+	// at the end of the line the new line only has the indentation
+	assert.Equal(t, Loc{1, 1}, b.BreakLine(Loc{11, 0}))
+	assert.Equal(t, "\tfoo(a,  b)\n\t\n", string(b.Bytes()))
+	b.UndoOneEvent()
+
+	// in the indentation the line moves down as it is
+	assert.Equal(t, Loc{1, 1}, b.BreakLine(Loc{0, 0}))
+	assert.Equal(t, "\n\tfoo(a,  b)\n", string(b.Bytes()))
+
+	b.Close()
+}
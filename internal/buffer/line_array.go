@@ -7,6 +7,7 @@ import (
 	"sync"
 	"unicode/utf8"
 
+	"github.com/zyedidia/micro/internal/util"
 	"github.com/zyedidia/micro/pkg/highlight"
 )
 
@@ -41,6 +42,22 @@ type Line struct {
 	match       highlight.LineMatch
 	rehighlight bool
 	lock        sync.Mutex
+
+	// cached display width of data, only valid if widthTabsize matches the
+	// current tab size (it is 0 when the width has not been computed)
+	width        int
+	widthTabsize int
+
+	// a lazy line has not been edited since it was read from the backing
+	// file of its line array, at offset off, and its data may be nil until
+	// it is needed
+	off  int64
+	size int
+	lazy bool
+
+	// modified is set when the line is edited or added, and cleared when
+	// the buffer is saved
+	modified bool
 }
 
 const (
@@ -58,23 +75,17 @@ type LineArray struct {
 	lines    []Line
 	Endings  FileFormat
 	initsize uint64
-}
 
-// Append efficiently appends lines together
-// It allocates an additional 10000 lines if the original estimate
-// is incorrect
-func Append(slice []Line, data ...Line) []Line {
-	l := len(slice)
-	if l+len(data) > cap(slice) { // reallocate
-		newSlice := make([]Line, (l+len(data))+10000)
-		copy(newSlice, slice)
-		slice = newSlice
-	}
-	slice = slice[0 : l+len(data)]
-	for i, c := range data {
-		slice[l+i] = c
-	}
-	return slice
+	// cached display width of the widest line, only valid if maxTabsize
+	// matches the current tab size (it is 0 when the maximum must be
+	// recomputed)
+	maxWidth   int
+	maxTabsize int
+
+	// src is the file lazy lines are read from, it is nil unless the
+	// line array was created by NewLineArrayLazy
+	src      *lazySource
+	lazyLock sync.Mutex
 }
 
 // NewLineArray returns a new line array from an array of bytes
@@ -85,9 +96,9 @@ func NewLineArray(size uint64, endings FileFormat, reader io.Reader) *LineArray
 	la.initsize = size
 
 	br := bufio.NewReader(reader)
-	var loaded int
+	// bytes read until the capacity is estimated
+	var loaded uint64
 
-	n := 0
 	for {
 		data, err := br.ReadBytes('\n')
 		// Detect the line ending by checking to see if there is a '\r' char
@@ -107,27 +118,17 @@ func NewLineArray(size uint64, endings FileFormat, reader io.Reader) *LineArray
 			}
 		}
 
-		// If we are loading a large file (greater than 1000) we use the file
-		// size and the length of the first 1000 lines to try to estimate
-		// how many lines will need to be allocated for the rest of the file
-		// We add an extra 10000 to the original estimate to be safe and give
-		// plenty of room for expansion
-		if n >= 1000 && loaded >= 0 {
-			totalLinesNum := int(float64(size) * (float64(n) / float64(loaded)))
-			newSlice := make([]Line, len(la.lines), totalLinesNum+10000)
-			copy(newSlice, la.lines)
-			la.lines = newSlice
-			loaded = -1
-		}
-
-		// Counter for the number of bytes in the first 1000 lines
-		if loaded >= 0 {
-			loaded += dlen
+		// After the first lines the file size gives a good estimate of how
+		// many lines there are, which saves reallocating a large slice
+		// several times; if the estimate is short append takes over
+		if loaded += uint64(dlen); len(la.lines) == cap(la.lines) && loaded > 0 && loaded < size {
+			la.lines = growLines(la.lines, size*uint64(len(la.lines))/loaded)
+			loaded = size
 		}
 
 		if err != nil {
 			if err == io.EOF {
-				la.lines = Append(la.lines, Line{
+				la.lines = append(la.lines, Line{
 					data:        data[:],
 					state:       nil,
 					match:       nil,
@@ -137,86 +138,141 @@ func NewLineArray(size uint64, endings FileFormat, reader io.Reader) *LineArray
 			// Last line was read
 			break
 		} else {
-			la.lines = Append(la.lines, Line{
+			la.lines = append(la.lines, Line{
 				data:        data[:dlen-1],
 				state:       nil,
 				match:       nil,
 				rehighlight: false,
 			})
 		}
-		n++
 	}
 
 	return la
 }
 
+// growLines returns lines with room for about n lines in total, plus a
+// margin for a wrong estimate
+func growLines(lines []Line, n uint64) []Line {
+	n += n / 16
+	if n <= uint64(cap(lines)) {
+		return lines
+	}
+	grown := make([]Line, len(lines), n)
+	copy(grown, lines)
+	return grown
+}
+
 // Bytes returns the string that should be written to disk when
 // the line array is saved
 func (la *LineArray) Bytes() []byte {
 	b := new(bytes.Buffer)
 	// initsize should provide a good estimate
 	b.Grow(int(la.initsize + 4096))
-	for i, l := range la.lines {
-		b.Write(l.data)
-		if i != len(la.lines)-1 {
-			if la.Endings == FFDos {
-				b.WriteByte('\r')
+	la.WriteTo(b)
+	return b.Bytes()
+}
+
+// WriteTo writes the lines to w, separated by the line endings of the file
+// format, one line at a time instead of building the whole text in memory
+// It implements io.WriterTo
+func (la *LineArray) WriteTo(w io.Writer) (int64, error) {
+	eol := []byte{'\n'}
+	if la.Endings == FFDos {
+		eol = []byte{'\r', '\n'}
+	}
+	return la.writeLines(w, eol)
+}
+
+// WriteLinesTo writes the lines to w like WriteTo, but always separated by
+// \n as they are in the buffer, like the text of a selection
+func (la *LineArray) WriteLinesTo(w io.Writer) (int64, error) {
+	return la.writeLines(w, []byte{'\n'})
+}
+
+func (la *LineArray) writeLines(w io.Writer, eol []byte) (int64, error) {
+	var total int64
+	for i := range la.lines {
+		if i > 0 {
+			n, err := w.Write(eol)
+			total += int64(n)
+			if err != nil {
+				return total, err
 			}
-			b.WriteByte('\n')
+		}
+		n, err := w.Write(la.peek(i))
+		total += int64(n)
+		if err != nil {
+			return total, err
 		}
 	}
-	return b.Bytes()
+	return total, nil
 }
 
 // newlineBelow adds a newline below the given line number
 func (la *LineArray) newlineBelow(y int) {
-	la.lines = append(la.lines, Line{
-		data:        []byte{' '},
-		state:       nil,
-		match:       nil,
-		rehighlight: false,
-	})
+	la.lines = append(la.lines, Line{})
 	copy(la.lines[y+2:], la.lines[y+1:])
+	la.linesShifted()
 	la.lines[y+1] = Line{
 		data:        []byte{},
 		state:       la.lines[y].state,
 		match:       nil,
 		rehighlight: false,
+		modified:    true,
+	}
+}
+
+// setData replaces the bytes of line n and marks it as modified, after
+// which a lazy line is no longer read from the backing file
+func (la *LineArray) setData(n int, data []byte) {
+	if la.lines[n].lazy {
+		la.lazyLock.Lock()
+		defer la.lazyLock.Unlock()
 	}
+	la.lines[n].data = data
+	la.lines[n].lazy = false
+	la.lines[n].modified = true
 }
 
 // Inserts a byte array at a given location
 func (la *LineArray) insert(pos Loc, value []byte) {
-	x, y := runeToByteIndex(pos.X, la.lines[pos.Y].data), pos.Y
-	for i := 0; i < len(value); i++ {
-		if value[i] == '\n' {
-			la.split(Loc{x, y})
-			x = 0
-			y++
-			continue
+	x, y := runeToByteIndex(pos.X, la.data(pos.Y)), pos.Y
+	for {
+		i := bytes.IndexByte(value, '\n')
+		if i < 0 {
+			la.insertBytes(Loc{x, y}, value)
+			return
 		}
-		la.insertByte(Loc{x, y}, value[i])
-		x++
+		la.insertBytes(Loc{x, y}, value[:i])
+		la.split(Loc{x + i, y})
+		x = 0
+		y++
+		value = value[i+1:]
 	}
 }
 
-// InsertByte inserts a byte at a given location
-func (la *LineArray) insertByte(pos Loc, value byte) {
-	la.lines[pos.Y].data = append(la.lines[pos.Y].data, 0)
-	copy(la.lines[pos.Y].data[pos.X+1:], la.lines[pos.Y].data[pos.X:])
-	la.lines[pos.Y].data[pos.X] = value
+// insertBytes inserts bytes that contain no newline at a given location
+func (la *LineArray) insertBytes(pos Loc, value []byte) {
+	if len(value) == 0 {
+		return
+	}
+	data := append(la.data(pos.Y), value...)
+	copy(data[pos.X+len(value):], data[pos.X:len(data)-len(value)])
+	copy(data[pos.X:], value)
+	la.setData(pos.Y, data)
+	la.invalidateWidth(pos.Y)
 }
 
 // joinLines joins the two lines a and b
 func (la *LineArray) joinLines(a, b int) {
-	la.insert(Loc{len(la.lines[a].data), a}, la.lines[b].data)
+	la.insert(Loc{len(la.data(a)), a}, la.data(b))
 	la.deleteLine(b)
 }
 
 // split splits a line at a given position
 func (la *LineArray) split(pos Loc) {
 	la.newlineBelow(pos.Y)
-	la.insert(Loc{0, pos.Y + 1}, la.lines[pos.Y].data[pos.X:])
+	la.insert(Loc{0, pos.Y + 1}, la.data(pos.Y)[pos.X:])
 	la.lines[pos.Y+1].state = la.lines[pos.Y].state
 	la.lines[pos.Y].state = nil
 	la.lines[pos.Y].match = nil
@@ -228,61 +284,139 @@ func (la *LineArray) split(pos Loc) {
 // removes from start to end
 func (la *LineArray) remove(start, end Loc) []byte {
 	sub := la.Substr(start, end)
-	startX := runeToByteIndex(start.X, la.lines[start.Y].data)
-	endX := runeToByteIndex(end.X, la.lines[end.Y].data)
+	startX := runeToByteIndex(start.X, la.data(start.Y))
+	endX := runeToByteIndex(end.X, la.data(end.Y))
 	if start.Y == end.Y {
-		la.lines[start.Y].data = append(la.lines[start.Y].data[:startX], la.lines[start.Y].data[endX:]...)
+		data := la.data(start.Y)
+		la.setData(start.Y, append(data[:startX], data[endX:]...))
+		la.invalidateWidth(start.Y)
 	} else {
 		la.deleteLines(start.Y+1, end.Y-1)
 		la.deleteToEnd(Loc{startX, start.Y})
-		la.deleteFromStart(Loc{endX - 1, start.Y + 1})
+		la.deleteFromStart(Loc{endX, start.Y + 1})
 		la.joinLines(start.Y, start.Y+1)
 	}
 	return sub
 }
 
-// deleteToEnd deletes from the end of a line to the position
+// deleteToEnd deletes from the byte index pos.X to the end of the line,
+// keeping the bytes before pos.X
 func (la *LineArray) deleteToEnd(pos Loc) {
-	la.lines[pos.Y].data = la.lines[pos.Y].data[:pos.X]
+	la.setData(pos.Y, la.data(pos.Y)[:pos.X])
+	la.invalidateWidth(pos.Y)
 }
 
-// deleteFromStart deletes from the start of a line to the position
+// deleteFromStart deletes from the start of the line up to the byte index
+// pos.X, keeping the bytes from pos.X on
 func (la *LineArray) deleteFromStart(pos Loc) {
-	la.lines[pos.Y].data = la.lines[pos.Y].data[pos.X+1:]
+	la.setData(pos.Y, la.data(pos.Y)[pos.X:])
+	la.invalidateWidth(pos.Y)
 }
 
 // deleteLine deletes the line number
 func (la *LineArray) deleteLine(y int) {
+	la.dropWidth(y)
 	la.lines = la.lines[:y+copy(la.lines[y:], la.lines[y+1:])]
+	la.linesShifted()
 }
 
 func (la *LineArray) deleteLines(y1, y2 int) {
+	for i := y1; i <= y2; i++ {
+		la.dropWidth(i)
+	}
 	la.lines = la.lines[:y1+copy(la.lines[y1:], la.lines[y2+1:])]
+	la.linesShifted()
 }
 
 // DeleteByte deletes the byte at a position
 func (la *LineArray) deleteByte(pos Loc) {
-	la.lines[pos.Y].data = la.lines[pos.Y].data[:pos.X+copy(la.lines[pos.Y].data[pos.X:], la.lines[pos.Y].data[pos.X+1:])]
+	data := la.data(pos.Y)
+	la.setData(pos.Y, data[:pos.X+copy(data[pos.X:], data[pos.X+1:])])
+	la.invalidateWidth(pos.Y)
+}
+
+// invalidateWidth discards the cached display width of a line after its
+// data has changed
+// If the widest line is known it is kept up to date: a line that grows
+// past it becomes the new maximum, and if the widest line itself changed
+// the maximum is recomputed on the next call to maxLineWidth
+func (la *LineArray) invalidateWidth(lineN int) {
+	wasMax := la.isMaxWidth(lineN)
+	la.lines[lineN].widthTabsize = 0
+	if la.maxTabsize == 0 {
+		return
+	}
+	if wasMax {
+		la.maxTabsize = 0
+	} else if w := la.lineWidth(lineN, la.maxTabsize); w > la.maxWidth {
+		la.maxWidth = w
+	}
+}
+
+// dropWidth must be called before a line is deleted so that the widest
+// line is recomputed if it was the one removed
+func (la *LineArray) dropWidth(lineN int) {
+	if la.isMaxWidth(lineN) {
+		la.maxTabsize = 0
+	}
+}
+
+// isMaxWidth returns whether the line may be the widest one in the array
+// Lines whose width is not cached are new and have never been counted
+func (la *LineArray) isMaxWidth(lineN int) bool {
+	l := &la.lines[lineN]
+	return la.maxTabsize != 0 && l.widthTabsize == la.maxTabsize && l.width == la.maxWidth
+}
+
+// maxLineWidth returns the display width of the widest line with tabs
+// expanded to the given size
+// All lines are only measured when the tab size changes or when the
+// widest line got shorter or was deleted
+func (la *LineArray) maxLineWidth(tabsize int) int {
+	if la.maxTabsize != tabsize {
+		la.maxWidth = 0
+		for i := range la.lines {
+			if w := la.lineWidth(i, tabsize); w > la.maxWidth {
+				la.maxWidth = w
+			}
+		}
+		la.maxTabsize = tabsize
+	}
+	return la.maxWidth
+}
+
+// lineWidth returns the display width of a line with tabs expanded to
+// the given size
+// The width is computed lazily and cached until the line is edited or
+// the tab size changes
+func (la *LineArray) lineWidth(lineN, tabsize int) int {
+	l := &la.lines[lineN]
+	if l.widthTabsize != tabsize {
+		data := la.peek(lineN)
+		l.width = util.StringWidth(data, utf8.RuneCount(data), tabsize)
+		l.widthTabsize = tabsize
+	}
+	return l.width
 }
 
 // Substr returns the string representation between two locations
 func (la *LineArray) Substr(start, end Loc) []byte {
-	startX := runeToByteIndex(start.X, la.lines[start.Y].data)
-	endX := runeToByteIndex(end.X, la.lines[end.Y].data)
+	startX := runeToByteIndex(start.X, la.data(start.Y))
+	endX := runeToByteIndex(end.X, la.data(end.Y))
 	if start.Y == end.Y {
-		src := la.lines[start.Y].data[startX:endX]
+		src := la.data(start.Y)[startX:endX]
 		dest := make([]byte, len(src))
 		copy(dest, src)
 		return dest
 	}
-	str := make([]byte, 0, len(la.lines[start.Y+1].data)*(end.Y-start.Y))
-	str = append(str, la.lines[start.Y].data[startX:]...)
+	str := make([]byte, 0, len(la.data(start.Y+1))*(end.Y-start.Y))
+	str = append(str, la.data(start.Y)[startX:]...)
 	str = append(str, '\n')
 	for i := start.Y + 1; i <= end.Y-1; i++ {
-		str = append(str, la.lines[i].data...)
+		str = append(str, la.data(i)...)
 		str = append(str, '\n')
 	}
-	str = append(str, la.lines[end.Y].data[:endX]...)
+	str = append(str, la.data(end.Y)[:endX]...)
 	return str
 }
 
@@ -291,6 +425,33 @@ func (la *LineArray) LinesNum() int {
 	return len(la.lines)
 }
 
+// Len returns the length in bytes of the text as Bytes would return it,
+// without reading the lines of a lazy line array
+func (la *LineArray) Len() int {
+	if len(la.lines) == 0 {
+		return 0
+	}
+	eol := 1
+	if la.Endings == FFDos {
+		eol = 2
+	}
+
+	n := (len(la.lines) - 1) * eol
+	if la.src != nil {
+		la.lazyLock.Lock()
+		defer la.lazyLock.Unlock()
+	}
+	for i := range la.lines {
+		l := &la.lines[i]
+		if l.lazy && l.data == nil {
+			n += l.size
+		} else {
+			n += len(l.data)
+		}
+	}
+	return n
+}
+
 // Start returns the start of the buffer
 func (la *LineArray) Start() Loc {
 	return Loc{0, 0}
@@ -299,7 +460,7 @@ func (la *LineArray) Start() Loc {
 // End returns the location of the last character in the buffer
 func (la *LineArray) End() Loc {
 	numlines := len(la.lines)
-	return Loc{utf8.RuneCount(la.lines[numlines-1].data), numlines - 1}
+	return Loc{utf8.RuneCount(la.data(numlines - 1)), numlines - 1}
 }
 
 // LineBytes returns line n as an array of bytes
@@ -307,7 +468,27 @@ func (la *LineArray) LineBytes(n int) []byte {
 	if n >= len(la.lines) || n < 0 {
 		return []byte{}
 	}
-	return la.lines[n].data
+	return la.data(n)
+}
+
+// DirtyLines returns the numbers of the lines that were edited or added
+// since the file was loaded or last saved
+// A line stays dirty even if an undo restores its original text
+func (la *LineArray) DirtyLines() map[int]bool {
+	dirty := make(map[int]bool)
+	for i := range la.lines {
+		if la.lines[i].modified {
+			dirty[i] = true
+		}
+	}
+	return dirty
+}
+
+// clearDirty marks all lines as unmodified
+func (la *LineArray) clearDirty() {
+	for i := range la.lines {
+		la.lines[i].modified = false
+	}
 }
 
 // State gets the highlight state for the given line number
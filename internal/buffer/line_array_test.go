@@ -1,10 +1,15 @@
 package buffer
 
 import (
+	"bytes"
+	"io/ioutil"
+	"strconv"
 	"strings"
 	"testing"
+	"unicode/utf8"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/zyedidia/micro/internal/util"
 )
 
 var unicode_txt = `An preost wes on leoden, Laȝamon was ihoten
@@ -58,3 +63,234 @@ func TestRemove(t *testing.T) {
 	bytes := la.Bytes()
 	assert.Equal(t, unicode_txt, string(bytes))
 }
+
+func TestLineWidth(t *testing.T) {
+	txt := "a\tb\n世界\n"
+	la := NewLineArray(uint64(len(txt)), FFAuto, strings.NewReader(txt))
+
+	assert.Equal(t, 5, la.lineWidth(0, 4))
+	assert.Equal(t, 9, la.lineWidth(0, 8))
+	assert.Equal(t, 4, la.lineWidth(1, 4))
+	assert.Equal(t, 0, la.lineWidth(2, 4))
+
+	// edits invalidate the cached width of the lines they touch
+	la.insert(Loc{1, 1}, []byte("x\ty"))
+	assert.Equal(t, 4+1+1+1, la.lineWidth(1, 4))
+	la.remove(Loc{0, 0}, Loc{0, 1})
+	assert.Equal(t, 2+2+1+1+1, la.lineWidth(0, 4))
+}
+
+func TestMaxLineWidth(t *testing.T) {
+	b := NewBufferFromString("ab\n\tx\n世界世界\n", "", BTDefault)
+	b.Settings["tabsize"] = float64(4)
+
+	assert.Equal(t, 8, b.MaxLineWidth())
+
+	// lengthening a shorter line past the maximum
+	b.Insert(Loc{2, 1}, "yyyyyy")
+	assert.Equal(t, 11, b.MaxLineWidth())
+
+	// shortening the longest line falls back to the next widest
+	b.Remove(Loc{1, 1}, Loc{7, 1})
+	assert.Equal(t, 8, b.MaxLineWidth())
+	b.Remove(Loc{2, 2}, Loc{4, 2})
+	assert.Equal(t, 5, b.MaxLineWidth())
+
+	// deleting the longest line
+	b.Remove(Loc{0, 1}, Loc{0, 2})
+	assert.Equal(t, 4, b.MaxLineWidth())
+
+	// new lines are counted
+	b.Insert(Loc{0, 0}, "a\tbcde\n")
+	assert.Equal(t, 8, b.MaxLineWidth())
+
+	b.Settings["tabsize"] = float64(8)
+	assert.Equal(t, 12, b.MaxLineWidth())
+
+	b.Close()
+}
+
+func TestRemoveMultiline(t *testing.T) {
+	text := "αβγ\nδεζ\nηθι\nκλμ"
+	tests := []struct {
+		start, end Loc
+		removed    string
+		result     string
+	}{
+		{Loc{1, 0}, Loc{2, 1}, "βγ\nδε", "αζ\nηθι\nκλμ"},
+		// the end at the start of a line keeps all of it
+		{Loc{3, 0}, Loc{0, 1}, "\n", "αβγδεζ\nηθι\nκλμ"},
+		{Loc{0, 0}, Loc{0, 3}, "αβγ\nδεζ\nηθι\n", "κλμ"},
+		// the end at the end of a line removes all of it
+		{Loc{2, 1}, Loc{3, 3}, "ζ\nηθι\nκλμ", "αβγ\nδε"},
+		{Loc{0, 0}, Loc{3, 3}, text, ""},
+	}
+	for _, test := range tests {
+		la := NewLineArray(uint64(len(text)), FFAuto, strings.NewReader(text))
+		assert.Equal(t, test.removed, string(la.remove(test.start, test.end)))
+		assert.Equal(t, test.result, string(la.Bytes()))
+	}
+}
+
+func TestRemoveWideRunes(t *testing.T) {
+	text := "ab😀cd\n漢字かな\n🎉x🎉\nend"
+	for sy := 0; sy < 4; sy++ {
+		for ey := sy; ey < 4; ey++ {
+			for sx := 0; sx <= utf8.RuneCount(lineOf(text, sy)); sx++ {
+				for ex := 0; ex <= utf8.RuneCount(lineOf(text, ey)); ex++ {
+					start, end := Loc{sx, sy}, Loc{ex, ey}
+					if end.LessThan(start) {
+						continue
+					}
+					la := NewLineArray(uint64(len(text)), FFAuto, strings.NewReader(text))
+					removed := string(la.Substr(start, end))
+					assert.Equal(t, removed, string(la.remove(start, end)))
+
+					result := string(la.Bytes())
+					assert.True(t, utf8.ValidString(result), "%v-%v: %q", start, end, result)
+					assert.Equal(t, text, insertAt(result, start, removed), "%v-%v", start, end)
+				}
+			}
+		}
+	}
+}
+
+// lineOf returns line y of text
+func lineOf(text string, y int) []byte {
+	return []byte(strings.Split(text, "\n")[y])
+}
+
+// insertAt inserts s into text at loc, counted in runes
+func insertAt(text string, loc Loc, s string) string {
+	lines := strings.Split(text, "\n")
+	l := []rune(lines[loc.Y])
+	lines[loc.Y] = string(l[:loc.X]) + s + string(l[loc.X:])
+	return strings.Join(lines, "\n")
+}
+
+func TestDeleteFromStartToEnd(t *testing.T) {
+	la := NewLineArray(11, FFAuto, strings.NewReader("αβγ\nδεζ"))
+	// δ is two bytes long
+	la.deleteFromStart(Loc{2, 1})
+	assert.Equal(t, "εζ", string(la.LineBytes(1)))
+	la.deleteToEnd(Loc{2, 0})
+	assert.Equal(t, "α", string(la.LineBytes(0)))
+}
+
+func TestNewlinesInSequence(t *testing.T) {
+	la := NewLineArray(3, FFAuto, strings.NewReader("a\nb"))
+
+	for i := 0; i < 50; i++ {
+		la.insert(Loc{0, 0}, []byte{'\n'})
+		la.insert(la.End(), []byte{'\n'})
+		y := la.LinesNum() / 2
+		la.insert(Loc{utf8.RuneCount(la.LineBytes(y)), y}, []byte("\n\n"))
+	}
+
+	assert.Equal(t, 2+200, la.LinesNum())
+	assert.NotContains(t, string(la.Bytes()), " ")
+	assert.Equal(t, "ab", strings.Replace(string(la.Bytes()), "\n", "", -1))
+}
+
+func TestWriteTo(t *testing.T) {
+	text := "one\r\ntwo\r\n\r\nthree"
+	la := NewLineArray(uint64(len(text)), FFDos, strings.NewReader(text))
+	la.Endings = FFDos
+
+	buf := new(bytes.Buffer)
+	n, err := la.WriteTo(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(text)), n)
+	assert.Equal(t, text, buf.String())
+
+	// WriteLinesTo ignores the file format
+	buf.Reset()
+	n, err = la.WriteLinesTo(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(buf.Len()), n)
+	assert.Equal(t, "one\ntwo\n\nthree", buf.String())
+
+	la.Endings = FFUnix
+	buf.Reset()
+	la.WriteTo(buf)
+	assert.Equal(t, "one\ntwo\n\nthree", buf.String())
+	assert.Equal(t, buf.Bytes(), la.Bytes())
+}
+
+func TestLen(t *testing.T) {
+	text := "one\r\ntwo\r\n\r\nthree"
+	la := NewLineArray(uint64(len(text)), FFDos, strings.NewReader(text))
+	la.Endings = FFDos
+	assert.Equal(t, len(text), la.Len())
+	la.Endings = FFUnix
+	assert.Equal(t, len(la.Bytes()), la.Len())
+
+	lazy := NewLineArrayLazy(uint64(len(text)), FFDos, strings.NewReader(text), nil)
+	lazy.Endings = FFDos
+	assert.Equal(t, len(text), lazy.Len())
+	lazy.insert(Loc{0, 1}, []byte("2"))
+	assert.Equal(t, len(text)+1, lazy.Len())
+}
+
+func BenchmarkLineWidthUncached(b *testing.B) {
+	lines := strings.Repeat("\tfunc (la *LineArray) lineWidth(lineN, tabsize int) int { // 世界\n", 10000)
+	la := NewLineArray(uint64(len(lines)), FFAuto, strings.NewReader(lines))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for y := 0; y < la.LinesNum(); y++ {
+			l := la.LineBytes(y)
+			util.StringWidth(l, utf8.RuneCount(l), 4)
+		}
+	}
+}
+
+func BenchmarkLineWidth(b *testing.B) {
+	lines := strings.Repeat("\tfunc (la *LineArray) lineWidth(lineN, tabsize int) int { // 世界\n", 10000)
+	la := NewLineArray(uint64(len(lines)), FFAuto, strings.NewReader(lines))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for y := 0; y < la.LinesNum(); y++ {
+			la.lineWidth(y, 4)
+		}
+	}
+}
+
+func BenchmarkNewLineArray(b *testing.B) {
+	line := "\tfunc (la *LineArray) lineWidth(lineN, tabsize int) int { // 世界\n"
+	for _, n := range []int{10, 1000, 100000, 1000000} {
+		text := strings.Repeat(line, n)
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(text)))
+			for i := 0; i < b.N; i++ {
+				NewLineArray(uint64(len(text)), FFAuto, strings.NewReader(text))
+			}
+		})
+	}
+}
+
+func BenchmarkBytes(b *testing.B) {
+	text := strings.Repeat("\tfunc (la *LineArray) lineWidth(lineN, tabsize int) int { // 世界\n", 100000)
+	la := NewLineArray(uint64(len(text)), FFAuto, strings.NewReader(text))
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(text)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		la.Bytes()
+	}
+}
+
+func BenchmarkWriteTo(b *testing.B) {
+	text := strings.Repeat("\tfunc (la *LineArray) lineWidth(lineN, tabsize int) int { // 世界\n", 100000)
+	la := NewLineArray(uint64(len(text)), FFAuto, strings.NewReader(text))
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(text)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		la.WriteTo(ioutil.Discard)
+	}
+}
@@ -0,0 +1,84 @@
+package buffer
+
+// A lineRange is an inclusive range of line numbers
+type lineRange struct {
+	start, end int
+}
+
+// ProtectRange makes the lines from start to end (inclusive) read-only
+// while the rest of the buffer stays editable
+// Edits that would change a protected line are ignored, and protected
+// ranges move along with their lines when lines are added or removed
+// above them
+func (b *SharedBuffer) ProtectRange(start, end int) {
+	if start > end {
+		start, end = end, start
+	}
+	b.protected = append(b.protected, lineRange{start, end})
+}
+
+// ClearProtectedRanges makes every line of the buffer editable again
+func (b *SharedBuffer) ClearProtectedRanges() {
+	b.protected = nil
+}
+
+// IsProtected returns whether line y is in a protected range
+func (b *SharedBuffer) IsProtected(y int) bool {
+	for _, r := range b.protected {
+		if y >= r.start && y <= r.end {
+			return true
+		}
+	}
+	return false
+}
+
+// overlapsProtected returns whether any line from start to end is in a
+// protected range
+func (b *SharedBuffer) overlapsProtected(start, end int) bool {
+	for _, r := range b.protected {
+		if start <= r.end && end >= r.start {
+			return true
+		}
+	}
+	return false
+}
+
+// touchesProtected returns whether executing the text event would modify
+// a protected line
+func (b *SharedBuffer) touchesProtected(t *TextEvent) bool {
+	if len(b.protected) == 0 {
+		return false
+	}
+	for _, d := range t.Deltas {
+		end := d.End.Y
+		if t.EventType == TextEventInsert {
+			end = d.Start.Y
+		}
+		if b.overlapsProtected(d.Start.Y, end) {
+			return true
+		}
+	}
+	return false
+}
+
+// undoTouchesProtected returns whether undoing the text event, or redoing
+// it once it was undone, would modify a protected line
+func (b *SharedBuffer) undoTouchesProtected(t *TextEvent) bool {
+	t.EventType = -t.EventType
+	defer func() { t.EventType = -t.EventType }()
+	return b.touchesProtected(t)
+}
+
+// shiftProtected moves the protected ranges below line y by n lines
+// after lines have been inserted (n > 0) or removed (n < 0) at line y
+func (b *SharedBuffer) shiftProtected(y, n int) {
+	if n == 0 {
+		return
+	}
+	for i := range b.protected {
+		if b.protected[i].start > y {
+			b.protected[i].start += n
+			b.protected[i].end += n
+		}
+	}
+}
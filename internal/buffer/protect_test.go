@@ -0,0 +1,68 @@
+package buffer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProtectRange(t *testing.T) {
+	b := NewBufferFromString("a\nb\nc\nd\ne", "", BTDefault)
+	b.ProtectRange(2, 3)
+	assert.True(t, b.IsProtected(2))
+	assert.True(t, b.IsProtected(3))
+	assert.False(t, b.IsProtected(4))
+
+	// edits inside the range are blocked
+	b.Insert(Loc{0, 2}, "x")
+	b.Remove(Loc{0, 3}, Loc{1, 3})
+	b.Remove(Loc{1, 1}, Loc{0, 2})
+	b.MultipleReplace([]Delta{{[]byte("y"), Loc{0, 4}, Loc{1, 4}}, {[]byte("z"), Loc{0, 3}, Loc{1, 3}}})
+	assert.Equal(t, "a\nb\nc\nd\ne", string(b.Bytes()))
+
+	// edits outside the range succeed and shift it
+	b.Insert(Loc{1, 0}, "\nnew\n")
+	assert.Equal(t, "a\nnew\n\nb\nc\nd\ne", string(b.Bytes()))
+	assert.False(t, b.IsProtected(2))
+	assert.True(t, b.IsProtected(4))
+	assert.True(t, b.IsProtected(5))
+
+	b.Insert(Loc{1, 6}, "\nf")
+	assert.Equal(t, "a\nnew\n\nb\nc\nd\ne\nf", string(b.Bytes()))
+	assert.True(t, b.IsProtected(5))
+	assert.False(t, b.IsProtected(6))
+
+	b.Remove(Loc{1, 0}, Loc{0, 3})
+	assert.Equal(t, "ab\nc\nd\ne\nf", string(b.Bytes()))
+	assert.True(t, b.IsProtected(1))
+	assert.True(t, b.IsProtected(2))
+	assert.False(t, b.IsProtected(3))
+
+	// undo moves the range back
+	b.UndoOneEvent()
+	assert.True(t, b.IsProtected(4))
+
+	// an undo that would change a protected line leaves the history alone
+	b.ClearProtectedRanges()
+	b.Insert(Loc{0, 4}, "x")
+	b.ProtectRange(4, 4)
+	undos, redos := b.UndoStack.Len(), b.RedoStack.Len()
+	assert.False(t, b.UndoOneEvent())
+	b.Undo()
+	assert.Equal(t, "a\nnew\n\nb\nxc\nd\ne\nf", string(b.Bytes()))
+	assert.Equal(t, undos, b.UndoStack.Len())
+	assert.Equal(t, redos, b.RedoStack.Len())
+
+	b.ClearProtectedRanges()
+	assert.True(t, b.UndoOneEvent())
+	assert.Equal(t, "a\nnew\n\nb\nc\nd\ne\nf", string(b.Bytes()))
+	b.ProtectRange(4, 4)
+	assert.False(t, b.RedoOneEvent())
+	assert.Equal(t, 1, b.RedoStack.Len())
+
+	b.ClearProtectedRanges()
+	b.Insert(Loc{0, 4}, "x")
+	assert.Equal(t, "a\nnew\n\nb\nxc\nd\ne\nf", string(b.Bytes()))
+
+	b.Close()
+}
@@ -0,0 +1,103 @@
+package buffer
+
+import (
+	"bytes"
+	"unicode/utf8"
+
+	"github.com/zyedidia/micro/internal/util"
+)
+
+// isBlankLine returns whether line y has nothing but whitespace
+func (b *Buffer) isBlankLine(y int) bool {
+	return len(bytes.TrimSpace(b.LineBytes(y))) == 0
+}
+
+// ParagraphAround returns the first and last line of the paragraph that
+// contains line y, which is delimited by blank lines
+// It returns false if line y is blank
+func (b *Buffer) ParagraphAround(y int) (int, int, bool) {
+	if b.isBlankLine(y) {
+		return y, y, false
+	}
+	start, end := y, y
+	for start > 0 && !b.isBlankLine(start-1) {
+		start--
+	}
+	for end < b.LinesNum()-1 && !b.isBlankLine(end+1) {
+		end++
+	}
+	return start, end, true
+}
+
+// wrapParagraph fills the words of lines into lines of at most width
+// columns, the first one indented like the first line and the others like
+// the second line, if there is one, so that hanging indents are kept
+// A word that is wider than width gets a line of its own
+func wrapParagraph(lines [][]byte, width, tabsize int) [][]byte {
+	first := util.GetLeadingWhitespace(lines[0])
+	rest := first
+	if len(lines) > 1 {
+		rest = util.GetLeadingWhitespace(lines[1])
+	}
+
+	var words [][]byte
+	for _, l := range lines {
+		words = append(words, bytes.Fields(l)...)
+	}
+
+	var wrapped [][]byte
+	cur := append([]byte{}, first...)
+	empty := true
+	for _, w := range words {
+		if !empty {
+			next := append(append(append([]byte{}, cur...), ' '), w...)
+			if util.StringWidth(next, utf8.RuneCount(next), tabsize) <= width {
+				cur, empty = next, false
+				continue
+			}
+			wrapped = append(wrapped, cur)
+			cur = append([]byte{}, rest...)
+		}
+		cur = append(cur, w...)
+		empty = false
+	}
+	return append(wrapped, cur)
+}
+
+// Reflow rewraps the paragraphs of the lines from start to end (inclusive)
+// so that no line is wider than the wrapwidth option, with tabs counting
+// as tabsize columns, as a single undoable edit
+// Paragraphs are separated by blank lines, which are kept, and keep their
+// indentation
+// It returns the line where the reflowed text ends
+func (b *Buffer) Reflow(start, end int) int {
+	if start > end {
+		start, end = end, start
+	}
+	width := util.IntOpt(b.Settings["wrapwidth"])
+	tabsize := util.IntOpt(b.Settings["tabsize"])
+
+	var out, para [][]byte
+	flush := func() {
+		if len(para) > 0 {
+			out = append(out, wrapParagraph(para, width, tabsize)...)
+			para = nil
+		}
+	}
+	for y := start; y <= end; y++ {
+		if b.isBlankLine(y) {
+			flush()
+			out = append(out, b.LineBytes(y))
+		} else {
+			para = append(para, b.LineBytes(y))
+		}
+	}
+	flush()
+
+	text := bytes.Join(out, []byte{'\n'})
+	endLoc := Loc{utf8.RuneCount(b.LineBytes(end)), end}
+	if !bytes.Equal(text, b.Substr(Loc{0, start}, endLoc)) {
+		b.MultipleReplace([]Delta{{text, Loc{0, start}, endLoc}})
+	}
+	return start + len(out) - 1
+}
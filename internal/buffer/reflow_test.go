@@ -0,0 +1,51 @@
+package buffer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParagraphAround(t *testing.T) {
+	b := NewBufferFromString("a\nb\n \nc\n\nd", "", BTDefault)
+
+	start, end, ok := b.ParagraphAround(1)
+	assert.True(t, ok)
+	assert.Equal(t, [2]int{0, 1}, [2]int{start, end})
+
+	start, end, ok = b.ParagraphAround(3)
+	assert.True(t, ok)
+	assert.Equal(t, [2]int{3, 3}, [2]int{start, end})
+
+	_, _, ok = b.ParagraphAround(2)
+	assert.False(t, ok)
+
+	b.Close()
+}
+
+func TestReflow(t *testing.T) {
+	b := NewBufferFromString("one two three four\nfive six\n\n  - seven eight nine\n    ten eleven\nlast", "", BTDefault)
+	b.Settings["wrapwidth"] = float64(12)
+
+	assert.Equal(t, 7, b.Reflow(0, 4))
+	assert.Equal(t, "one two\nthree four\nfive six\n\n  - seven\n    eight\n    nine ten\n    eleven\nlast", string(b.Bytes()))
+
+	// a single undo brings back the original text
+	b.Undo()
+	assert.Equal(t, "one two three four\nfive six\n\n  - seven eight nine\n    ten eleven\nlast", string(b.Bytes()))
+
+	// long words get a line of their own
+	b = NewBufferFromString("a verylongwordhere b", "", BTDefault)
+	b.Settings["wrapwidth"] = float64(5)
+	b.Reflow(0, 0)
+	assert.Equal(t, "a\nverylongwordhere\nb", string(b.Bytes()))
+
+	// tabs count as tabsize columns
+	b = NewBufferFromString("\tab cd ef", "", BTDefault)
+	b.Settings["wrapwidth"] = float64(10)
+	b.Settings["tabsize"] = float64(4)
+	b.Reflow(0, 0)
+	assert.Equal(t, "\tab cd\n\tef", string(b.Bytes()))
+
+	b.Close()
+}
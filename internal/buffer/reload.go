@@ -0,0 +1,181 @@
+package buffer
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	dmp "github.com/sergi/go-diff/diffmatchpatch"
+	"github.com/zyedidia/micro/internal/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/transform"
+)
+
+// readFromDisk reads the buffer's file the same way it was opened,
+// decrypting or decompressing it if needed, and decodes it with the
+// buffer's encoding
+func (b *Buffer) readFromDisk() (string, error) {
+	fs := fsFor(b.Path)
+	file, err := fs.Open(b.Path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	info, err := fs.Stat(b.Path)
+	if err != nil {
+		return "", err
+	}
+
+	var reader io.Reader = file
+	settings := map[string]interface{}{
+		"size": info.Size(),
+	}
+	switch b.Type {
+	case BTGPG, BTArmorGPG:
+		settings["password"] = b.Settings["password"]
+		fallthrough
+	case BTGZIP, BTBZIP2, BTXZ:
+		if reader, err = encoding.Decoder(reader, b.Path, settings); err != nil {
+			return "", err
+		}
+	}
+
+	enc, err := htmlindex.Get(b.Settings["encoding"].(string))
+	if err != nil {
+		return "", err
+	}
+	data, err := ioutil.ReadAll(bufio.NewReader(transform.NewReader(reader, enc.NewDecoder())))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// diffDeltas returns the deltas that turn old into new, in the order that
+// MultipleReplace applies them
+func diffDeltas(old, new string) []Delta {
+	differ := dmp.New()
+	diff := differ.DiffMain(old, new, false)
+
+	var deltas []Delta
+	loc := Loc{0, 0}
+	for _, d := range diff {
+		switch d.Type {
+		case dmp.DiffInsert:
+			deltas = append(deltas, Delta{[]byte(d.Text), loc, loc})
+		case dmp.DiffDelete:
+			end := textEnd(loc, []byte(d.Text))
+			deltas = append(deltas, Delta{[]byte{}, loc, end})
+			loc = end
+		default:
+			loc = textEnd(loc, []byte(d.Text))
+		}
+	}
+
+	// later changes come first so that the locations stay valid
+	for i, j := 0, len(deltas)-1; i < j; i, j = i+1, j-1 {
+		deltas[i], deltas[j] = deltas[j], deltas[i]
+	}
+	return deltas
+}
+
+// replaceText turns old, the text of the buffer, into txt as a single edit
+// that can be undone and only changes the parts that differ
+// The cursors stay on the same line and column where the new text still
+// has them
+// It returns false if the edit would modify protected lines
+func (b *Buffer) replaceText(old, txt string) bool {
+	deltas := diffDeltas(old, txt)
+	if len(deltas) == 0 {
+		return true
+	}
+
+	type position struct {
+		loc Loc
+		sel [2]Loc
+	}
+	saved := make([]position, len(b.cursors))
+	for i, c := range b.cursors {
+		saved[i] = position{c.Loc, c.CurSelection}
+	}
+
+	b.EventHandler.cursors = b.cursors
+	b.EventHandler.active = b.curCursor
+	if !b.EventHandler.replace(deltas) {
+		return false
+	}
+
+	for i, c := range b.cursors {
+		c.Loc = clamp(saved[i].loc, b.LineArray)
+		c.CurSelection[0] = clamp(saved[i].sel[0], b.LineArray)
+		c.CurSelection[1] = clamp(saved[i].sel[1], b.LineArray)
+		c.Relocate()
+		c.LastVisualX = c.GetVisualX()
+	}
+	return true
+}
+
+// GetText returns the whole text of the buffer with a newline between
+// lines, whatever its fileformat
+func (b *Buffer) GetText() string {
+	return string(b.Substr(b.Start(), b.End()))
+}
+
+// SetText replaces the whole text of the buffer with text as a single
+// undoable edit, for example to format it
+// Only the parts that differ are changed, so that the cursors stay on the
+// same line and column where the new text still has them, but this is best
+// effort when lines are added or removed before them
+// Line endings in text are converted to the buffer's fileformat
+func (b *Buffer) SetText(text string) error {
+	if b.Type.Readonly {
+		b.refusedEdit = true
+		return errors.New("Cannot change a readonly buffer")
+	}
+	text = strings.Replace(text, "\r\n", "\n", -1)
+	if !b.replaceText(b.GetText(), text) {
+		return errors.New("Cannot change protected lines")
+	}
+
+	go b.Backup(true)
+	b.editHook()
+	return nil
+}
+
+// Reload reads the buffer's file from disk again as a single edit that can
+// be undone, rather than the many small edits of ReOpen
+// The cursors stay on the same line and column where the file still has
+// them, and if the file cannot be read or decoded, for example because it
+// no longer decrypts with the buffer's password, the buffer is left as it is
+// Lazily read buffers are reopened instead and lose their undo history
+func (b *Buffer) Reload() error {
+	if b.Path == "" {
+		return errors.New("No file to reload")
+	}
+	if b.IsLazy() {
+		return b.ReOpen()
+	}
+
+	txt, err := b.readFromDisk()
+	if err != nil {
+		return err
+	}
+
+	// the lines of the buffer do not keep the \r of CRLF line endings, so
+	// the texts are compared with \n only, as in SetText
+	// Unlike saving, the diff needs the whole text of the buffer at once
+	txt = strings.Replace(txt, "\r\n", "\n", -1)
+	if !b.replaceText(b.GetText(), txt) {
+		return errors.New("Reloading would modify protected lines")
+	}
+
+	err = b.UpdateModTime()
+	if !b.Settings["fastdirty"].(bool) {
+		b.updateOrigHash()
+	}
+	b.isModified = false
+	b.clearDirty()
+	return err
+}
@@ -0,0 +1,117 @@
+package buffer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "micro-reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "test.txt")
+	ioutil.WriteFile(name, []byte("one\ntwo\nthree\n"), 0644)
+
+	b := NewBufferFromString("one\ntwo\nthree\n", name, BTDefault)
+	defer b.Close()
+	c := b.GetActiveCursor()
+	c.GotoLoc(Loc{2, 2})
+
+	ioutil.WriteFile(name, []byte("zero\none\ntwo too\nthree and a half\n"), 0644)
+	undos := b.UndoStack.Len()
+	assert.NoError(t, b.Reload())
+	assert.Equal(t, "zero\none\ntwo too\nthree and a half\n", string(b.Bytes()))
+	assert.Equal(t, undos+1, b.UndoStack.Len())
+	assert.False(t, b.Modified())
+	assert.Equal(t, Loc{2, 2}, c.Loc)
+
+	// the cursor is kept inside the new text
+	c.GotoLoc(Loc{10, 3})
+	ioutil.WriteFile(name, []byte("zero\n"), 0644)
+	assert.NoError(t, b.Reload())
+	assert.Equal(t, "zero\n", string(b.Bytes()))
+	assert.Equal(t, Loc{0, 1}, c.Loc)
+
+	b.UndoOneEvent()
+	assert.Equal(t, "zero\none\ntwo too\nthree and a half\n", string(b.Bytes()))
+	b.UndoOneEvent()
+	assert.Equal(t, "one\ntwo\nthree\n", string(b.Bytes()))
+}
+
+func TestReloadCRLF(t *testing.T) {
+	dir, err := ioutil.TempDir("", "micro-reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "test.txt")
+	ioutil.WriteFile(name, []byte("one\r\ntwo\r\n"), 0644)
+	b := NewBufferFromString("one\r\ntwo\r\n", name, BTDefault)
+	defer b.Close()
+	assert.Equal(t, FileFormat(FFDos), b.Endings)
+
+	ioutil.WriteFile(name, []byte("one\r\ntwo\r\nthree\r\n"), 0644)
+	assert.NoError(t, b.Reload())
+	assert.Equal(t, "one\ntwo\nthree\n", b.GetText())
+	assert.Equal(t, "one\r\ntwo\r\nthree\r\n", string(b.Bytes()))
+	for i := 0; i < b.LinesNum(); i++ {
+		assert.NotContains(t, string(b.LineBytes(i)), "\r")
+	}
+	assert.False(t, b.Modified())
+}
+
+func TestReloadUnreadable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "micro-reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "test.txt.gz")
+	ioutil.WriteFile(name, []byte("not gzip"), 0644)
+
+	b := NewBufferFromString("text", name, BTGZIP)
+	defer b.Close()
+	assert.Error(t, b.Reload())
+	assert.Equal(t, "text", string(b.Bytes()))
+
+	b = NewBufferFromString("text", filepath.Join(dir, "missing.txt"), BTDefault)
+	defer b.Close()
+	assert.Error(t, b.Reload())
+	assert.Equal(t, "text", string(b.Bytes()))
+}
+
+func TestSetText(t *testing.T) {
+	b := NewBufferFromString("package main\r\nfunc  main() {\r\n}\r\n", "", BTDefault)
+	defer b.Close()
+	assert.Equal(t, "package main\nfunc  main() {\n}\n", b.GetText())
+
+	c := b.GetActiveCursor()
+	c.GotoLoc(Loc{4, 0})
+	undos := b.UndoStack.Len()
+	assert.NoError(t, b.SetText("package main\r\n\r\nfunc main() {\r\n}\r\n"))
+	assert.Equal(t, "package main\n\nfunc main() {\n}\n", b.GetText())
+	assert.Equal(t, "package main\r\n\r\nfunc main() {\r\n}\r\n", string(b.Bytes()))
+	assert.Equal(t, undos+1, b.UndoStack.Len())
+	// the cursor stays on the same line and column
+	assert.Equal(t, Loc{4, 0}, c.Loc)
+
+	b.UndoOneEvent()
+	assert.Equal(t, "package main\nfunc  main() {\n}\n", b.GetText())
+
+	b.ProtectRange(0, 0)
+	assert.Error(t, b.SetText("package other\n"))
+	b.ClearProtectedRanges()
+
+	b.Type.Readonly = true
+	assert.Error(t, b.SetText(""))
+	assert.Equal(t, "package main\nfunc  main() {\n}\n", b.GetText())
+}
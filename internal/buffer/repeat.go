@@ -0,0 +1,99 @@
+package buffer
+
+// lastEdit describes the most recent edit executed by an EventHandler
+// relative to where it was made, so that RepeatLastEdit can make it again
+// somewhere else
+// Edits that follow each other, such as typing a word or deleting several
+// characters with backspace, are recorded as one edit, and so is removing
+// text and then inserting text at the same place
+type lastEdit struct {
+	// removed is the number of characters removed before inserted was
+	// inserted, and backward is whether they were before the cursor
+	removed  int
+	backward bool
+	inserted string
+
+	// start is where the edit was made and end is where the next edit must
+	// be made to be recorded together with it
+	start, end Loc
+	valid      bool
+}
+
+// record records the text event t, which is about to be executed, as the
+// last edit
+// An event with several deltas, such as replacing every match of a search,
+// cannot be made again at one place, so it leaves nothing to repeat
+func (e *lastEdit) record(t *TextEvent, la *LineArray) {
+	if len(t.Deltas) != 1 {
+		*e = lastEdit{}
+		return
+	}
+	d := t.Deltas[0]
+	switch t.EventType {
+	case TextEventInsert:
+		e.recordInsert(d.Start, textEnd(d.Start, d.Text), string(d.Text))
+	case TextEventRemove:
+		e.recordRemove(d.Start, d.End, DiffLA(d.Start, d.End, la), t.Backward)
+	case TextEventReplace:
+		if d.Start != d.End {
+			e.recordRemove(d.Start, d.End, DiffLA(d.Start, d.End, la), false)
+		}
+		if len(d.Text) > 0 {
+			e.recordInsert(d.Start, textEnd(d.Start, d.Text), string(d.Text))
+		}
+	}
+}
+
+// recordInsert records an insertion of text from start to end
+func (e *lastEdit) recordInsert(start, end Loc, text string) {
+	if e.valid && start == e.end {
+		e.inserted += text
+	} else {
+		*e = lastEdit{inserted: text, start: start, valid: true}
+	}
+	e.end = end
+}
+
+// recordRemove records the removal of the n characters from start to end,
+// which was backward if it was made with the cursor after the removed text
+func (e *lastEdit) recordRemove(start, end Loc, n int, backward bool) {
+	if e.valid && e.inserted == "" && e.backward == backward {
+		// backspace moves left one character at a time, delete keeps
+		// removing at the same place
+		if backward && end == e.start || !backward && start == e.start {
+			e.removed += n
+			e.start, e.end = start, start
+			return
+		}
+	}
+	*e = lastEdit{removed: n, backward: backward, start: start, end: start, valid: true}
+}
+
+// RepeatLastEdit makes the most recent edit again at the cursor as a
+// single undoable edit, and moves the cursor after the inserted text
+// The characters that were removed are counted from the cursor, before it
+// if they were deleted with the cursor after them, as with backspace
+// It returns false if there is no edit to repeat
+func (b *Buffer) RepeatLastEdit(c *Cursor) bool {
+	e := b.EventHandler.lastEdit
+	if !e.valid || b.Type.Readonly {
+		return false
+	}
+
+	start, end := c.Loc, c.Loc
+	if e.backward {
+		start = start.MoveLA(-e.removed, b.LineArray)
+	} else {
+		end = end.MoveLA(e.removed, b.LineArray)
+	}
+	c.ResetSelection()
+	b.EventHandler.cursors = b.cursors
+	b.EventHandler.active = b.curCursor
+	b.EventHandler.ReplaceRange(start, end, e.inserted)
+	// the replacement is recorded as a forward removal, so the repeated
+	// edit is kept instead, which would otherwise turn backspaces into
+	// deletes, and it is not merged with the edits that follow
+	e.start, e.end = Loc{-1, -1}, Loc{-1, -1}
+	b.EventHandler.lastEdit = e
+	return true
+}
@@ -0,0 +1,112 @@
+package buffer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepeatInsert(t *testing.T) {
+	b := NewBufferFromString("one\ntwo\n", "", BTDefault)
+	defer b.Close()
+
+	b.Insert(Loc{3, 0}, "a")
+	b.Insert(Loc{4, 0}, "b")
+
+	c := b.GetActiveCursor()
+	c.GotoLoc(Loc{1, 1})
+	undos := b.UndoStack.Len()
+	assert.True(t, b.RepeatLastEdit(c))
+
+	assert.Equal(t, "oneab\ntabwo\n", string(b.Bytes()))
+	assert.Equal(t, Loc{3, 1}, c.Loc)
+	assert.Equal(t, undos+1, b.UndoStack.Len())
+}
+
+func TestRepeatBackspace(t *testing.T) {
+	b := NewBufferFromString("abcdef\nghijkl", "", BTDefault)
+	defer b.Close()
+
+	c := b.GetActiveCursor()
+	c.GotoLoc(Loc{6, 0})
+	b.RemoveBackward(Loc{5, 0}, Loc{6, 0})
+	b.RemoveBackward(Loc{4, 0}, Loc{5, 0})
+	assert.Equal(t, "abcd\nghijkl", string(b.Bytes()))
+
+	c.GotoLoc(Loc{4, 1})
+	assert.True(t, b.RepeatLastEdit(c))
+	assert.Equal(t, "abcd\nghkl", string(b.Bytes()))
+	assert.Equal(t, Loc{2, 1}, c.Loc)
+
+	// the repeated edit can be repeated again
+	assert.True(t, b.RepeatLastEdit(c))
+	assert.Equal(t, "abcd\nkl", string(b.Bytes()))
+}
+
+func TestRepeatDelete(t *testing.T) {
+	b := NewBufferFromString("abcdef\nghijkl", "", BTDefault)
+	defer b.Close()
+
+	c := b.GetActiveCursor()
+	c.GotoLoc(Loc{1, 0})
+	b.Remove(Loc{1, 0}, Loc{2, 0})
+	b.Remove(Loc{1, 0}, Loc{2, 0})
+	b.Remove(Loc{1, 0}, Loc{2, 0})
+	assert.Equal(t, "aef\nghijkl", string(b.Bytes()))
+
+	c.GotoLoc(Loc{0, 1})
+	assert.True(t, b.RepeatLastEdit(c))
+	assert.Equal(t, "aef\njkl", string(b.Bytes()))
+	assert.Equal(t, Loc{0, 1}, c.Loc)
+}
+
+func TestRepeatReplace(t *testing.T) {
+	b := NewBufferFromString("foo bar\nfoo baz", "", BTDefault)
+	defer b.Close()
+
+	c := b.GetActiveCursor()
+	c.GotoLoc(Loc{3, 0})
+	b.Remove(Loc{0, 0}, Loc{3, 0})
+	b.Insert(Loc{0, 0}, "qux")
+	assert.Equal(t, "qux bar\nfoo baz", string(b.Bytes()))
+
+	// the removal was made forward, from where the text was inserted
+	c.GotoLoc(Loc{0, 1})
+	assert.True(t, b.RepeatLastEdit(c))
+	assert.Equal(t, "qux bar\nqux baz", string(b.Bytes()))
+	assert.Equal(t, Loc{3, 1}, c.Loc)
+}
+
+func TestRepeatEventHandlerEdits(t *testing.T) {
+	b := NewBufferFromString("abc\ndef\nghi", "", BTDefault)
+	defer b.Close()
+
+	// edits made through the event handler are recorded too, and the
+	// direction of a removal does not depend on where the cursor is
+	c := b.GetActiveCursor()
+	c.GotoLoc(Loc{3, 0})
+	b.EventHandler.Remove(Loc{0, 0}, Loc{1, 0})
+	c.GotoLoc(Loc{0, 1})
+	assert.True(t, b.RepeatLastEdit(c))
+	assert.Equal(t, "bc\nef\nghi", string(b.Bytes()))
+
+	b.EventHandler.Replace(Loc{0, 2}, Loc{1, 2}, "xy")
+	c.GotoLoc(Loc{0, 0})
+	assert.True(t, b.RepeatLastEdit(c))
+	assert.Equal(t, "xyc\nef\nxyhi", string(b.Bytes()))
+
+	// a replacement in several places cannot be repeated at the cursor
+	b.EventHandler.MultipleReplace([]Delta{
+		{[]byte("E"), Loc{0, 1}, Loc{1, 1}},
+		{[]byte("C"), Loc{2, 0}, Loc{3, 0}},
+	})
+	assert.Equal(t, "xyC\nEf\nxyhi", string(b.Bytes()))
+	assert.False(t, b.RepeatLastEdit(c))
+}
+
+func TestRepeatNothing(t *testing.T) {
+	b := NewBufferFromString("abc", "", BTDefault)
+	defer b.Close()
+
+	assert.False(t, b.RepeatLastEdit(b.GetActiveCursor()))
+}
@@ -15,6 +15,7 @@ import (
 
 	"github.com/zyedidia/micro/internal/config"
 	encode "github.com/zyedidia/micro/internal/encoding"
+	"github.com/zyedidia/micro/internal/remote"
 	"github.com/zyedidia/micro/internal/screen"
 	"github.com/zyedidia/micro/internal/util"
 	"golang.org/x/text/encoding"
@@ -22,10 +23,50 @@ import (
 	"golang.org/x/text/transform"
 )
 
-// LargeFileThreshold is the number of bytes when fastdirty is forced
-// because hashing is too slow
+// LargeFileThreshold is the default of the largefilethreshold option
 const LargeFileThreshold = 50000
 
+// largeFileThreshold returns the number of bytes when fastdirty is forced
+// because hashing is too slow, which is the largefilethreshold option
+func largeFileThreshold() int {
+	if t, ok := config.GetGlobalOption("largefilethreshold").(float64); ok {
+		return int(t)
+	}
+	return LargeFileThreshold
+}
+
+// ErrNoParentDirs is returned when saving to a path whose parent
+// directories don't exist and may not be created
+var ErrNoParentDirs = errors.New("Parent dirs don't exist, enable 'mkparents' for auto creation")
+
+// ErrChangedOnDisk is returned when saving a buffer to its file would
+// overwrite changes that another program made to the file since the buffer
+// last read or wrote it
+var ErrChangedOnDisk = errors.New("The file has changed on disk since it was opened")
+
+// saveProgressInterval is the number of bytes written between two calls to
+// the progress callback of SaveAsWithProgress
+const saveProgressInterval = 1 << 20
+
+// A progressWriter counts the bytes written to w and calls progress about
+// once every saveProgressInterval bytes
+type progressWriter struct {
+	w        io.Writer
+	progress func(written, total int64)
+
+	written, reported, total int64
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.written += int64(n)
+	if p.progress != nil && p.written-p.reported >= saveProgressInterval {
+		p.progress(p.written, p.total)
+		p.reported = p.written
+	}
+	return n, err
+}
+
 // overwriteFile opens the given file for writing, truncating if one exists, and then calls
 // the supplied function with the file as io.Writer object, also making sure the file is
 // closed afterwards.
@@ -53,7 +94,7 @@ func (b *Buffer) overwriteFile(name string, enc encoding.Encoding, fn func(io.Wr
 			}
 			screen.TempStart(screenb)
 		}()
-	} else if writeCloser, err = os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644); err != nil {
+	} else if writeCloser, err = fsFor(name).Create(name); err != nil {
 		return
 	}
 
@@ -93,8 +134,101 @@ func (b *Buffer) Save() error {
 }
 
 // SaveAs saves the buffer to a specified path (filename), creating the file if it does not exist
+// It returns ErrChangedOnDisk instead if filename is the buffer's file and
+// it was changed by another program, see SaveAsForce
 func (b *Buffer) SaveAs(filename string) error {
-	return b.saveToFile(filename, false)
+	if b.changedOnDisk(filename) {
+		return ErrChangedOnDisk
+	}
+	return b.saveToFile(filename, false, nil)
+}
+
+// SaveAsForce is the same as SaveAs but overwrites the file even if it was
+// changed by another program
+func (b *Buffer) SaveAsForce(filename string) error {
+	return b.saveToFile(filename, false, nil)
+}
+
+// changedOnDisk returns whether filename is the buffer's file and another
+// program changed it since the buffer last read or wrote it
+func (b *Buffer) changedOnDisk(filename string) bool {
+	if b.Path == "" || b.ModTime.IsZero() {
+		return false
+	}
+	absFilename, _ := util.ReplaceHome(filename)
+	if absolutePath(absFilename) != b.AbsPath {
+		return false
+	}
+	change := b.ExternalChange()
+	return change == ChangeModified || change == ChangeTruncated
+}
+
+// SaveAsQuiet is the same as SaveAs but, whatever the mkparents option is
+// set to, it either creates missing parent directories or returns
+// ErrNoParentDirs, depending on mkparents
+// It is meant for plugins and scripts that need the same behavior every
+// time
+func (b *Buffer) SaveAsQuiet(filename string, mkparents bool) error {
+	if dirname, missing := missingParents(filename); missing {
+		if !mkparents {
+			return ErrNoParentDirs
+		}
+		if err := os.MkdirAll(dirname, os.ModePerm); err != nil {
+			return err
+		}
+	}
+	return b.SaveAs(filename)
+}
+
+// missingParents returns the parent directory of filename and whether it
+// does not exist
+// The parent directories of remote files are not checked
+func missingParents(filename string) (string, bool) {
+	if remote.IsRemote(filename) {
+		return "", false
+	}
+	// Removes any tilde and replaces with the absolute path to home
+	absFilename, _ := util.ReplaceHome(filename)
+
+	// Get the leading path to the file | "." is returned if there's no leading path provided
+	dirname := filepath.Dir(absFilename)
+	if dirname == "." {
+		return dirname, false
+	}
+	_, err := os.Stat(dirname)
+	return dirname, os.IsNotExist(err)
+}
+
+// CanAutoSave returns whether the autosave option should save the buffer:
+// it is modified and has a file, and saving it would not have to ask
+// anything, such as the password of an encrypted file or whether to create
+// missing parent directories
+// A buffer whose file was changed by another program is not saved either,
+// which would overwrite those changes without asking
+func (b *Buffer) CanAutoSave() bool {
+	if b.Path == "" || b.Type.Readonly || b.Type.Scratch || !b.Modified() {
+		return false
+	}
+	if t := GetBufferType(b.Path, b.Type); t == BTGPG || t == BTArmorGPG {
+		if password, _ := b.Settings["password"].(string); password == "" {
+			return false
+		}
+	}
+	if _, missing := missingParents(b.Path); missing && !b.Settings["mkparents"].(bool) {
+		return false
+	}
+	return !b.changedOnDisk(b.Path)
+}
+
+// SaveAsWithProgress is the same as SaveAs but calls progress with the
+// number of bytes written so far and the total number of bytes to write
+// The callback is called about once per megabyte rather than for every
+// line, and once more when everything has been written
+func (b *Buffer) SaveAsWithProgress(filename string, progress func(written, total int64)) error {
+	if b.changedOnDisk(filename) {
+		return ErrChangedOnDisk
+	}
+	return b.saveToFile(filename, false, progress)
 }
 
 func (b *Buffer) SaveWithSudo() error {
@@ -102,13 +236,34 @@ func (b *Buffer) SaveWithSudo() error {
 }
 
 func (b *Buffer) SaveAsWithSudo(filename string) error {
-	return b.saveToFile(filename, true)
+	return b.saveToFile(filename, true, nil)
+}
+
+// FileBytes returns the text as saving the buffer would write it, before
+// it is encoded, compressed or encrypted: with the line endings of the
+// fileformat option and a final newline if eofnewline is on
+// Unlike saving, it leaves the buffer unchanged and does not remove
+// trailing whitespace for the rmtrailingws option
+func (b *Buffer) FileBytes() []byte {
+	var buf bytes.Buffer
+	buf.Grow(b.Len() + 2)
+	b.WriteTo(&buf)
+
+	if eofnewline, _ := b.Settings["eofnewline"].(bool); eofnewline {
+		if end := b.End(); b.RuneAt(end) != '\n' {
+			if b.Endings == FFDos {
+				buf.WriteByte('\r')
+			}
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes()
 }
 
-func (b *Buffer) saveToFile(filename string, withSudo bool) error {
+func (b *Buffer) saveToFile(filename string, withSudo bool, progress func(written, total int64)) error {
 	var err error
 	if b.Type.Readonly {
-		return errors.New("Cannot save readonly buffer")
+		return errors.New("Cannot save readonly buffer, run 'setlocal readonly off' to save it anyway")
 	}
 	if b.Type.Scratch {
 		return errors.New("Cannot save scratch buffer")
@@ -116,17 +271,16 @@ func (b *Buffer) saveToFile(filename string, withSudo bool) error {
 	if withSudo && runtime.GOOS == "windows" {
 		return errors.New("Save with sudo not supported on Windows")
 	}
+	if withSudo && remote.IsRemote(filename) {
+		return errors.New("Save with sudo not supported for remote files")
+	}
+	if !b.preSaveHook() {
+		return ErrSaveCanceled
+	}
 
 	b.UpdateRules()
 	if b.Settings["rmtrailingws"].(bool) {
-		for i, l := range b.lines {
-			leftover := utf8.RuneCount(bytes.TrimRightFunc(l.data, unicode.IsSpace))
-
-			linelen := utf8.RuneCount(l.data)
-			b.Remove(Loc{leftover, i}, Loc{linelen, i})
-		}
-
-		b.RelocateCursors()
+		b.TrimTrailingWhitespace(0, b.LinesNum()-1)
 	}
 
 	if b.Settings["eofnewline"].(bool) {
@@ -138,27 +292,23 @@ func (b *Buffer) saveToFile(filename string, withSudo bool) error {
 
 	// Update the last time this file was updated after saving
 	defer func() {
-		b.ModTime, _ = util.GetModTime(filename)
+		b.ModTime, _ = modTime(filename)
 		err = b.Serialize()
 	}()
 
 	// Removes any tilde and replaces with the absolute path to home
 	absFilename, _ := util.ReplaceHome(filename)
 
-	// Get the leading path to the file | "." is returned if there's no leading path provided
-	if dirname := filepath.Dir(absFilename); dirname != "." {
-		// Check if the parent dirs don't exist
-		if _, statErr := os.Stat(dirname); os.IsNotExist(statErr) {
-			// Prompt to make sure they want to create the dirs that are missing
-			if b.Settings["mkparents"].(bool) {
-				// Create all leading dir(s) since they don't exist
-				if mkdirallErr := os.MkdirAll(dirname, os.ModePerm); mkdirallErr != nil {
-					// If there was an error creating the dirs
-					return mkdirallErr
-				}
-			} else {
-				return errors.New("Parent dirs don't exist, enable 'mkparents' for auto creation")
+	// Check if the parent dirs don't exist
+	if dirname, missing := missingParents(filename); missing {
+		if b.Settings["mkparents"].(bool) {
+			// Create all leading dir(s) since they don't exist
+			if mkdirallErr := os.MkdirAll(dirname, os.ModePerm); mkdirallErr != nil {
+				// If there was an error creating the dirs
+				return mkdirallErr
 			}
+		} else {
+			return ErrNoParentDirs
 		}
 	}
 
@@ -174,47 +324,66 @@ func (b *Buffer) saveToFile(filename string, withSudo bool) error {
 			return
 		}
 
-		// end of line
-		var eol []byte
-		if b.Endings == FFDos {
-			eol = []byte{'\r', '\n'}
-		} else {
-			eol = []byte{'\n'}
+		w := &progressWriter{w: file, progress: progress}
+		if progress != nil {
+			w.total = int64(b.Len())
 		}
-
-		// write lines
-		if fileSize, e = file.Write(b.lines[0].data); e != nil {
-			return
-		}
-
-		for _, l := range b.lines[1:] {
-			if _, e = file.Write(eol); e != nil {
-				return
-			}
-			if _, e = file.Write(l.data); e != nil {
-				return
-			}
-			fileSize += len(eol) + len(l.data)
+		_, e = b.WriteTo(w)
+		fileSize = int(w.written)
+		if e == nil && progress != nil {
+			progress(w.written, w.total)
 		}
 		return
 	}
 
+	// the lines still read from the file must be in memory before it is
+	// overwritten
+	if b.readsFrom(absFilename) {
+		b.Detach()
+	}
+
 	if err = b.overwriteFile(absFilename, enc, fwriter, withSudo); err != nil {
 		return err
 	}
 
 	if !b.Settings["fastdirty"].(bool) {
-		if fileSize > LargeFileThreshold {
+		if fileSize > largeFileThreshold() {
 			// For large files 'fastdirty' needs to be on
 			b.Settings["fastdirty"] = true
 		} else {
-			calcHash(b, &b.origHash)
+			b.updateOrigHash()
 		}
 	}
 
 	b.Path = filename
-	absPath, _ := filepath.Abs(filename)
-	b.AbsPath = absPath
+	b.AbsPath = absolutePath(filename)
 	b.isModified = false
+	b.clearDirty()
+	b.saveHook()
 	return err
 }
+
+// TrimTrailingWhitespace removes the whitespace at the end of the lines
+// from start to end (inclusive) as a single undoable edit and returns the
+// number of lines that changed
+// Cursors that were in the removed whitespace move to the end of the line
+func (b *Buffer) TrimTrailingWhitespace(start, end int) int {
+	if start > end {
+		start, end = end, start
+	}
+
+	var deltas []Delta
+	for i := end; i >= start; i-- {
+		l := b.LineBytes(i)
+		leftover := utf8.RuneCount(bytes.TrimRightFunc(l, unicode.IsSpace))
+		linelen := utf8.RuneCount(l)
+		if leftover != linelen {
+			deltas = append(deltas, Delta{[]byte{}, Loc{leftover, i}, Loc{linelen, i}})
+		}
+	}
+	if len(deltas) > 0 {
+		b.MultipleReplace(deltas)
+		b.RelocateCursors()
+	}
+	return len(deltas)
+}
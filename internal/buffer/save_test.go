@@ -0,0 +1,214 @@
+package buffer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSaveAsWithProgress(t *testing.T) {
+	dir, err := ioutil.TempDir("", "micro-save")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	text := strings.Repeat("the quick brown fox jumps over the lazy dog\n", 100000)
+	b := NewBufferFromString(text, "", BTDefault)
+	b.Settings["eofnewline"] = false
+
+	var calls [][2]int64
+	name := filepath.Join(dir, "large.txt")
+	err = b.SaveAsWithProgress(name, func(written, total int64) {
+		calls = append(calls, [2]int64{written, total})
+	})
+	assert.NoError(t, err)
+
+	total := int64(len(text))
+	info, err := os.Stat(name)
+	assert.NoError(t, err)
+	assert.Equal(t, total, info.Size())
+
+	// about one call per megabyte, not one per line
+	assert.True(t, len(calls) >= 2)
+	assert.True(t, int64(len(calls)) <= total/saveProgressInterval+1)
+	for i, c := range calls {
+		assert.Equal(t, total, c[1])
+		if i > 0 {
+			assert.True(t, c[0] > calls[i-1][0])
+		}
+	}
+	assert.Equal(t, total, calls[len(calls)-1][0])
+
+	b.Close()
+}
+
+func TestDirtyLines(t *testing.T) {
+	dir, err := ioutil.TempDir("", "micro-dirty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	b := NewBufferFromString("one\ntwo\nthree\nfour\nfive", "", BTDefault)
+	b.Settings["backup"] = false
+	assert.Empty(t, b.DirtyLines())
+
+	b.Insert(Loc{3, 1}, "!")
+	b.Replace(Loc{0, 3}, Loc{4, 3}, "4")
+	assert.Equal(t, map[int]bool{1: true, 3: true}, b.DirtyLines())
+
+	// a new line is dirty and the lines below it move down
+	b.Insert(Loc{3, 0}, "\nzero")
+	assert.Equal(t, map[int]bool{0: true, 1: true, 2: true, 4: true}, b.DirtyLines())
+
+	b.Remove(Loc{0, 1}, Loc{0, 2})
+	assert.Equal(t, map[int]bool{0: true, 1: true, 3: true}, b.DirtyLines())
+
+	assert.NoError(t, b.SaveAs(filepath.Join(dir, "dirty.txt")))
+	assert.Empty(t, b.DirtyLines())
+
+	b.Close()
+}
+
+func TestSaveAsQuiet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "micro-save")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	b := NewBufferFromString("text", "", BTDefault)
+	defer b.Close()
+	b.Settings["mkparents"] = true
+
+	name := filepath.Join(dir, "a", "b", "test.txt")
+	assert.Equal(t, ErrNoParentDirs, b.SaveAsQuiet(name, false))
+	_, err = os.Stat(filepath.Join(dir, "a"))
+	assert.True(t, os.IsNotExist(err))
+
+	b.Settings["mkparents"] = false
+	assert.Equal(t, ErrNoParentDirs, b.SaveAs(name))
+	assert.NoError(t, b.SaveAsQuiet(name, true))
+	data, err := ioutil.ReadFile(name)
+	assert.NoError(t, err)
+	assert.Equal(t, "text", strings.TrimSuffix(string(data), "\n"))
+}
+
+func TestFileBytes(t *testing.T) {
+	b := NewBufferFromString("one  \ntwo", "", BTDefault)
+	b.Settings["rmtrailingws"] = true
+
+	b.Settings["eofnewline"] = false
+	assert.Equal(t, "one  \ntwo", string(b.FileBytes()))
+
+	b.Settings["eofnewline"] = true
+	assert.Equal(t, "one  \ntwo\n", string(b.FileBytes()))
+
+	b.Endings = FFDos
+	assert.Equal(t, "one  \r\ntwo\r\n", string(b.FileBytes()))
+
+	// the buffer already ends with a newline
+	b.Insert(b.End(), "\n")
+	assert.Equal(t, "one  \r\ntwo\r\n", string(b.FileBytes()))
+	assert.Equal(t, b.Bytes(), b.FileBytes())
+
+	b.Close()
+}
+
+func TestCanAutoSave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "micro-autosave")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	newBuf := func(name string) *Buffer {
+		b := NewBufferFromString("text", "", BTDefault)
+		b.Settings["mkparents"] = false
+		b.Settings["backup"] = false
+		b.Path = filepath.Join(dir, name)
+		b.Insert(b.End(), " more")
+		return b
+	}
+
+	b := newBuf("file.txt")
+	assert.True(t, b.CanAutoSave())
+
+	b.Path = ""
+	assert.False(t, b.CanAutoSave())
+
+	b = newBuf("file.txt")
+	b.Undo()
+	assert.False(t, b.CanAutoSave())
+
+	b = newBuf("missing/file.txt")
+	assert.False(t, b.CanAutoSave())
+	b.Settings["mkparents"] = true
+	assert.True(t, b.CanAutoSave())
+
+	b = newBuf("file.txt.gpg")
+	b.Settings["password"] = ""
+	assert.False(t, b.CanAutoSave())
+	b.Settings["password"] = "secret"
+	assert.True(t, b.CanAutoSave())
+
+	b = newBuf("file.txt")
+	b.Type = BTScratch
+	assert.False(t, b.CanAutoSave())
+
+	// a file changed by another program is not overwritten
+	name := filepath.Join(dir, "changed.txt")
+	assert.NoError(t, ioutil.WriteFile(name, []byte("text"), 0644))
+	b = NewBufferFromString("text", name, BTDefault)
+	b.Settings["backup"] = false
+	b.Insert(b.End(), " more")
+	assert.True(t, b.CanAutoSave())
+	assert.NoError(t, ioutil.WriteFile(name, []byte("other text"), 0644))
+	later := time.Now().Add(time.Minute)
+	assert.NoError(t, os.Chtimes(name, later, later))
+	assert.False(t, b.CanAutoSave())
+	b.Close()
+}
+
+func TestSaveChangedOnDisk(t *testing.T) {
+	dir, err := ioutil.TempDir("", "micro-changed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "file.txt")
+	assert.NoError(t, ioutil.WriteFile(name, []byte("one\n"), 0644))
+	b, err := NewBufferFromFile(name, BTDefault, nil)
+	assert.NoError(t, err)
+	b.Settings["backup"] = false
+	b.Insert(b.End(), "two\n")
+
+	// another program writes the file a little later
+	assert.NoError(t, ioutil.WriteFile(name, []byte("other\n"), 0644))
+	later := b.ModTime.Add(time.Second)
+	assert.NoError(t, os.Chtimes(name, later, later))
+
+	assert.Equal(t, ErrChangedOnDisk, b.Save())
+	data, _ := ioutil.ReadFile(name)
+	assert.Equal(t, "other\n", string(data))
+
+	// another file is not affected
+	assert.NoError(t, b.SaveAs(filepath.Join(dir, "copy.txt")))
+	b.Path = name
+	b.AbsPath = name
+
+	assert.NoError(t, b.SaveAsForce(name))
+	data, _ = ioutil.ReadFile(name)
+	assert.Equal(t, "one\ntwo\n", string(data))
+
+	// the buffer wrote the file last, so saving again just works
+	assert.NoError(t, b.Save())
+	b.Close()
+}
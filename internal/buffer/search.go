@@ -1,6 +1,7 @@
 package buffer
 
 import (
+	"bytes"
 	"regexp"
 	"unicode/utf8"
 
@@ -89,6 +90,18 @@ func (b *Buffer) findUp(r *regexp.Regexp, start, end Loc) ([2]Loc, bool) {
 	return [2]Loc{}, false
 }
 
+// searchRegex compiles the search for s, which is quoted unless useRegex
+// is true, and is case insensitive if the ignorecase option is on
+func (b *Buffer) searchRegex(s string, useRegex bool) (*regexp.Regexp, error) {
+	if !useRegex {
+		s = regexp.QuoteMeta(s)
+	}
+	if b.Settings["ignorecase"].(bool) {
+		s = "(?i)" + s
+	}
+	return regexp.Compile(s)
+}
+
 // FindNext finds the next occurrence of a given string in the buffer
 // It returns the start and end location of the match (if found) and
 // a boolean indicating if it was found
@@ -98,19 +111,7 @@ func (b *Buffer) FindNext(s string, start, end, from Loc, down bool, useRegex bo
 		return [2]Loc{}, false, nil
 	}
 
-	var r *regexp.Regexp
-	var err error
-
-	if !useRegex {
-		s = regexp.QuoteMeta(s)
-	}
-
-	if b.Settings["ignorecase"].(bool) {
-		r, err = regexp.Compile("(?i)" + s)
-	} else {
-		r, err = regexp.Compile(s)
-	}
-
+	r, err := b.searchRegex(s, useRegex)
 	if err != nil {
 		return [2]Loc{}, false, err
 	}
@@ -131,9 +132,117 @@ func (b *Buffer) FindNext(s string, start, end, from Loc, down bool, useRegex bo
 	return l, found, nil
 }
 
+// lineMatches returns the submatch indices (as byte offsets into the whole
+// line) of all matches of r on line y that lie entirely between the rune
+// positions startX and endX
+// Matching is done against the whole line so that anchors and word
+// boundaries behave the same as without a range, and matches that straddle
+// either end of the range are ignored
+func (b *Buffer) lineMatches(r *regexp.Regexp, y, startX, endX int) [][]int {
+	l := b.LineBytes(y)
+	startByte := len(util.SliceStart(l, startX))
+	endByte := len(util.SliceStart(l, endX))
+
+	var matches [][]int
+	for _, m := range r.FindAllSubmatchIndex(l, -1) {
+		if m[0] >= startByte && m[1] <= endByte {
+			matches = append(matches, m)
+		}
+	}
+	return matches
+}
+
+// runeLocs returns the rune positions of the start and end of the matches
+// on line l, counted in a single pass
+func runeLocs(l []byte, matches [][]int) [][2]int {
+	locs := make([][2]int, len(matches))
+	x, last := 0, 0
+	for j, m := range matches {
+		x += utf8.RuneCount(l[last:m[0]])
+		locs[j][0] = x
+		x += utf8.RuneCount(l[m[0]:m[1]])
+		locs[j][1] = x
+		last = m[1]
+	}
+	return locs
+}
+
+// FindAll returns the start and end of every occurrence of s in the
+// buffer, in order, with the same options as FindNext
+// The search is compiled once for all the lines
+func (b *Buffer) FindAll(s string, useRegex bool) ([][2]Loc, error) {
+	if s == "" {
+		return nil, nil
+	}
+	r, err := b.searchRegex(s, useRegex)
+	if err != nil {
+		return nil, err
+	}
+	return b.FindAllInRange(r, b.Start(), b.End()), nil
+}
+
+// FindAllInRange returns the start and end of every match of r that lies
+// completely between start and end, in order
+func (b *Buffer) FindAllInRange(r *regexp.Regexp, start, end Loc) [][2]Loc {
+	if start.GreaterThan(end) {
+		start, end = end, start
+	}
+
+	var found [][2]Loc
+	for i := util.Max(start.Y, 0); i <= end.Y && i < b.LinesNum(); i++ {
+		l := b.LineBytes(i)
+		startX, endX := 0, utf8.RuneCount(l)
+		if i == start.Y {
+			startX = util.Min(start.X, endX)
+		}
+		if i == end.Y {
+			endX = util.Min(end.X, endX)
+		}
+
+		matches := b.lineMatches(r, i, startX, endX)
+		for _, loc := range runeLocs(l, matches) {
+			found = append(found, [2]Loc{{loc[0], i}, {loc[1], i}})
+		}
+	}
+	return found
+}
+
+// FindNextInRange finds the first match of r at or after 'from' that lies
+// completely between start and end
+// Unlike FindNext it does not wrap around
+func (b *Buffer) FindNextInRange(r *regexp.Regexp, start, end, from Loc) ([2]Loc, bool) {
+	if start.GreaterThan(end) {
+		start, end = end, start
+	}
+	if from.LessThan(start) {
+		from = start
+	}
+
+	for i := from.Y; i <= end.Y && i < b.LinesNum(); i++ {
+		l := b.LineBytes(i)
+		startX, endX := 0, utf8.RuneCount(l)
+		if i == from.Y {
+			startX = from.X
+		}
+		if i == end.Y {
+			endX = util.Min(end.X, endX)
+		}
+
+		matches := b.lineMatches(r, i, startX, endX)
+		if len(matches) > 0 {
+			m := matches[0]
+			return [2]Loc{{util.RunePos(l, m[0]), i}, {util.RunePos(l, m[1]), i}}, true
+		}
+	}
+	return [2]Loc{}, false
+}
+
 // ReplaceRegex replaces all occurrences of 'search' with 'replace' in the given area
 // and returns the number of replacements made and the number of runes
 // added or removed
+// Submatch references such as $1 or ${name} in 'replace' are expanded for each
+// match (see regexp.Expand); use $$ for a literal $
+// Matches that extend beyond the area are not replaced
 func (b *Buffer) ReplaceRegex(start, end Loc, search *regexp.Regexp, replace []byte) (int, int) {
 	if start.GreaterThan(end) {
 		start, end = end, start
@@ -143,36 +252,165 @@ func (b *Buffer) ReplaceRegex(start, end Loc, search *regexp.Regexp, replace []b
 
 	found := 0
 	var deltas []Delta
-	for i := start.Y; i <= end.Y; i++ {
-		l := b.lines[i].data
-		charpos := 0
-
-		if start.Y == end.Y && i == start.Y {
-			l = util.SliceStart(l, end.X)
-			l = util.SliceEnd(l, start.X)
-			charpos = start.X
-		} else if i == start.Y {
-			l = util.SliceEnd(l, start.X)
-			charpos = start.X
-		} else if i == end.Y {
-			l = util.SliceStart(l, end.X)
+	// The deltas are ordered from the end of the area to its start, so each
+	// one is applied before anything to its left or above it changes and
+	// its location never needs to be adjusted for earlier replacements
+	for i := end.Y; i >= start.Y; i-- {
+		l := b.LineBytes(i)
+		startX, endX := 0, utf8.RuneCount(l)
+		if i == start.Y {
+			startX = util.Min(start.X, endX)
+		}
+		if i == end.Y {
+			endX = util.Min(end.X, endX)
 		}
-		newText := search.ReplaceAllFunc(l, func(in []byte) []byte {
-			result := []byte{}
-			for _, submatches := range search.FindAllSubmatchIndex(in, -1) {
-				result = search.Expand(result, replace, in, submatches)
-			}
-			found++
-			netrunes += utf8.RuneCount(in) - utf8.RuneCount(result)
-			return result
-		})
 
-		from := Loc{charpos, i}
-		to := Loc{charpos + utf8.RuneCount(l), i}
+		matches := b.lineMatches(search, i, startX, endX)
+		if len(matches) == 0 {
+			continue
+		}
 
-		deltas = append(deltas, Delta{newText, from, to})
+		locs := runeLocs(l, matches)
+		for j := len(matches) - 1; j >= 0; j-- {
+			result := search.Expand(nil, replace, l, matches[j])
+			deltas = append(deltas, Delta{result, Loc{locs[j][0], i}, Loc{locs[j][1], i}})
+			netrunes += utf8.RuneCount(result) - (locs[j][1] - locs[j][0])
+		}
+		found += len(matches)
+	}
+	if len(deltas) > 0 {
+		b.MultipleReplace(deltas)
 	}
-	b.MultipleReplace(deltas)
 
 	return found, netrunes
 }
+
+// EachLineMatching calls fn on every line of the buffer that matches re
+// and replaces the line with what fn returns, as a single undoable edit
+// It returns the number of lines that were changed
+func (b *Buffer) EachLineMatching(re *regexp.Regexp, fn func(string) string) int {
+	return b.EachLineMatchingInRange(0, b.LinesNum()-1, re, fn)
+}
+
+// EachLineMatchingInRange is the same as EachLineMatching but only looks
+// at the lines from start to end (inclusive)
+func (b *Buffer) EachLineMatchingInRange(start, end int, re *regexp.Regexp, fn func(string) string) int {
+	if start > end {
+		start, end = end, start
+	}
+	start = util.Max(start, 0)
+	end = util.Min(end, b.LinesNum()-1)
+
+	var deltas []Delta
+	for i := end; i >= start; i-- {
+		l := b.LineBytes(i)
+		if !re.Match(l) {
+			continue
+		}
+		result := fn(string(l))
+		if result == string(l) {
+			continue
+		}
+		deltas = append(deltas, Delta{[]byte(result), Loc{0, i}, Loc{utf8.RuneCount(l), i}})
+	}
+	if len(deltas) > 0 {
+		b.MultipleReplace(deltas)
+	}
+	return len(deltas)
+}
+
+// ExpandReplacement returns the text that ReplaceRegex would insert in place
+// of the match of 'search' found between start and end
+// A match that spans several lines is expanded as ReplaceRegexMultiline
+// would expand it
+func (b *Buffer) ExpandReplacement(start, end Loc, search *regexp.Regexp, replace []byte) []byte {
+	if start.Y != end.Y {
+		text := b.Substr(start, end)
+		if m := search.FindSubmatchIndex(text); m != nil {
+			return search.Expand(nil, replace, text, m)
+		}
+		return replace
+	}
+	matches := b.lineMatches(search, start.Y, start.X, end.X)
+	if len(matches) == 0 {
+		return replace
+	}
+	return search.Expand(nil, replace, b.LineBytes(start.Y), matches[0])
+}
+
+// textLocs converts sorted byte offsets into text, which is the text of the
+// buffer from start with a newline between lines, to locations in a single
+// pass
+func textLocs(text []byte, start Loc, offsets []int) []Loc {
+	locs := make([]Loc, len(offsets))
+	loc, last := start, 0
+	for i, off := range offsets {
+		seg := text[last:off]
+		if n := bytes.Count(seg, []byte{'\n'}); n > 0 {
+			loc.Y += n
+			loc.X = utf8.RuneCount(seg[bytes.LastIndexByte(seg, '\n')+1:])
+		} else {
+			loc.X += utf8.RuneCount(seg)
+		}
+		locs[i] = loc
+		last = off
+	}
+	return locs
+}
+
+// FindNextMultiline is the same as FindNextInRange but matches r against
+// the text between from and end as a whole, with a newline between lines,
+// so that a match can span several lines
+func (b *Buffer) FindNextMultiline(r *regexp.Regexp, start, end, from Loc) ([2]Loc, bool) {
+	if start.GreaterThan(end) {
+		start, end = end, start
+	}
+	if from.LessThan(start) {
+		from = start
+	}
+	from, end = clamp(from, b.LineArray), clamp(end, b.LineArray)
+	if end.LessThan(from) {
+		return [2]Loc{}, false
+	}
+
+	text := b.Substr(from, end)
+	m := r.FindIndex(text)
+	if m == nil {
+		return [2]Loc{}, false
+	}
+	locs := textLocs(text, from, m)
+	return [2]Loc{locs[0], locs[1]}, true
+}
+
+// ReplaceRegexMultiline is the same as ReplaceRegex but matches 'search'
+// against the text between start and end as a whole, with a newline between
+// lines, so that a match can span several lines, for example to replace
+// `\n\n+` with `\n`
+func (b *Buffer) ReplaceRegexMultiline(start, end Loc, search *regexp.Regexp, replace []byte) (int, int) {
+	if start.GreaterThan(end) {
+		start, end = end, start
+	}
+	start, end = clamp(start, b.LineArray), clamp(end, b.LineArray)
+
+	text := b.Substr(start, end)
+	matches := search.FindAllSubmatchIndex(text, -1)
+	if len(matches) == 0 {
+		return 0, 0
+	}
+	offsets := make([]int, 0, 2*len(matches))
+	for _, m := range matches {
+		offsets = append(offsets, m[0], m[1])
+	}
+	locs := textLocs(text, start, offsets)
+
+	netrunes := 0
+	deltas := make([]Delta, 0, len(matches))
+	for j := len(matches) - 1; j >= 0; j-- {
+		m := matches[j]
+		result := search.Expand(nil, replace, text, m)
+		deltas = append(deltas, Delta{result, locs[2*j], locs[2*j+1]})
+		netrunes += utf8.RuneCount(result) - utf8.RuneCount(text[m[0]:m[1]])
+	}
+	b.MultipleReplace(deltas)
+	return len(matches), netrunes
+}
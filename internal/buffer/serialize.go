@@ -1,9 +1,13 @@
 package buffer
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
 	"encoding/gob"
 	"errors"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"time"
@@ -16,10 +20,37 @@ import (
 
 // The SerializedBuffer holds the types that get serialized when a buffer is saved
 // These are used for the savecursor and saveundo options
+// New fields must only ever be appended: gob ignores fields it does not
+// know about and leaves missing fields at their zero value, which keeps
+// files written by older and newer versions readable
 type SerializedBuffer struct {
 	EventHandler *EventHandler
 	Cursor       Loc
 	ModTime      time.Time
+	TopLine      int
+	// Cursors holds every cursor, Cursor is the active one
+	Cursors []Loc
+	// HighlightStates holds the highlight states of every line encoded with
+	// highlight.Def.EncodeStates, computed with the syntax files whose hash
+	// is SyntaxHash
+	HighlightStates []int
+	SyntaxHash      [md5.Size]byte
+}
+
+// serializeMagic starts every file written by Serialize, followed by
+// serializeVersion, so that files written by other versions of micro can
+// be told apart before decoding them
+// Files written before the header existed start directly with the gob
+// stream and are still read
+var serializeMagic = []byte("micro\x00buf")
+
+// serializeVersion must be increased whenever SerializedBuffer changes in a
+// way that older versions cannot read, such as a field changing type
+const serializeVersion byte = 1
+
+// serializedPath returns the file that the buffer state is saved to
+func (b *Buffer) serializedPath() string {
+	return filepath.Join(config.ConfigDir, "buffers", util.EscapePath(b.AbsPath))
 }
 
 // Serialize serializes the buffer to config.ConfigDir/buffers
@@ -31,13 +62,26 @@ func (b *Buffer) Serialize() error {
 		return nil
 	}
 
-	name := filepath.Join(config.ConfigDir, "buffers", util.EscapePath(b.AbsPath))
-
-	return b.overwriteFile(name, encoding.Nop, func(file io.Writer) error {
+	return b.overwriteFile(b.serializedPath(), encoding.Nop, func(file io.Writer) error {
+		if _, err := file.Write(serializeMagic); err != nil {
+			return err
+		}
+		if _, err := file.Write([]byte{serializeVersion}); err != nil {
+			return err
+		}
+		cursors := make([]Loc, len(b.cursors))
+		for i, c := range b.cursors {
+			cursors[i] = c.Loc
+		}
+		states, _ := b.savedHighlightStates()
 		err := gob.NewEncoder(file).Encode(SerializedBuffer{
 			b.EventHandler,
 			b.GetActiveCursor().Loc,
 			b.ModTime,
+			b.topLine,
+			cursors,
+			states,
+			b.syntaxHash,
 		})
 		return err
 	}, false)
@@ -45,32 +89,135 @@ func (b *Buffer) Serialize() error {
 
 // Unserialize loads the buffer info from config.ConfigDir/buffers
 func (b *Buffer) Unserialize() error {
-	// If either savecursor or saveundo is turned on, we need to load the serialized information
-	// from ~/.config/micro/buffers
+	buffer, err := b.readSerialized()
+	if buffer != nil {
+		b.applySerialized(buffer)
+	}
+	return err
+}
+
+// readSerialized reads the buffer info saved by Serialize, it returns nil
+// if there is none
+func (b *Buffer) readSerialized() (*SerializedBuffer, error) {
 	if b.Path == "" {
-		return nil
+		return nil, nil
+	}
+	name := b.serializedPath()
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, nil
 	}
-	file, err := os.Open(filepath.Join(config.ConfigDir, "buffers", util.EscapePath(b.AbsPath)))
 	defer file.Close()
-	if err == nil {
-		var buffer SerializedBuffer
-		decoder := gob.NewDecoder(file)
-		err = decoder.Decode(&buffer)
-		if err != nil {
-			return errors.New(err.Error() + "\nYou may want to remove the files in ~/.config/micro/buffers (these files\nstore the information for the 'saveundo' and 'savecursor' options) if\nthis problem persists.\nThis may be caused by upgrading to version 2.0, and removing the 'buffers'\ndirectory will reset the cursor and undo history and solve the problem.")
+
+	r := bufio.NewReader(file)
+	if head, err := r.Peek(len(serializeMagic)); err == nil && bytes.Equal(head, serializeMagic) {
+		r.Discard(len(serializeMagic))
+		// state saved by another version of micro is ignored, and
+		// replaced the next time the buffer is saved
+		if v, err := r.ReadByte(); err != nil || v != serializeVersion {
+			return nil, nil
+		}
+	}
+
+	var buffer SerializedBuffer
+	err = gob.NewDecoder(r).Decode(&buffer)
+	if err != nil {
+		// the file is removed so that it is only reported once
+		file.Close()
+		os.Remove(name)
+		return nil, errors.New(err.Error() + "\nThe saved cursor and undo history of " + b.GetName() + " could not be read and\nhave been removed. Run 'clearstate all' if other files have the same problem.")
+	}
+	return &buffer, nil
+}
+
+// applySerialized restores the cursors and undo history read by
+// readSerialized, as far as the savecursor and saveundo options allow
+func (b *Buffer) applySerialized(buffer *SerializedBuffer) {
+	if b.Settings["savecursor"].(bool) {
+		b.StartCursor = buffer.Cursor
+		b.topLine = buffer.TopLine
+		b.savedCursors = buffer.Cursors
+	}
+
+	if b.Settings["saveundo"].(bool) {
+		// We should only use last time's eventhandler if the file wasn't modified by someone else in the meantime
+		if b.ModTime == buffer.ModTime {
+			b.EventHandler = buffer.EventHandler
+			b.EventHandler.cursors = b.cursors
+			b.EventHandler.buf = b.SharedBuffer
+		}
+	}
+}
+
+// ClearSerialized removes the saved cursor and undo history of the buffer
+// It returns false if there was nothing to remove
+func (b *Buffer) ClearSerialized() (bool, error) {
+	if b.Path == "" {
+		return false, nil
+	}
+	err := os.Remove(b.serializedPath())
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ClearAllSerialized removes the saved cursor and undo history of every
+// file and returns how many files had some
+func ClearAllSerialized() (int, error) {
+	dir := filepath.Join(config.ConfigDir, "buffers")
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	n := 0
+	for _, f := range files {
+		if f.IsDir() {
+			continue
 		}
-		if b.Settings["savecursor"].(bool) {
-			b.StartCursor = buffer.Cursor
+		if err := os.Remove(filepath.Join(dir, f.Name())); err != nil {
+			return n, err
 		}
+		n++
+	}
+	return n, nil
+}
 
-		if b.Settings["saveundo"].(bool) {
-			// We should only use last time's eventhandler if the file wasn't modified by someone else in the meantime
-			if b.ModTime == buffer.ModTime {
-				b.EventHandler = buffer.EventHandler
-				b.EventHandler.cursors = b.cursors
-				b.EventHandler.buf = b.SharedBuffer
-			}
+// restoreCursors adds the cursors other than the active one that were
+// restored by Unserialize
+// Cursors that end up at the same place, for example because the file got
+// shorter, are merged
+func (b *Buffer) restoreCursors() {
+	if len(b.savedCursors) < 2 {
+		b.savedCursors = nil
+		return
+	}
+	for _, loc := range b.savedCursors {
+		if loc == b.StartCursor {
+			continue
 		}
+		c := NewCursor(b, clamp(loc, b.LineArray))
+		c.Relocate()
+		c.StoreVisualX()
+		b.AddCursor(c)
 	}
-	return nil
+	b.savedCursors = nil
+	b.MergeCursors()
+	b.UpdateCursors()
+}
+
+// SavedTopLine returns the first line that was visible in the view
+// showing this buffer, as restored from the serialized buffer state
+// or last set with SetTopLine
+func (b *Buffer) SavedTopLine() int {
+	return b.topLine
+}
+
+// SetTopLine records the first line visible in the view showing this
+// buffer so that the scroll position can be restored later
+func (b *Buffer) SetTopLine(n int) {
+	b.topLine = n
 }
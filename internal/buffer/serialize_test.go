@@ -0,0 +1,166 @@
+package buffer
+
+import (
+	"encoding/gob"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/zyedidia/micro/internal/config"
+	"github.com/zyedidia/micro/internal/util"
+)
+
+func withTempConfigDir(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "micro-serialize")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := config.ConfigDir
+	config.ConfigDir = dir
+	os.Mkdir(filepath.Join(dir, "buffers"), os.ModePerm)
+	return func() {
+		config.ConfigDir = old
+		os.RemoveAll(dir)
+	}
+}
+
+func TestSerializeTopLine(t *testing.T) {
+	defer withTempConfigDir(t)()
+
+	path := filepath.Join(config.ConfigDir, "test.txt")
+	b := NewBufferFromString("a\nb\nc\nd", path, BTDefault)
+	b.Settings["savecursor"] = true
+	b.GetActiveCursor().Loc = Loc{1, 3}
+	b.SetTopLine(2)
+	assert.Nil(t, b.Serialize())
+	b.Close()
+
+	b = NewBufferFromString("a\nb\nc\nd", path, BTDefault)
+	b.Settings["savecursor"] = true
+	assert.Equal(t, 0, b.SavedTopLine())
+	assert.Nil(t, b.Unserialize())
+	assert.Equal(t, 2, b.SavedTopLine())
+	assert.Equal(t, Loc{1, 3}, b.StartCursor)
+	b.Close()
+}
+
+func TestUnserializeWithoutTopLine(t *testing.T) {
+	defer withTempConfigDir(t)()
+
+	path := filepath.Join(config.ConfigDir, "test.txt")
+	b := NewBufferFromString("a\nb\nc\nd", path, BTDefault)
+	b.Settings["savecursor"] = true
+
+	// the state as written before the top line was serialized
+	old := struct {
+		EventHandler *EventHandler
+		Cursor       Loc
+		ModTime      time.Time
+	}{b.EventHandler, Loc{0, 2}, b.ModTime}
+
+	f, err := os.Create(filepath.Join(config.ConfigDir, "buffers", util.EscapePath(b.AbsPath)))
+	assert.Nil(t, err)
+	assert.Nil(t, gob.NewEncoder(f).Encode(old))
+	f.Close()
+
+	assert.Nil(t, b.Unserialize())
+	assert.Equal(t, 0, b.SavedTopLine())
+	assert.Equal(t, Loc{0, 2}, b.StartCursor)
+	assert.Nil(t, b.savedCursors)
+	b.Close()
+}
+
+func TestSerializeCursors(t *testing.T) {
+	defer withTempConfigDir(t)()
+
+	path := filepath.Join(config.ConfigDir, "test.txt")
+	b := NewBufferFromString("a\nb\nc\nd", path, BTDefault)
+	b.Settings["savecursor"] = true
+	b.GetActiveCursor().Loc = Loc{1, 1}
+	b.AddCursor(NewCursor(b, Loc{0, 2}))
+	b.AddCursor(NewCursor(b, Loc{1, 3}))
+	assert.Nil(t, b.Serialize())
+	b.Close()
+
+	// the file got shorter in the meantime
+	b = NewBufferFromString("a\nb\nc", path, BTDefault)
+	b.Settings["savecursor"] = true
+	assert.Nil(t, b.Unserialize())
+	assert.Equal(t, Loc{1, 1}, b.StartCursor)
+	b.GetActiveCursor().GotoLoc(b.StartCursor)
+	b.restoreCursors()
+
+	var locs []Loc
+	for _, c := range b.GetCursors() {
+		locs = append(locs, c.Loc)
+	}
+	assert.Equal(t, []Loc{{1, 1}, {0, 2}, {1, 2}}, locs)
+	assert.Equal(t, Loc{1, 1}, b.GetActiveCursor().Loc)
+	b.Close()
+}
+
+func TestUnserializeOtherVersion(t *testing.T) {
+	defer withTempConfigDir(t)()
+
+	path := filepath.Join(config.ConfigDir, "test.txt")
+	b := NewBufferFromString("a\nb\nc\nd", path, BTDefault)
+	b.Settings["savecursor"] = true
+	b.GetActiveCursor().Loc = Loc{1, 3}
+	assert.Nil(t, b.Serialize())
+
+	data, err := ioutil.ReadFile(b.serializedPath())
+	assert.Nil(t, err)
+	assert.Equal(t, serializeMagic, data[:len(serializeMagic)])
+	data[len(serializeMagic)] = serializeVersion + 1
+	ioutil.WriteFile(b.serializedPath(), data, 0644)
+
+	b.StartCursor = Loc{}
+	assert.Nil(t, b.Unserialize())
+	assert.Equal(t, Loc{}, b.StartCursor)
+	b.Close()
+}
+
+func TestUnserializeCorrupt(t *testing.T) {
+	defer withTempConfigDir(t)()
+
+	path := filepath.Join(config.ConfigDir, "test.txt")
+	b := NewBufferFromString("a\nb\nc\nd", path, BTDefault)
+	b.Settings["savecursor"] = true
+	ioutil.WriteFile(b.serializedPath(), []byte("not a gob stream"), 0644)
+
+	// the error is only reported once
+	assert.NotNil(t, b.Unserialize())
+	assert.Nil(t, b.Unserialize())
+	_, err := os.Stat(b.serializedPath())
+	assert.True(t, os.IsNotExist(err))
+	b.Close()
+}
+
+func TestClearSerialized(t *testing.T) {
+	defer withTempConfigDir(t)()
+
+	a := NewBufferFromString("a", filepath.Join(config.ConfigDir, "a.txt"), BTDefault)
+	a.Settings["savecursor"] = true
+	b := NewBufferFromString("b", filepath.Join(config.ConfigDir, "b.txt"), BTDefault)
+	b.Settings["savecursor"] = true
+	assert.Nil(t, a.Serialize())
+	assert.Nil(t, b.Serialize())
+
+	removed, err := a.ClearSerialized()
+	assert.Nil(t, err)
+	assert.True(t, removed)
+	removed, err = a.ClearSerialized()
+	assert.Nil(t, err)
+	assert.False(t, removed)
+
+	assert.Nil(t, a.Serialize())
+	n, err := ClearAllSerialized()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	_, err = os.Stat(b.serializedPath())
+	assert.True(t, os.IsNotExist(err))
+}
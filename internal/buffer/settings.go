@@ -7,10 +7,14 @@ import (
 
 func (b *Buffer) SetOptionNative(option string, nativeValue interface{}) error {
 	b.Settings[option] = nativeValue
+	if b.setOptions == nil {
+		b.setOptions = make(map[string]bool)
+	}
+	b.setOptions[option] = true
 
 	if option == "fastdirty" {
 		if !nativeValue.(bool) {
-			e := calcHash(b, &b.origHash)
+			e := b.updateOrigHash()
 			if e == ErrFileTooLarge {
 				b.Settings["fastdirty"] = false
 			}
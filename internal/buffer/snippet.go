@@ -0,0 +1,52 @@
+package buffer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// snippetExtensions maps filetypes to file extensions where the two differ
+var snippetExtensions = map[string]string{
+	"c++":        "cpp",
+	"csharp":     "cs",
+	"haskell":    "hs",
+	"javascript": "js",
+	"kotlin":     "kt",
+	"markdown":   "md",
+	"perl":       "pl",
+	"python":     "py",
+	"python2":    "py",
+	"ruby":       "rb",
+	"rust":       "rs",
+	"shell":      "sh",
+	"typescript": "ts",
+	"unknown":    "txt",
+	"off":        "txt",
+	"":           "txt",
+}
+
+// SnippetFilename returns the name of a snippet file for this buffer
+// created at the given time, with an extension matching the filetype
+func (b *Buffer) SnippetFilename(t time.Time) string {
+	ft := b.FileType()
+	ext, ok := snippetExtensions[ft]
+	if !ok {
+		ext = ft
+	}
+	return "snippet-" + t.Format("20060102-150405") + "." + ext
+}
+
+// ExportSnippet writes the given text to a new snippet file in dir,
+// creating the directory if needed, and returns the path of the file
+func (b *Buffer) ExportSnippet(dir string, text []byte, t time.Time) (string, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, b.SnippetFilename(t))
+	if err := ioutil.WriteFile(path, text, 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
@@ -0,0 +1,47 @@
+package buffer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnippetFilename(t *testing.T) {
+	b := NewBufferFromString("", "", BTDefault)
+	tm := time.Date(2020, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	b.Settings["filetype"] = "go"
+	assert.Equal(t, "snippet-20200304-050607.go", b.SnippetFilename(tm))
+	b.Settings["filetype"] = "python"
+	assert.Equal(t, "snippet-20200304-050607.py", b.SnippetFilename(tm))
+	b.Settings["filetype"] = "unknown"
+	assert.Equal(t, "snippet-20200304-050607.txt", b.SnippetFilename(tm))
+
+	b.Close()
+}
+
+func TestExportSnippet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "micro-snippet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	b := NewBufferFromString("", "", BTDefault)
+	b.Settings["filetype"] = "go"
+	tm := time.Date(2020, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	path, err := b.ExportSnippet(filepath.Join(dir, "snippets"), []byte("func f() {}\n"), tm)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "snippets", "snippet-20200304-050607.go"), path)
+
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "func f() {}\n", string(data))
+
+	b.Close()
+}
@@ -0,0 +1,94 @@
+package buffer
+
+import (
+	"bytes"
+	"regexp"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+)
+
+var leadingNumberRegex = regexp.MustCompile(`^\s*[-+]?(\d+(\.\d*)?|\.\d+)`)
+
+// leadingNumber returns the number at the start of a line, ignoring
+// leading whitespace, or 0 if the line does not start with a number
+func leadingNumber(line []byte) float64 {
+	m := leadingNumberRegex.Find(line)
+	if m == nil {
+		return 0
+	}
+	n, err := strconv.ParseFloat(string(bytes.TrimSpace(m)), 64)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// SortLines sorts the lines from start to end (inclusive) as a single
+// undoable edit
+// With numeric the lines are compared by the number they start with
+// (lines without one count as 0), and with unique only the first of
+// several equal lines is kept
+// It returns the number of lines in the sorted block
+func (b *Buffer) SortLines(start, end int, reverse, numeric, unique bool) int {
+	if start > end {
+		start, end = end, start
+	}
+
+	lines := make([][]byte, 0, end-start+1)
+	for i := start; i <= end; i++ {
+		lines = append(lines, b.LineBytes(i))
+	}
+
+	sl := sortedLines{lines: lines}
+	if numeric {
+		sl.nums = make([]float64, len(lines))
+		for i, l := range lines {
+			sl.nums[i] = leadingNumber(l)
+		}
+	}
+	if reverse {
+		sort.Stable(sort.Reverse(sl))
+	} else {
+		sort.Stable(sl)
+	}
+
+	if unique {
+		seen := make(map[string]bool)
+		kept := lines[:0]
+		for _, l := range lines {
+			if !seen[string(l)] {
+				seen[string(l)] = true
+				kept = append(kept, l)
+			}
+		}
+		lines = kept
+	}
+
+	endLoc := Loc{utf8.RuneCount(b.LineBytes(end)), end}
+	b.ReplaceRange(Loc{0, start}, endLoc, string(bytes.Join(lines, []byte{'\n'})))
+	return len(lines)
+}
+
+// sortedLines sorts lines either by their text or, if nums is set, by
+// the numbers they start with
+type sortedLines struct {
+	lines [][]byte
+	nums  []float64
+}
+
+func (s sortedLines) Len() int { return len(s.lines) }
+
+func (s sortedLines) Less(i, j int) bool {
+	if s.nums != nil {
+		return s.nums[i] < s.nums[j]
+	}
+	return bytes.Compare(s.lines[i], s.lines[j]) < 0
+}
+
+func (s sortedLines) Swap(i, j int) {
+	s.lines[i], s.lines[j] = s.lines[j], s.lines[i]
+	if s.nums != nil {
+		s.nums[i], s.nums[j] = s.nums[j], s.nums[i]
+	}
+}
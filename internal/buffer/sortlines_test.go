@@ -0,0 +1,35 @@
+package buffer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSortLines(t *testing.T) {
+	b := NewBufferFromString("header\ncherry\napple\nbanana\napple\nfooter", "", BTDefault)
+
+	assert.Equal(t, 4, b.SortLines(1, 4, false, false, false))
+	assert.Equal(t, "header\napple\napple\nbanana\ncherry\nfooter", string(b.Bytes()))
+
+	assert.Equal(t, 3, b.SortLines(4, 1, true, false, true))
+	assert.Equal(t, "header\ncherry\nbanana\napple\nfooter", string(b.Bytes()))
+
+	// the whole sort is undone at once
+	b.UndoOneEvent()
+	assert.Equal(t, "header\napple\napple\nbanana\ncherry\nfooter", string(b.Bytes()))
+
+	b.Close()
+}
+
+func TestSortLinesNumeric(t *testing.T) {
+	b := NewBufferFromString("10 ten\n9 nine\n-1.5 neg\nnone\n 100 hundred", "", BTDefault)
+
+	b.SortLines(0, b.LinesNum()-1, false, true, false)
+	assert.Equal(t, "-1.5 neg\nnone\n9 nine\n10 ten\n 100 hundred", string(b.Bytes()))
+
+	b.SortLines(0, b.LinesNum()-1, true, true, false)
+	assert.Equal(t, " 100 hundred\n10 ten\n9 nine\nnone\n-1.5 neg", string(b.Bytes()))
+
+	b.Close()
+}
@@ -0,0 +1,89 @@
+package buffer
+
+import (
+	"github.com/zyedidia/micro/internal/util"
+	"github.com/zyedidia/micro/pkg/highlight"
+)
+
+// stateCheckLines is the number of lines, spread over the buffer, whose
+// states RestoreHighlightStates computes again to check them
+const stateCheckLines = 64
+
+// DumpHighlightStates returns a copy of the highlight state at the end of
+// each line, to debug the highlighter or to restore them later with
+// RestoreHighlightStates
+func (b *Buffer) DumpHighlightStates() []highlight.State {
+	states := make([]highlight.State, b.LinesNum())
+	for i := range states {
+		states[i] = b.State(i)
+	}
+	return states
+}
+
+// RestoreHighlightStates sets the highlight states of all lines from an
+// earlier DumpHighlightStates, which saves the pass over the whole buffer
+// that computes them when the text has not changed
+// The states are only trusted if there is one per line, if they belong to
+// the buffer's syntax definition, and if computing the states of a sample
+// of lines again gives the same result
+// The matches are left to the caller, because highlighting a large buffer
+// should not block
+// It returns whether the states were restored
+func (b *Buffer) RestoreHighlightStates(states []highlight.State) bool {
+	if b.SyntaxDef == nil || b.Highlighter == nil || len(states) != b.LinesNum() {
+		return false
+	}
+	if _, ok := b.SyntaxDef.EncodeStates(states); !ok {
+		return false
+	}
+
+	h := highlight.NewHighlighter(b.SyntaxDef)
+	check := func(i int) bool {
+		var start highlight.State
+		if i > 0 {
+			start = states[i-1]
+		}
+		return h.EndState(b.LineBytes(i), i, start) == states[i]
+	}
+	step := util.Max(1, len(states)/stateCheckLines)
+	for i := 0; i < len(states); i += step {
+		if !check(i) {
+			return false
+		}
+	}
+	if !check(len(states) - 1) {
+		return false
+	}
+
+	for i, s := range states {
+		b.SetState(i, s)
+	}
+	return true
+}
+
+// savedHighlightStates returns the highlight states to save with the
+// serialized buffer state, encoded with highlight.Def.EncodeStates
+// The states are only saved when they belong to the text of the file on
+// disk
+func (b *Buffer) savedHighlightStates() ([]int, bool) {
+	if !b.Settings["syntax"].(bool) || b.SyntaxDef == nil || b.Highlighter == nil || b.Modified() {
+		return nil, false
+	}
+	return b.SyntaxDef.EncodeStates(b.DumpHighlightStates())
+}
+
+// restoreSerializedStates sets the highlight states saved with the
+// serialized buffer state that is being read, if neither the file nor the
+// syntax files it was highlighted with have changed since
+// It returns whether the states were restored
+func (b *Buffer) restoreSerializedStates() bool {
+	saved := b.serialized
+	if saved == nil || saved.HighlightStates == nil || b.isModified {
+		return false
+	}
+	if !saved.ModTime.Equal(b.ModTime) || saved.SyntaxHash != b.syntaxHash {
+		return false
+	}
+	states, ok := b.SyntaxDef.DecodeStates(saved.HighlightStates)
+	return ok && b.RestoreHighlightStates(states)
+}
@@ -0,0 +1,104 @@
+package buffer
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zyedidia/micro/internal/config"
+	"github.com/zyedidia/micro/pkg/highlight"
+)
+
+const statesFixture = `a := "string"
+/* a comment
+that spans
+several lines */
+b := 1 // line comment
+"unterminated
+`
+
+func TestRestoreHighlightStates(t *testing.T) {
+	b := NewBufferFromString(statesFixture, "", BTDefault)
+	highlightStringsAndComments(t, b)
+	b.Highlighter.HighlightMatches(b, 0, b.LinesNum())
+
+	states := b.DumpHighlightStates()
+	var matches []highlight.LineMatch
+	for i := 0; i < b.LinesNum(); i++ {
+		matches = append(matches, b.Match(i))
+	}
+	assert.NotNil(t, states[1])
+	assert.Nil(t, states[4])
+
+	// round trip through the saved form
+	codes, ok := b.SyntaxDef.EncodeStates(states)
+	assert.True(t, ok)
+	decoded, ok := b.SyntaxDef.DecodeStates(codes)
+	assert.True(t, ok)
+	assert.Equal(t, states, decoded)
+
+	b.ClearMatches()
+	assert.True(t, b.RestoreHighlightStates(decoded))
+	// the matches are found afterwards, which UpdateRules does in the
+	// background
+	assert.Nil(t, b.Match(1))
+	b.Highlighter.HighlightMatches(b, 0, b.LinesNum())
+	for i := 0; i < b.LinesNum(); i++ {
+		assert.Equal(t, states[i], b.State(i))
+		assert.Equal(t, matches[i], b.Match(i))
+	}
+
+	// states that do not fit the text are refused
+	wrong := append([]highlight.State(nil), states...)
+	wrong[2] = nil
+	assert.False(t, b.RestoreHighlightStates(wrong))
+	assert.False(t, b.RestoreHighlightStates(states[1:]))
+	_, ok = b.SyntaxDef.DecodeStates([]int{1000})
+	assert.False(t, ok)
+
+	b.Close()
+}
+
+func TestSerializeHighlightStates(t *testing.T) {
+	defer withTempConfigDir(t)()
+
+	path := filepath.Join(config.ConfigDir, "test.txt")
+	assert.Nil(t, ioutil.WriteFile(path, []byte(statesFixture), 0644))
+	b := NewBufferFromString(statesFixture, path, BTDefault)
+	b.Settings["savecursor"] = true
+	b.Settings["backup"] = false
+	highlightStringsAndComments(t, b)
+	states := b.DumpHighlightStates()
+	assert.Nil(t, b.Serialize())
+
+	saved, err := b.readSerialized()
+	assert.Nil(t, err)
+	assert.NotNil(t, saved.HighlightStates)
+
+	// the saved states are used while the file and the syntax files are
+	// the same as when they were saved
+	for i := 0; i < b.LinesNum(); i++ {
+		b.SetState(i, nil)
+	}
+	b.serialized = saved
+	assert.True(t, b.restoreSerializedStates())
+	assert.Equal(t, states, b.DumpHighlightStates())
+
+	saved.SyntaxHash[0] ^= 1
+	assert.False(t, b.restoreSerializedStates())
+	saved.SyntaxHash[0] ^= 1
+	saved.ModTime = saved.ModTime.Add(time.Second)
+	assert.False(t, b.restoreSerializedStates())
+	b.serialized = nil
+
+	// the states of unsaved changes are not saved
+	b.Insert(Loc{0, 0}, "x")
+	assert.Nil(t, b.Serialize())
+	saved, err = b.readSerialized()
+	assert.Nil(t, err)
+	assert.Nil(t, saved.HighlightStates)
+
+	b.Close()
+}
@@ -0,0 +1,241 @@
+package buffer
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// surroundPairs maps each delimiter to the pair it belongs to, so that
+// either half of a pair can be given to SurroundPair
+var surroundPairs = map[rune][2]rune{
+	'(': {'(', ')'},
+	')': {'(', ')'},
+	'[': {'[', ']'},
+	']': {'[', ']'},
+	'{': {'{', '}'},
+	'}': {'{', '}'},
+	'<': {'<', '>'},
+	'>': {'<', '>'},
+}
+
+var surroundQuotes = []rune{'"', '\'', '`'}
+
+var openTagRegex = regexp.MustCompile(`^<([A-Za-z][\w:.-]*)[^<>]*>$`)
+
+// SurroundPair returns the opening and closing delimiters described by
+// the given string
+// It accepts a single delimiter such as ( or ", both halves of a pair
+// such as () or an opening tag such as <div class="a">, in which case
+// the closing delimiter is the matching end tag
+func SurroundPair(pair string) (string, string, error) {
+	if m := openTagRegex.FindStringSubmatch(pair); m != nil {
+		return pair, "</" + m[1] + ">", nil
+	}
+
+	runes := []rune(pair)
+	switch len(runes) {
+	case 1:
+		if p, ok := surroundPairs[runes[0]]; ok {
+			return string(p[0]), string(p[1]), nil
+		}
+		return pair, pair, nil
+	case 2:
+		return string(runes[0]), string(runes[1]), nil
+	}
+	return "", "", errors.New("Invalid delimiter pair: " + pair)
+}
+
+// Surround wraps the cursor's selection with the given delimiters as a
+// single undoable edit
+// The selection is kept on the original text so that it can be
+// surrounded again or unsurrounded
+func (b *Buffer) Surround(c *Cursor, open, close string) {
+	if !c.HasSelection() || b.Type.Readonly {
+		return
+	}
+
+	start, end := c.CurSelection[0], c.CurSelection[1]
+	if end.LessThan(start) {
+		start, end = end, start
+	}
+
+	// the closing delimiter is inserted first so that start stays valid
+	b.MultipleReplace([]Delta{
+		{[]byte(close), end, end},
+		{[]byte(open), start, start},
+	})
+
+	n := utf8.RuneCountInString(open)
+	start.X += n
+	if end.Y == start.Y {
+		end.X += n
+	}
+	c.SetSelectionStart(start)
+	c.SetSelectionEnd(end)
+	c.Loc = end
+	c.StoreVisualX()
+}
+
+// Unsurround removes the pair of delimiters immediately surrounding the
+// cursor's selection as a single undoable edit
+// Without a selection the innermost bracket or quote pair around the
+// cursor is removed
+// It returns false if no surrounding pair was found
+func (b *Buffer) Unsurround(c *Cursor) bool {
+	if b.Type.Readonly {
+		return false
+	}
+
+	var open, close [2]Loc
+	var found bool
+	if c.HasSelection() {
+		start, end := c.CurSelection[0], c.CurSelection[1]
+		if end.LessThan(start) {
+			start, end = end, start
+		}
+		open, close, found = b.delimitersAround(start, end)
+	} else {
+		open, close, found = b.enclosingPair(c.Loc)
+	}
+	if !found {
+		return false
+	}
+
+	b.MultipleReplace([]Delta{
+		{[]byte{}, close[0], close[1]},
+		{[]byte{}, open[0], open[1]},
+	})
+
+	n := open[1].X - open[0].X
+	start, end := open[0], close[0]
+	if end.Y == start.Y {
+		end.X -= n
+	}
+	if c.HasSelection() {
+		c.SetSelectionStart(start)
+		c.SetSelectionEnd(end)
+		c.Loc = end
+	} else if c.Y == open[0].Y && c.X >= open[1].X {
+		// keep the cursor on the same character
+		c.X -= n
+	}
+	c.Relocate()
+	c.StoreVisualX()
+	return true
+}
+
+// delimitersAround returns the ranges of a delimiter pair that lies
+// directly outside of the given range
+func (b *Buffer) delimitersAround(start, end Loc) ([2]Loc, [2]Loc, bool) {
+	before := []rune(string(b.LineBytes(start.Y)))[:start.X]
+	after := []rune(string(b.LineBytes(end.Y)))[end.X:]
+
+	// a closing tag directly after the range and its opening tag directly
+	// before it
+	if len(after) > 0 && after[0] == '<' {
+		rest := string(after)
+		if i := strings.IndexRune(rest, '>'); i > 2 && strings.HasPrefix(rest, "</") {
+			name := rest[2:i]
+			j := strings.LastIndex(string(before), "<"+name)
+			if j >= 0 && strings.HasSuffix(string(before), ">") {
+				tag := string(before)[j:]
+				if m := openTagRegex.FindStringSubmatch(tag); m != nil && m[1] == name {
+					n := utf8.RuneCountInString(tag)
+					closeLen := utf8.RuneCountInString(rest[:i+1])
+					return [2]Loc{{start.X - n, start.Y}, start},
+						[2]Loc{end, {end.X + closeLen, end.Y}}, true
+				}
+			}
+		}
+	}
+
+	if len(before) == 0 || len(after) == 0 {
+		return [2]Loc{}, [2]Loc{}, false
+	}
+	o, cl := before[len(before)-1], after[0]
+	if p, ok := surroundPairs[o]; (ok && p[0] == o && p[1] == cl) || (!ok && o == cl && isSurroundQuote(o)) {
+		return [2]Loc{{start.X - 1, start.Y}, start},
+			[2]Loc{end, {end.X + 1, end.Y}}, true
+	}
+	return [2]Loc{}, [2]Loc{}, false
+}
+
+func isSurroundQuote(r rune) bool {
+	for _, q := range surroundQuotes {
+		if q == r {
+			return true
+		}
+	}
+	return false
+}
+
+// enclosingPair returns the ranges of the innermost bracket or quote pair
+// that encloses the given location
+// Quotes are only matched within a single line
+func (b *Buffer) enclosingPair(loc Loc) ([2]Loc, [2]Loc, bool) {
+	var open, close Loc
+	found := false
+
+	// brackets, possibly spanning several lines
+	depth := make(map[rune]int)
+	for y := loc.Y; y >= 0 && !found; y-- {
+		line := []rune(string(b.LineBytes(y)))
+		x := len(line) - 1
+		if y == loc.Y {
+			x = loc.X - 1
+			if x >= len(line) {
+				x = len(line) - 1
+			}
+		}
+		for ; x >= 0; x-- {
+			r := line[x]
+			p, ok := surroundPairs[r]
+			if !ok || p[0] == '<' {
+				continue
+			}
+			if r == p[1] {
+				depth[p[0]]++
+			} else if depth[r] > 0 {
+				depth[r]--
+			} else if m, _, ok := b.FindMatchingBrace(p, Loc{x, y}); ok && !m.LessThan(loc) {
+				open, close = Loc{x, y}, m
+				found = true
+				break
+			}
+		}
+	}
+
+	// quotes on the cursor's line, which win if they are further inside
+	line := []rune(string(b.LineBytes(loc.Y)))
+	for _, q := range surroundQuotes {
+		last := -1
+		for x := 0; x < len(line) && x < loc.X; x++ {
+			if line[x] == q {
+				if last >= 0 {
+					last = -1
+				} else {
+					last = x
+				}
+			}
+		}
+		if last < 0 {
+			continue
+		}
+		for x := loc.X; x < len(line); x++ {
+			if line[x] == q {
+				if !found || open.LessThan(Loc{last, loc.Y}) {
+					open, close = Loc{last, loc.Y}, Loc{x, loc.Y}
+					found = true
+				}
+				break
+			}
+		}
+	}
+
+	if !found {
+		return [2]Loc{}, [2]Loc{}, false
+	}
+	return [2]Loc{open, {open.X + 1, open.Y}}, [2]Loc{close, {close.X + 1, close.Y}}, true
+}
@@ -0,0 +1,97 @@
+package buffer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSurroundPair(t *testing.T) {
+	tests := []struct {
+		pair  string
+		open  string
+		close string
+	}{
+		{"(", "(", ")"},
+		{")", "(", ")"},
+		{"()", "(", ")"},
+		{"\"", "\"", "\""},
+		{"**", "*", "*"},
+		{"<b>", "<b>", "</b>"},
+		{`<div class="a">`, `<div class="a">`, "</div>"},
+	}
+
+	for _, test := range tests {
+		open, close, err := SurroundPair(test.pair)
+		assert.NoError(t, err, test.pair)
+		assert.Equal(t, test.open, open, test.pair)
+		assert.Equal(t, test.close, close, test.pair)
+	}
+
+	_, _, err := SurroundPair("abc")
+	assert.Error(t, err)
+}
+
+func TestSurroundWord(t *testing.T) {
+	b := NewBufferFromString("say hello world", "", BTDefault)
+	c := b.GetActiveCursor()
+	c.SetSelectionStart(Loc{4, 0})
+	c.SetSelectionEnd(Loc{9, 0})
+
+	b.Surround(c, "(", ")")
+	assert.Equal(t, "say (hello) world", string(b.Bytes()))
+	assert.Equal(t, "hello", string(c.GetSelection()))
+
+	b.Surround(c, "<b>", "</b>")
+	assert.Equal(t, "say (<b>hello</b>) world", string(b.Bytes()))
+
+	// the whole edit is undone at once
+	b.UndoOneEvent()
+	assert.Equal(t, "say (hello) world", string(b.Bytes()))
+
+	b.Close()
+}
+
+func TestSurroundMultiLine(t *testing.T) {
+	b := NewBufferFromString("a\nfoo\nbar\nb", "", BTDefault)
+	c := b.GetActiveCursor()
+	c.SetSelectionStart(Loc{0, 1})
+	c.SetSelectionEnd(Loc{3, 2})
+
+	b.Surround(c, "<p>", "</p>")
+	assert.Equal(t, "a\n<p>foo\nbar</p>\nb", string(b.Bytes()))
+	assert.Equal(t, "foo\nbar", string(c.GetSelection()))
+
+	assert.True(t, b.Unsurround(c))
+	assert.Equal(t, "a\nfoo\nbar\nb", string(b.Bytes()))
+	assert.Equal(t, "foo\nbar", string(c.GetSelection()))
+
+	b.Close()
+}
+
+func TestUnsurround(t *testing.T) {
+	b := NewBufferFromString(`f(a, "b c", [d])`, "", BTDefault)
+	c := b.GetActiveCursor()
+
+	// innermost pair around the cursor
+	c.Loc = Loc{7, 0}
+	assert.True(t, b.Unsurround(c))
+	assert.Equal(t, `f(a, b c, [d])`, string(b.Bytes()))
+	assert.Equal(t, Loc{6, 0}, c.Loc)
+
+	c.Loc = Loc{4, 0}
+	assert.True(t, b.Unsurround(c))
+	assert.Equal(t, `fa, b c, [d]`, string(b.Bytes()))
+
+	// selection with a pair directly around it
+	c.SetSelectionStart(Loc{10, 0})
+	c.SetSelectionEnd(Loc{11, 0})
+	assert.True(t, b.Unsurround(c))
+	assert.Equal(t, `fa, b c, d`, string(b.Bytes()))
+
+	c.SetSelectionStart(Loc{0, 0})
+	c.SetSelectionEnd(Loc{2, 0})
+	assert.False(t, b.Unsurround(c))
+
+	b.Close()
+}
@@ -0,0 +1,85 @@
+package buffer
+
+import (
+	"crypto/md5"
+	"sync"
+
+	"github.com/zyedidia/micro/pkg/highlight"
+)
+
+// A parsedSyntax is a syntax file, or only the header of one, that has
+// already been parsed
+type parsedSyntax struct {
+	header *highlight.Header
+	file   *highlight.File
+}
+
+var (
+	syntaxCacheLock sync.Mutex
+	// syntaxCache maps the name and the hash of the data of a syntax file
+	// to its parsed form, so that opening a buffer does not parse every
+	// syntax file again
+	syntaxCache = make(map[string]parsedSyntax)
+)
+
+func syntaxCacheKey(kind, name string, data []byte) string {
+	hash := md5.Sum(data)
+	return kind + ":" + name + ":" + string(hash[:])
+}
+
+// parseSyntaxFile returns the header and the parsed contents of a yaml
+// syntax file
+func parseSyntaxFile(name string, data []byte) (*highlight.Header, *highlight.File, error) {
+	key := syntaxCacheKey("yaml", name, data)
+
+	syntaxCacheLock.Lock()
+	p, ok := syntaxCache[key]
+	syntaxCacheLock.Unlock()
+	if ok {
+		return p.header, p.file, nil
+	}
+
+	header, err := highlight.MakeHeaderYaml(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	file, err := highlight.ParseFile(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	syntaxCacheLock.Lock()
+	syntaxCache[key] = parsedSyntax{header, file}
+	syntaxCacheLock.Unlock()
+	return header, file, nil
+}
+
+// parseSyntaxHeader returns the header from a .hdr syntax header file
+func parseSyntaxHeader(name string, data []byte) (*highlight.Header, error) {
+	key := syntaxCacheKey("hdr", name, data)
+
+	syntaxCacheLock.Lock()
+	p, ok := syntaxCache[key]
+	syntaxCacheLock.Unlock()
+	if ok {
+		return p.header, nil
+	}
+
+	header, err := highlight.MakeHeader(data)
+	if err != nil {
+		return nil, err
+	}
+
+	syntaxCacheLock.Lock()
+	syntaxCache[key] = parsedSyntax{header: header}
+	syntaxCacheLock.Unlock()
+	return header, nil
+}
+
+// ClearSyntaxCache forgets all of the syntax files that have been parsed,
+// which should be done when the runtime files are reloaded
+func ClearSyntaxCache() {
+	syntaxCacheLock.Lock()
+	syntaxCache = make(map[string]parsedSyntax)
+	syntaxCacheLock.Unlock()
+}
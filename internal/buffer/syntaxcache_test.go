@@ -0,0 +1,37 @@
+package buffer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyntaxCache(t *testing.T) {
+	data := []byte("filetype: test\ndetect:\n    filename: \"\\\\.test$\"\nrules:\n    - comment: \"#.*$\"\n")
+
+	header, file, err := parseSyntaxFile("test", data)
+	assert.NoError(t, err)
+	assert.Equal(t, "test", header.FileType)
+	assert.Equal(t, "test", file.FileType)
+
+	// the same file is only parsed once
+	header2, file2, err := parseSyntaxFile("test", data)
+	assert.NoError(t, err)
+	assert.True(t, header == header2)
+	assert.True(t, file == file2)
+
+	// but changes to it are picked up
+	changed := append([]byte{}, data...)
+	changed = append(changed, "    - constant: \"x\"\n"...)
+	_, file2, err = parseSyntaxFile("test", changed)
+	assert.NoError(t, err)
+	assert.False(t, file == file2)
+
+	ClearSyntaxCache()
+	_, file2, err = parseSyntaxFile("test", data)
+	assert.NoError(t, err)
+	assert.False(t, file == file2)
+
+	_, _, err = parseSyntaxFile("bad", []byte("rules: ["))
+	assert.Error(t, err)
+}
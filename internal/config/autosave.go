@@ -5,9 +5,13 @@ import (
 	"time"
 )
 
+// Autosave receives a value every autosave seconds while autosaving is on
 var Autosave chan bool
 var autotime int
 
+// stops the running autosave ticker, nil if there is none
+var autostop chan struct{}
+
 // lock for autosave
 var autolock sync.Mutex
 
@@ -28,18 +32,47 @@ func GetAutoTime() int {
 	return a
 }
 
+// StartAutoSave starts sending on Autosave every autosave seconds, replacing
+// the ticker of an earlier call so that changing the option does not start
+// a second one
 func StartAutoSave() {
+	autolock.Lock()
+	defer autolock.Unlock()
+
+	stopAutoSave()
+	if autotime < 1 {
+		return
+	}
+	stop := make(chan struct{})
+	autostop = stop
+	ticker := time.NewTicker(time.Duration(autotime) * time.Second)
 	go func() {
+		defer ticker.Stop()
 		for {
-			if autotime < 1 {
-				break
+			select {
+			case <-ticker.C:
+				select {
+				case Autosave <- true:
+				case <-stop:
+					return
+				}
+			case <-stop:
+				return
 			}
-			time.Sleep(time.Duration(autotime) * time.Second)
-			// it's possible autotime was changed while sleeping
-			if autotime < 1 {
-				break
-			}
-			Autosave <- true
 		}
 	}()
 }
+
+// StopAutoSave stops the autosave ticker if it is running
+func StopAutoSave() {
+	autolock.Lock()
+	stopAutoSave()
+	autolock.Unlock()
+}
+
+func stopAutoSave() {
+	if autostop != nil {
+		close(autostop)
+		autostop = nil
+	}
+}
@@ -3,6 +3,8 @@ package config
 import (
 	"archive/zip"
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -54,6 +56,9 @@ type PluginVersion struct {
 	Version semver.Version
 	Url     string
 	Require PluginDependencies
+	// Sha256 is the hex encoded SHA-256 checksum of the archive at Url, if
+	// the repository gives one
+	Sha256 string
 }
 
 func (pv *PluginVersion) Pack() *PluginPackage {
@@ -172,6 +177,7 @@ func (pv *PluginVersion) UnmarshalJSON(data []byte) error {
 		Version semver.Version
 		Url     string
 		Require map[string]string
+		Sha256  string
 	}
 
 	if err := json5.Unmarshal(data, &values); err != nil {
@@ -179,6 +185,7 @@ func (pv *PluginVersion) UnmarshalJSON(data []byte) error {
 	}
 	pv.Version = values.Version
 	pv.Url = values.Url
+	pv.Sha256 = strings.ToLower(strings.TrimSpace(values.Sha256))
 	pv.Require = make(PluginDependencies, 0)
 
 	for k, v := range values.Require {
@@ -400,6 +407,11 @@ func (pv *PluginVersion) DownloadAndInstall(out io.Writer) error {
 	if err != nil {
 		return err
 	}
+	if pv.Sha256 == "" {
+		fmt.Fprintf(out, "Warning: %q does not give a checksum, the download cannot be verified\n", pv.pack.Name)
+	} else if err := pv.verifyChecksum(data); err != nil {
+		return err
+	}
 	zipbuf := bytes.NewReader(data)
 	z, err := zip.NewReader(zipbuf, zipbuf.Size())
 	if err != nil {
@@ -466,6 +478,16 @@ func (pv *PluginVersion) DownloadAndInstall(out io.Writer) error {
 	return nil
 }
 
+// verifyChecksum returns an error if data, the downloaded archive, does not
+// have the checksum given by the repository
+func (pv *PluginVersion) verifyChecksum(data []byte) error {
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != pv.Sha256 {
+		return fmt.Errorf("Checksum mismatch for %q (%s): the download from %q may have been tampered with, not installing it", pv.pack.Name, pv.Version, pv.Url)
+	}
+	return nil
+}
+
 func (pl PluginPackages) Get(name string) *PluginPackage {
 	for _, p := range pl {
 		if p.Name == name {
@@ -602,16 +624,22 @@ func (pl PluginPackage) Install(out io.Writer) {
 	selected.install(out)
 }
 
+// enabledPluginNames returns the names of all enabled plugins
+func enabledPluginNames() []string {
+	var names []string
+	for _, p := range Plugins {
+		if p.IsEnabled() {
+			names = append(names, p.Name)
+		}
+	}
+	return names
+}
+
 // UpdatePlugins updates the given plugins
 func UpdatePlugins(out io.Writer, plugins []string) {
 	// if no plugins are specified, update all installed plugins.
 	if len(plugins) == 0 {
-		for _, p := range Plugins {
-			if !p.IsEnabled() {
-				continue
-			}
-			plugins = append(plugins, p.Name)
-		}
+		plugins = enabledPluginNames()
 	}
 
 	fmt.Fprintln(out, "Checking for plugin updates")
@@ -639,6 +667,51 @@ func UpdatePlugins(out io.Writer, plugins []string) {
 	selected.install(out)
 }
 
+// latestVersion returns the newest version of the package, or nil if it
+// has none
+func (pp *PluginPackage) latestVersion() *PluginVersion {
+	var latest *PluginVersion
+	for _, v := range pp.Versions {
+		if latest == nil || v.Version.GT(latest.Version) {
+			latest = v
+		}
+	}
+	return latest
+}
+
+// previewUpdate describes what updating the plugin with the given
+// installed version to the newest version of pp would do
+// pp is nil if the plugin is not in any repository
+func previewUpdate(name, installed string, pp *PluginPackage) string {
+	var latest *PluginVersion
+	if pp != nil {
+		latest = pp.latestVersion()
+	}
+	if latest == nil {
+		return fmt.Sprintf("%s (%s): not found in the plugin repositories", name, installed)
+	}
+	current := newStaticPluginVersion(name, installed).Version
+	if latest.Version.Compare(current) == 1 {
+		return fmt.Sprintf("%s: %s -> %s", name, current, latest.Version)
+	}
+	return fmt.Sprintf("%s (%s): up to date", name, current)
+}
+
+// PreviewPluginUpdates lists the installed and newest available version
+// of the given plugins, or of all enabled plugins, without installing
+// anything
+func PreviewPluginUpdates(out io.Writer, plugins []string) {
+	if len(plugins) == 0 {
+		plugins = enabledPluginNames()
+	}
+
+	fmt.Fprintln(out, "Checking for plugin updates (dry run, nothing will be installed)")
+	all := GetAllPluginPackages(out)
+	for _, name := range plugins {
+		fmt.Fprintln(out, previewUpdate(name, GetInstalledPluginVersion(name), all.Get(name)))
+	}
+}
+
 func PluginCommand(out io.Writer, cmd string, args []string) {
 	switch cmd {
 	case "install":
@@ -685,7 +758,20 @@ func PluginCommand(out io.Writer, cmd string, args []string) {
 			fmt.Fprintln(out, "No plugins removed")
 		}
 	case "update":
-		UpdatePlugins(out, args)
+		var plugins []string
+		dryRun := false
+		for _, a := range args {
+			if a == "--dry-run" {
+				dryRun = true
+			} else {
+				plugins = append(plugins, a)
+			}
+		}
+		if dryRun {
+			PreviewPluginUpdates(out, plugins)
+		} else {
+			UpdatePlugins(out, plugins)
+		}
 	case "list":
 		plugins := GetInstalledVersions(false)
 		fmt.Fprintln(out, "The following plugins are currently installed:")
@@ -54,3 +54,55 @@ func TestDependencyResolving(t *testing.T) {
 		t.Error("Unresolvable package resolved:", selected)
 	}
 }
+
+func TestPreviewUpdate(t *testing.T) {
+	js := `
+[{
+  "Name": "Foo",
+  "Versions": [{ "Version": "1.0.0" }, { "Version": "1.5.0" }, { "Version": "1.2.0" }]
+}, {
+  "Name": "Bar",
+  "Versions": []
+}]
+`
+	var all PluginPackages
+	if err := json5.Unmarshal([]byte(js), &all); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, installed, expected string
+	}{
+		{"Foo", "1.0.0", "Foo: 1.0.0 -> 1.5.0"},
+		{"Foo", "1.5.0", "Foo (1.5.0): up to date"},
+		{"Foo", "2.0.0", "Foo (2.0.0): up to date"},
+		{"Bar", "1.0.0", "Bar (1.0.0): not found in the plugin repositories"},
+		{"Baz", "1.0.0", "Baz (1.0.0): not found in the plugin repositories"},
+	}
+	for _, test := range tests {
+		if got := previewUpdate(test.name, test.installed, all.Get(test.name)); got != test.expected {
+			t.Errorf("previewUpdate(%q, %q) = %q, expected %q", test.name, test.installed, got, test.expected)
+		}
+	}
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	js := `
+[{
+  "Name": "Foo",
+  "Versions": [{ "Version": "1.0.0", "Sha256": " 9F86D081884C7D659A2FEAA0C55AD015A3BF4F1B2B0B822CD15D6C15B0F00A08 " }]
+}]
+`
+	var all PluginPackages
+	if err := json5.Unmarshal([]byte(js), &all); err != nil {
+		t.Fatal(err)
+	}
+	pv := all.Get("Foo").Versions[0]
+
+	if err := pv.verifyChecksum([]byte("test")); err != nil {
+		t.Error(err)
+	}
+	if err := pv.verifyChecksum([]byte("tampered")); err == nil {
+		t.Error("Expected a checksum mismatch")
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
 
@@ -35,14 +36,22 @@ func init() {
 
 // Options with validators
 var optionValidators = map[string]optionValidator{
-	"autosave":     validateNonNegativeValue,
-	"tabsize":      validatePositiveValue,
-	"scrollmargin": validateNonNegativeValue,
-	"scrollspeed":  validateNonNegativeValue,
-	"colorscheme":  validateColorscheme,
-	"colorcolumn":  validateNonNegativeValue,
-	"fileformat":   validateLineEnding,
-	"encoding":     validateEncoding,
+	"autosave":           validateNonNegativeValue,
+	"binarycheck":        validateNonNegativeValue,
+	"binaryfile":         validateBinaryFile,
+	"tabsize":            validatePositiveValue,
+	"scrollmargin":       validateNonNegativeValue,
+	"scrollspeed":        validateNonNegativeValue,
+	"colorscheme":        validateColorscheme,
+	"colorcolumn":        validateNonNegativeValue,
+	"fileformat":         validateLineEnding,
+	"shellcmdtimeout":    validateNonNegativeValue,
+	"encoding":           validateEncoding,
+	"headingpattern":     validateRegex,
+	"histsize":           validatePositiveValue,
+	"largefilethreshold": validatePositiveValue,
+	"passwordlength":     validateNonNegativeValue,
+	"wrapwidth":          validatePositiveValue,
 }
 
 func ReadSettings() error {
@@ -183,10 +192,14 @@ func GetGlobalOption(name string) interface{} {
 }
 
 var defaultCommonSettings = map[string]interface{}{
+	"abspath":        false,
+	"autocomment":    false,
 	"autoindent":     true,
 	"autosu":         false,
 	"backup":         true,
 	"basename":       false,
+	"bigfile":        false,
+	"bracepairs":     "(){}[]",
 	"colorcolumn":    float64(0),
 	"cursorline":     true,
 	"diffgutter":     false,
@@ -195,11 +208,15 @@ var defaultCommonSettings = map[string]interface{}{
 	"fastdirty":      false,
 	"fileformat":     "unix",
 	"filetype":       "unknown",
+	"gfpath":         "",
+	"headingpattern": "",
 	"ignorecase":     false,
 	"indentchar":     " ",
+	"joinspace":      true,
 	"keepautoindent": false,
 	"matchbrace":     true,
 	"mkparents":      false,
+	"nameformat":     "$(name) $(modified)",
 	"readonly":       false,
 	"rmtrailingws":   false,
 	"ruler":          true,
@@ -220,6 +237,7 @@ var defaultCommonSettings = map[string]interface{}{
 	"tabsize":        float64(4),
 	"tabstospaces":   false,
 	"useprimary":     true,
+	"wrapwidth":      float64(80),
 }
 
 func GetInfoBarOffset() int {
@@ -246,17 +264,27 @@ func DefaultCommonSettings() map[string]interface{} {
 // a list of settings that should only be globally modified and their
 // default values
 var DefaultGlobalOnlySettings = map[string]interface{}{
-	"autosave":       float64(0),
-	"colorscheme":    "default",
-	"infobar":        true,
-	"keymenu":        false,
-	"mouse":          true,
-	"paste":          false,
-	"savehistory":    true,
-	"sucmd":          "sudo",
-	"pluginchannels": []string{"https://raw.githubusercontent.com/micro-editor/plugin-channel/master/channel.json"},
-	"pluginrepos":    []string{},
-	"xterm":          false,
+	"autosave":           float64(0),
+	"binarycheck":        float64(8000),
+	"binaryfile":         "ask",
+	"colorscheme":        "default",
+	"errorlog":           "",
+	"histsize":           float64(100),
+	"infobar":            true,
+	"keymenu":            false,
+	"largefilethreshold": float64(50000),
+	"mouse":              true,
+	"paste":              false,
+	"passwordlength":     float64(0),
+	"passwordmix":        false,
+	"savehistory":        true,
+	"shellcmdtimeout":    float64(0),
+	"snippetdir":         "",
+	"sucmd":              "sudo",
+	"useshell":           false,
+	"pluginchannels":     []string{"https://raw.githubusercontent.com/micro-editor/plugin-channel/master/channel.json"},
+	"pluginrepos":        []string{},
+	"xterm":              false,
 }
 
 // a list of settings that should never be globally modified
@@ -386,6 +414,34 @@ func validateLineEnding(option string, value interface{}) error {
 	return nil
 }
 
+func validateBinaryFile(option string, value interface{}) error {
+	action, ok := value.(string)
+
+	if !ok {
+		return errors.New("Expected string type for " + option)
+	}
+
+	if action != "ask" && action != "readonly" && action != "open" {
+		return errors.New(option + " must be 'ask', 'readonly' or 'open'")
+	}
+
+	return nil
+}
+
+func validateRegex(option string, value interface{}) error {
+	pattern, ok := value.(string)
+
+	if !ok {
+		return errors.New("Expected string type for " + option)
+	}
+
+	if _, err := regexp.Compile(pattern); err != nil {
+		return errors.New(option + " is not a valid regular expression: " + err.Error())
+	}
+
+	return nil
+}
+
 func validateEncoding(option string, value interface{}) error {
 	_, err := htmlindex.Get(value.(string))
 	return err
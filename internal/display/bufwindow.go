@@ -33,6 +33,7 @@ func NewBufWindow(x, y, width, height int, buf *buffer.Buffer) *BufWindow {
 	w := new(BufWindow)
 	w.View = new(View)
 	w.X, w.Y, w.Width, w.Height, w.Buf = x, y, width, height, buf
+	w.StartLine = util.Clamp(buf.SavedTopLine(), 0, buf.LinesNum()-1)
 	w.active = true
 
 	w.sline = NewStatusLine(w)
@@ -42,6 +43,7 @@ func NewBufWindow(x, y, width, height int, buf *buffer.Buffer) *BufWindow {
 
 func (w *BufWindow) SetBuffer(b *buffer.Buffer) {
 	w.Buf = b
+	w.StartLine = util.Clamp(b.SavedTopLine(), 0, b.LinesNum()-1)
 }
 
 func (w *BufWindow) GetView() *View {
@@ -130,6 +132,11 @@ func (w *BufWindow) Bottomline() int {
 // Returns true if the window location is moved
 func (w *BufWindow) Relocate() bool {
 	b := w.Buf
+	if w.Height <= 0 {
+		// the window has not been sized yet, relocating now would
+		// throw away the restored scroll position
+		return false
+	}
 	// how many buffer lines are in the view
 	height := w.Bottomline() + 1 - w.StartLine
 	h := w.Height
@@ -419,9 +426,9 @@ func (w *BufWindow) displayBuffer() {
 	}
 
 	var matchingBraces []buffer.Loc
-	// bracePairs is defined in buffer.go
+	// the brace pairs come from the bracepairs option
 	if b.Settings["matchbrace"].(bool) {
-		for _, bp := range buffer.BracePairs {
+		for _, bp := range b.BracePairs() {
 			for _, c := range b.GetCursors() {
 				if c.HasSelection() {
 					continue
@@ -713,6 +720,7 @@ func (w *BufWindow) displayScrollBar() {
 
 // Display displays the buffer and the statusline
 func (w *BufWindow) Display() {
+	w.Buf.SetTopLine(w.StartLine)
 	w.displayStatusLine()
 	w.displayScrollBar()
 	w.displayBuffer()
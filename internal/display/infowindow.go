@@ -232,7 +232,18 @@ func (i *InfoWindow) Display() {
 			x += runewidth.RuneWidth(c)
 		}
 
-		if i.HasPrompt {
+		if i.HasChoice {
+			for j, c := range i.Choices {
+				s := style
+				if j == i.ChoiceIndex {
+					s = style.Reverse(true)
+				}
+				for _, r := range " " + c + " " {
+					screen.SetContent(x, i.Y, r, nil, s)
+					x += runewidth.RuneWidth(r)
+				}
+			}
+		} else if i.HasPrompt {
 			i.displayBuffer()
 		}
 	}
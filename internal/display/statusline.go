@@ -33,6 +33,9 @@ var statusInfo = map[string]func(*buffer.Buffer) string{
 	"filename": func(b *buffer.Buffer) string {
 		return b.GetName()
 	},
+	"statusname": func(b *buffer.Buffer) string {
+		return b.StatusName()
+	},
 	"line": func(b *buffer.Buffer) string {
 		return strconv.Itoa(b.GetActiveCursor().Y + 1)
 	},
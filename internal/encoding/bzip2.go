@@ -0,0 +1,34 @@
+package encoding
+
+import (
+	"compress/bzip2"
+	"errors"
+	"io"
+)
+
+// ErrReadOnly is returned when writing a file in an encoding that can only
+// be read
+var ErrReadOnly = errors.New("Files in this format can only be read")
+
+func init() {
+	entry := Entry{
+		Extensions: []string{"bz2"},
+		Settings:   []string{"size"},
+		Encoding:   &bzip2Encoding{},
+	}
+	Add(entry)
+}
+
+type bzip2Encoding struct {
+}
+
+func (b *bzip2Encoding) Encode(writer io.WriteCloser, settings map[string]interface{}) (io.WriteCloser, error) {
+	return writer, ErrReadOnly
+}
+
+func (b *bzip2Encoding) Decode(reader io.Reader, settings map[string]interface{}) (io.Reader, error) {
+	if settings["size"].(int64) == 0 {
+		return reader, nil
+	}
+	return bzip2.NewReader(reader), nil
+}
@@ -3,6 +3,7 @@ package encoding
 import (
 	"bytes"
 	"io/ioutil"
+	"os/exec"
 	"testing"
 )
 
@@ -50,4 +51,51 @@ func TestEncoding(t *testing.T) {
 	test("test.gpg")
 	test("test.asc.gz")
 	test("test.gpg.gz")
+	test("test.gz.asc")
+	test("test.gz.gpg")
+}
+
+// "hello world\nfrom a log\n" compressed with bzip2 and xz
+var bzip2Data = []byte{
+	0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0x38, 0xf1,
+	0x20, 0xd0, 0x00, 0x00, 0x05, 0x51, 0x80, 0x00, 0x10, 0x40, 0x00, 0x27,
+	0xc6, 0x90, 0x80, 0x20, 0x00, 0x31, 0x00, 0xd0, 0x01, 0x08, 0xcc, 0xa6,
+	0x6a, 0x64, 0x1b, 0x08, 0xa5, 0x53, 0xcf, 0xa0, 0x47, 0x5a, 0x72, 0x30,
+	0x68, 0xbb, 0x92, 0x29, 0xc2, 0x84, 0x81, 0xc7, 0x89, 0x06, 0x80,
+}
+
+var xzData = []byte{
+	0xfd, 0x37, 0x7a, 0x58, 0x5a, 0x00, 0x00, 0x04, 0xe6, 0xd6, 0xb4, 0x46,
+	0x02, 0x00, 0x21, 0x01, 0x16, 0x00, 0x00, 0x00, 0x74, 0x2f, 0xe5, 0xa3,
+	0x01, 0x00, 0x16, 0x68, 0x65, 0x6c, 0x6c, 0x6f, 0x20, 0x77, 0x6f, 0x72,
+	0x6c, 0x64, 0x0a, 0x66, 0x72, 0x6f, 0x6d, 0x20, 0x61, 0x20, 0x6c, 0x6f,
+	0x67, 0x0a, 0x00, 0x00, 0xc4, 0xe7, 0x2f, 0x57, 0x08, 0x87, 0x5a, 0xa9,
+	0x00, 0x01, 0x2f, 0x17, 0x81, 0x08, 0x49, 0xb1, 0x1f, 0xb6, 0xf3, 0x7d,
+	0x01, 0x00, 0x00, 0x00, 0x00, 0x04, 0x59, 0x5a,
+}
+
+func TestDecodeCompressed(t *testing.T) {
+	test := func(name string, data []byte) {
+		settings := map[string]interface{}{"size": int64(len(data))}
+		in, err := Decoder(bytes.NewReader(data), name, settings)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := ioutil.ReadAll(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != "hello world\nfrom a log\n" {
+			t.Fatalf("%s decoded to %q", name, string(out))
+		}
+
+		// these formats can only be read
+		if _, err := Encoder(&buffer{}, name, settings); err != ErrReadOnly {
+			t.Fatalf("encoding %s should fail with ErrReadOnly, got %v", name, err)
+		}
+	}
+	test("test.log.bz2", bzip2Data)
+	if _, err := exec.LookPath("xz"); err == nil {
+		test("test.log.xz", xzData)
+	}
 }
@@ -0,0 +1,49 @@
+package encoding
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+func init() {
+	entry := Entry{
+		Extensions: []string{"xz"},
+		Settings:   []string{"size"},
+		Encoding:   &xzEncoding{},
+	}
+	Add(entry)
+}
+
+// xzEncoding decompresses with the xz command since there is no xz
+// decoder in the standard library
+type xzEncoding struct {
+}
+
+func (x *xzEncoding) Encode(writer io.WriteCloser, settings map[string]interface{}) (io.WriteCloser, error) {
+	return writer, ErrReadOnly
+}
+
+func (x *xzEncoding) Decode(reader io.Reader, settings map[string]interface{}) (io.Reader, error) {
+	if settings["size"].(int64) == 0 {
+		return reader, nil
+	}
+	if _, err := exec.LookPath("xz"); err != nil {
+		return reader, errors.New("The xz command is needed to open .xz files")
+	}
+
+	var out, stderr bytes.Buffer
+	cmd := exec.Command("xz", "-dc")
+	cmd.Stdin = reader
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return reader, errors.New(msg)
+		}
+		return reader, err
+	}
+	return &out, nil
+}
@@ -0,0 +1,56 @@
+package info
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/zyedidia/micro/internal/config"
+	"github.com/zyedidia/micro/internal/util"
+)
+
+// errorLine is a line to append to the file of the errorlog option
+type errorLine struct {
+	path string
+	line string
+}
+
+// errorLines are written by a goroutine so that a slow disk never holds
+// up the info bar, and lines are dropped if it falls behind
+var (
+	errorLines    = make(chan errorLine, 100)
+	startErrorLog sync.Once
+)
+
+// logError appends msg with the current time to the file of the errorlog
+// option, if it is set
+func logError(msg string) {
+	path, _ := config.GetGlobalOption("errorlog").(string)
+	if path == "" {
+		return
+	}
+	path, err := util.ReplaceHome(path)
+	if err != nil {
+		return
+	}
+
+	startErrorLog.Do(func() {
+		go writeErrors()
+	})
+	select {
+	case errorLines <- errorLine{path, time.Now().Format("2006-01-02 15:04:05") + " " + msg + "\n"}:
+	default:
+	}
+}
+
+// writeErrors appends the lines sent to errorLines to their files
+func writeErrors() {
+	for e := range errorLines {
+		f, err := os.OpenFile(e.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			continue
+		}
+		f.WriteString(e.line)
+		f.Close()
+	}
+}
@@ -4,8 +4,10 @@ import (
 	"encoding/gob"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/zyedidia/micro/internal/config"
+	"github.com/zyedidia/micro/internal/util"
 )
 
 // LoadHistory attempts to load user history from configDir/buffers/history
@@ -27,6 +29,9 @@ func (i *InfoBuf) LoadHistory() {
 		}
 
 		if decodedMap != nil {
+			for k, v := range decodedMap {
+				decodedMap[k] = trimHistory(v)
+			}
 			i.History = decodedMap
 		} else {
 			i.History = make(map[string][]string)
@@ -40,11 +45,8 @@ func (i *InfoBuf) LoadHistory() {
 // only if the savehistory option is on
 func (i *InfoBuf) SaveHistory() {
 	if config.GetGlobalOption("savehistory").(bool) {
-		// Don't save history past 100
 		for k, v := range i.History {
-			if len(v) > 100 {
-				i.History[k] = v[len(i.History[k])-100:]
-			}
+			i.History[k] = trimHistory(v)
 		}
 
 		file, err := os.Create(filepath.Join(config.ConfigDir, "buffers", "history"))
@@ -61,6 +63,23 @@ func (i *InfoBuf) SaveHistory() {
 	}
 }
 
+// trimHistory removes the entries of h that are the same as the entry
+// before them and drops the oldest entries past the histsize option
+func trimHistory(h []string) []string {
+	trimmed := h[:0]
+	for j, e := range h {
+		if j == 0 || e != h[j-1] {
+			trimmed = append(trimmed, e)
+		}
+	}
+
+	size := util.IntOpt(config.GetGlobalOption("histsize"))
+	if len(trimmed) > size {
+		trimmed = trimmed[len(trimmed)-size:]
+	}
+	return trimmed
+}
+
 // UpHistory fetches the previous item in the history
 func (i *InfoBuf) UpHistory(history []string) {
 	if i.HistoryNum > 0 && i.HasPrompt && !i.HasYN {
@@ -78,3 +97,100 @@ func (i *InfoBuf) DownHistory(history []string) {
 		i.Buffer.GetActiveCursor().GotoLoc(i.End())
 	}
 }
+
+// FindHistory returns the index of the entry of history closest to index
+// from, older or newer than it, that contains query, or -1 if there is none
+func FindHistory(history []string, query string, from int, older bool) int {
+	step := 1
+	if older {
+		step = -1
+	}
+	for j := from + step; j >= 0 && j < len(history); j += step {
+		if strings.Contains(history[j], query) {
+			return j
+		}
+	}
+	return -1
+}
+
+// StartHistorySearch makes the prompt search its history for what is
+// typed into it, or if it already does, finds the next older match
+func (i *InfoBuf) StartHistorySearch() {
+	if !i.HasPrompt || i.HasYN || i.PromptType == "secret" {
+		return
+	}
+	if i.SearchingHistory {
+		i.CycleHistorySearch(true)
+		return
+	}
+
+	// what is typed while searching goes into the last entry rather than
+	// into the one that was fetched with UpHistory
+	h := i.History[i.PromptType]
+	i.HistoryNum = len(h) - 1
+	i.SearchingHistory = true
+	i.searchPrompt = i.Msg
+	i.searchQuery = string(i.LineBytes(0))
+	i.searchMatch = FindHistory(h, i.searchQuery, len(h)-1, true)
+	i.showHistoryMatch()
+}
+
+// UpdateHistorySearch finds the newest entry that matches the text of
+// the prompt again if it has changed
+func (i *InfoBuf) UpdateHistorySearch() {
+	query := string(i.LineBytes(0))
+	if !i.SearchingHistory || query == i.searchQuery {
+		return
+	}
+	i.searchQuery = query
+	h := i.History[i.PromptType]
+	// the last entry is the one being typed
+	i.searchMatch = FindHistory(h, query, len(h)-1, true)
+	i.showHistoryMatch()
+}
+
+// CycleHistorySearch finds the next older or newer entry that matches
+// the text of the prompt, skipping the ones that are the same as the
+// entry already found
+// When the search is empty every entry matches, which moves through the
+// history like UpHistory and DownHistory
+func (i *InfoBuf) CycleHistorySearch(older bool) {
+	h := i.History[i.PromptType]
+	if i.searchMatch < 0 {
+		return
+	}
+	for j := FindHistory(h, i.searchQuery, i.searchMatch, older); j >= 0 && j < len(h)-1; j = FindHistory(h, i.searchQuery, j, older) {
+		if h[j] != h[i.searchMatch] {
+			i.searchMatch = j
+			break
+		}
+	}
+	i.showHistoryMatch()
+}
+
+// EndHistorySearch stops searching the history and, if accept is true,
+// puts the entry that was found into the prompt to be edited or run
+func (i *InfoBuf) EndHistorySearch(accept bool) {
+	if !i.SearchingHistory {
+		return
+	}
+	i.SearchingHistory = false
+	i.Msg = i.searchPrompt
+	h := i.History[i.PromptType]
+	if accept && i.searchMatch >= 0 && i.searchMatch < len(h) {
+		i.Replace(i.Start(), i.End(), h[i.searchMatch])
+		i.Buffer.GetActiveCursor().GotoLoc(i.End())
+	}
+	i.HistoryNum = len(h) - 1
+}
+
+// showHistoryMatch shows the entry found by the history search in front
+// of the text being searched for
+func (i *InfoBuf) showHistoryMatch() {
+	h := i.History[i.PromptType]
+	if i.searchMatch >= 0 && i.searchMatch < len(h) {
+		i.Msg = "(history: " + h[i.searchMatch] + ") "
+	} else {
+		i.Msg = "(history: no match) "
+	}
+}
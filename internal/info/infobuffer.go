@@ -1,9 +1,14 @@
 package info
 
 import (
+	"errors"
 	"fmt"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/zyedidia/micro/internal/buffer"
+	"github.com/zyedidia/micro/internal/config"
+	"github.com/zyedidia/micro/internal/util"
 )
 
 // The InfoBuf displays messages and other info at the bottom of the screen.
@@ -15,6 +20,7 @@ type InfoBuf struct {
 	HasMessage bool
 	HasError   bool
 	HasYN      bool
+	HasChoice  bool
 
 	PromptType string
 
@@ -22,17 +28,32 @@ type InfoBuf struct {
 	YNResp bool
 	Secret []rune
 
+	// Choices are the answers of a ChoicePrompt and ChoiceIndex is the
+	// one that is selected
+	Choices     []string
+	ChoiceIndex int
+
 	// This map stores the history for all the different kinds of uses Prompt has
 	// It's a map of history type -> history array
 	History    map[string][]string
 	HistoryNum int
 
+	// SearchingHistory is whether the prompt searches the history for the
+	// text typed into it, and searchMatch is the index of the entry found
+	SearchingHistory bool
+	searchPrompt     string
+	searchQuery      string
+	searchMatch      int
+
 	// Is the current message a message from the gutter
 	HasGutter bool
 
+	messages messageLog
+
 	PromptCallback func(resp string, canceled bool)
 	EventCallback  func(resp string)
 	YNCallback     func(yes bool, canceled bool)
+	ChoiceCallback func(index int, canceled bool)
 }
 
 // NewBuffer returns a new infobuffer
@@ -52,11 +73,18 @@ func (i *InfoBuf) Close() {
 }
 
 // Message sends a message to the user
+// It is also added to MessageLog, even if a prompt hides it
 func (i *InfoBuf) Message(msg ...interface{}) {
+	displayMessage := fmt.Sprint(msg...)
+	i.messages.add(displayMessage, false)
+	i.message(displayMessage)
+}
+
+// message displays a message without adding it to MessageLog
+func (i *InfoBuf) message(displayMessage string) {
 	// only display a new message if there isn't an active prompt
 	// this is to prevent overwriting an existing prompt to the user
 	if i.HasPrompt == false {
-		displayMessage := fmt.Sprint(msg...)
 		// if there is no active prompt then style and display the message as normal
 		i.Msg = displayMessage
 		i.HasMessage, i.HasError = true, false
@@ -64,27 +92,33 @@ func (i *InfoBuf) Message(msg ...interface{}) {
 }
 
 // GutterMessage displays a message and marks it as a gutter message
+// Gutter messages come back whenever the cursor moves onto their line,
+// so they are not added to MessageLog
 func (i *InfoBuf) GutterMessage(msg ...interface{}) {
-	i.Message(msg...)
+	i.message(fmt.Sprint(msg...))
 	i.HasGutter = true
 }
 
 // ClearGutter clears the info bar and unmarks the message
 func (i *InfoBuf) ClearGutter() {
 	i.HasGutter = false
-	i.Message("")
+	i.message("")
 }
 
 // Error sends an error message to the user
+// It is also added to MessageLog, even if a prompt hides it, and to the
+// file of the errorlog option
 func (i *InfoBuf) Error(msg ...interface{}) {
+	displayMessage := fmt.Sprint(msg...)
+	i.messages.add(displayMessage, true)
+	logError(displayMessage)
 	// only display a new message if there isn't an active prompt
 	// this is to prevent overwriting an existing prompt to the user
 	if i.HasPrompt == false {
 		// if there is no active prompt then style and display the message as normal
-		i.Msg = fmt.Sprint(msg...)
+		i.Msg = displayMessage
 		i.HasMessage, i.HasError = false, true
 	}
-	// TODO: add to log?
 }
 
 // Prompt starts a prompt for the user, it takes a prompt, a possibly partially filled in msg
@@ -116,7 +150,39 @@ func (i *InfoBuf) Prompt(prompt string, msg string, ptype string, eventcb func(s
 }
 
 // PasswordPrompt asks the user for a password and returns the result
+// With verify, for a new password, the password is asked for twice and
+// must follow the passwordlength and passwordmix options
 func (i *InfoBuf) PasswordPrompt(verify bool, callback func(password string, canceled bool)) {
+	i.passwordPrompt(verify, "", callback)
+}
+
+// checkPassword returns an error describing how password breaks the
+// passwordlength and passwordmix options, or nil
+func checkPassword(password string) error {
+	minLength := util.IntOpt(config.GetGlobalOption("passwordlength"))
+	if utf8.RuneCountInString(password) < minLength {
+		return fmt.Errorf("The password must have at least %d characters.", minLength)
+	}
+
+	if config.GetGlobalOption("passwordmix").(bool) {
+		letter, other := false, false
+		for _, r := range password {
+			if unicode.IsLetter(r) {
+				letter = true
+			} else {
+				other = true
+			}
+		}
+		if !letter || !other {
+			return errors.New("The password must have letters and digits or symbols.")
+		}
+	}
+	return nil
+}
+
+// passwordPrompt is PasswordPrompt with msg, such as why the previous
+// password was refused, shown before the prompt
+func (i *InfoBuf) passwordPrompt(verify bool, msg string, callback func(password string, canceled bool)) {
 	eventcb := func(password string) {
 
 	}
@@ -139,18 +205,22 @@ func (i *InfoBuf) PasswordPrompt(verify bool, callback func(password string, can
 			} else if password == verifyPassword {
 				callback(password, canceled)
 			} else {
-				i.PasswordPrompt(verify, callback)
+				i.passwordPrompt(verify, "", callback)
 			}
 		}
 		next := func(password string, canceled bool) {
+			if err := checkPassword(password); err != nil {
+				i.passwordPrompt(verify, err.Error()+" ", callback)
+				return
+			}
 			verifyPassword = password
 			passwordPrompt("Verify Password: ", next1)
 		}
-		passwordPrompt("Password: ", next)
+		passwordPrompt(msg+"Password: ", next)
 		return
 	}
 
-	passwordPrompt("Password: ", callback)
+	passwordPrompt(msg+"Password: ", callback)
 	return
 }
 
@@ -169,12 +239,65 @@ func (i *InfoBuf) YNPrompt(prompt string, donecb func(bool, bool)) {
 	i.YNCallback = donecb
 }
 
+// ChoicePrompt asks the user to pick one of choices, with the arrow keys
+// and Enter or by typing the first letter of a choice, and the callback
+// returns the index of the choice and whether the prompt was canceled
+func (i *InfoBuf) ChoicePrompt(prompt string, choices []string, donecb func(int, bool)) {
+	if i.HasPrompt {
+		i.DonePrompt(true)
+	}
+
+	i.Msg = prompt
+	i.HasPrompt = true
+	i.HasChoice = true
+	i.Choices = choices
+	i.ChoiceIndex = 0
+	i.HasMessage, i.HasError = false, false
+	i.HasGutter = false
+	i.ChoiceCallback = donecb
+}
+
+// NextChoice selects the choice n after the selected one, or before it if
+// n is negative, wrapping around at either end
+func (i *InfoBuf) NextChoice(n int) {
+	if len(i.Choices) == 0 {
+		return
+	}
+	i.ChoiceIndex = ((i.ChoiceIndex+n)%len(i.Choices) + len(i.Choices)) % len(i.Choices)
+}
+
+// PickChoice finishes the prompt with the first choice that starts with
+// r, ignoring case, and returns false if there is none
+func (i *InfoBuf) PickChoice(r rune) bool {
+	for j, c := range i.Choices {
+		if first, _ := utf8.DecodeRuneInString(c); unicode.ToLower(first) == unicode.ToLower(r) {
+			i.ChoiceIndex = j
+			i.DonePrompt(false)
+			return true
+		}
+	}
+	return false
+}
+
 // DonePrompt finishes the current prompt and indicates whether or not it was canceled
 func (i *InfoBuf) DonePrompt(canceled bool) {
 	hadYN := i.HasYN
+	hadChoice := i.HasChoice
+	if i.SearchingHistory {
+		i.EndHistorySearch(!canceled)
+	}
 	i.HasPrompt = false
 	i.HasYN = false
+	i.HasChoice = false
 	i.HasGutter = false
+	if hadChoice {
+		if i.ChoiceCallback != nil {
+			callback := i.ChoiceCallback
+			i.ChoiceCallback = nil
+			callback(i.ChoiceIndex, canceled)
+		}
+		return
+	}
 	if !hadYN {
 		if i.PromptCallback != nil {
 			callback := i.PromptCallback
@@ -184,14 +307,20 @@ func (i *InfoBuf) DonePrompt(canceled bool) {
 				i.History[i.PromptType] = h[:len(h)-1]
 				callback("", true)
 			} else {
+				h := i.History[i.PromptType]
 				if i.PromptType == "secret" {
 					secret := string(i.Secret)
 					i.Secret = []rune{}
+					i.History[i.PromptType] = h[:len(h)-1]
 					callback(secret, false)
 				} else {
 					resp := string(i.LineBytes(0))
-					h := i.History[i.PromptType]
-					h[len(h)-1] = resp
+					if resp == "" {
+						i.History[i.PromptType] = h[:len(h)-1]
+					} else {
+						h[len(h)-1] = resp
+						i.History[i.PromptType] = trimHistory(h)
+					}
 					callback(resp, false)
 				}
 			}
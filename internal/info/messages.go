@@ -0,0 +1,60 @@
+package info
+
+import "time"
+
+// maxMessages is the number of messages and errors that the info bar
+// remembers for MessageLog
+const maxMessages = 1000
+
+// loggedMessage is a message or error shown on the info bar
+type loggedMessage struct {
+	time time.Time
+	msg  string
+	err  bool
+}
+
+// messageLog is a ring buffer of the latest messages and errors
+type messageLog struct {
+	entries []loggedMessage
+	// start is the index of the oldest entry once the log is full
+	start int
+}
+
+// add records msg unless it is empty or repeats the latest entry
+func (l *messageLog) add(msg string, err bool) {
+	if msg == "" {
+		return
+	}
+	if n := len(l.entries); n > 0 {
+		last := l.entries[(l.start+n-1)%n]
+		if last.msg == msg && last.err == err {
+			return
+		}
+	}
+
+	m := loggedMessage{time.Now(), msg, err}
+	if len(l.entries) < maxMessages {
+		l.entries = append(l.entries, m)
+	} else {
+		l.entries[l.start] = m
+		l.start = (l.start + 1) % maxMessages
+	}
+}
+
+// MessageLog returns the messages and errors sent to the info bar, oldest
+// first, each with the time it was sent, including the ones that were
+// replaced before they could be read or that were not shown because a
+// prompt was open
+func (i *InfoBuf) MessageLog() []string {
+	l := &i.messages
+	log := make([]string, len(l.entries))
+	for j := range l.entries {
+		m := l.entries[(l.start+j)%len(l.entries)]
+		line := m.time.Format("15:04:05") + " "
+		if m.err {
+			line += "Error: "
+		}
+		log[j] = line + m.msg
+	}
+	return log
+}
@@ -0,0 +1,213 @@
+// Package remote reads and writes files on other machines over SSH, for
+// paths such as ssh://user@host:port/path/to/file
+package remote
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/user"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	shellquote "github.com/kballard/go-shellquote"
+)
+
+// Scheme is the prefix of remote paths
+const Scheme = "ssh://"
+
+// IsRemote returns whether path names a file on another machine
+func IsRemote(path string) bool {
+	return strings.HasPrefix(path, Scheme)
+}
+
+// A Location is a remote path split into its parts
+type Location struct {
+	User string
+	Host string
+	Port string
+	// Path is the path of the file on the remote machine, which is
+	// relative to the home directory if it does not start with /
+	Path string
+
+	name string
+}
+
+// Parse splits a path such as ssh://user@host:22/path/to/file into its
+// parts
+// The user defaults to the local user and the port to 22, and a path that
+// starts with /~/ is relative to the remote home directory
+func Parse(name string) (Location, error) {
+	if !IsRemote(name) {
+		return Location{}, errors.New(name + " is not an " + Scheme + " path")
+	}
+	rest := name[len(Scheme):]
+	slash := strings.IndexByte(rest, '/')
+	if slash < 0 || slash == len(rest)-1 {
+		return Location{}, errors.New("No file given in " + name)
+	}
+	hostPart, file := rest[:slash], rest[slash:]
+	if strings.HasPrefix(file, "/~/") {
+		file = file[3:]
+	}
+
+	loc := Location{Port: "22", Path: file, name: name}
+	if i := strings.LastIndexByte(hostPart, '@'); i >= 0 {
+		loc.User, hostPart = hostPart[:i], hostPart[i+1:]
+	}
+	if host, port, err := net.SplitHostPort(hostPart); err == nil {
+		loc.Host, loc.Port = host, port
+	} else {
+		loc.Host = strings.Trim(hostPart, "[]")
+	}
+	if loc.Host == "" {
+		return Location{}, errors.New("No host given in " + name)
+	}
+	if loc.User == "" {
+		if u, err := user.Current(); err == nil {
+			loc.User = u.Username
+		}
+	}
+	return loc, nil
+}
+
+// exit codes of the scripts run on the remote machine
+const (
+	exitNotExist   = 3
+	exitPermission = 4
+	exitIsDir      = 5
+)
+
+// run runs script with the shell of the remote machine and returns what it
+// printed
+// The exit codes above are turned into the matching errors of package os
+// so that os.IsNotExist and os.IsPermission work with them
+func (l Location) run(op, script string, stdin io.Reader) ([]byte, error) {
+	s, err := newSession(l)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+
+	var out, stderr bytes.Buffer
+	s.Stdin, s.Stdout, s.Stderr = stdin, &out, &stderr
+	if err := s.Run(script); err != nil {
+		switch exitStatus(err) {
+		case exitNotExist:
+			return nil, &os.PathError{Op: op, Path: l.name, Err: os.ErrNotExist}
+		case exitPermission:
+			return nil, &os.PathError{Op: op, Path: l.name, Err: os.ErrPermission}
+		case exitIsDir:
+			return nil, &os.PathError{Op: op, Path: l.name, Err: errors.New("is a directory")}
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, errors.New(msg)
+		}
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// Open returns the contents of the remote file
+// The whole file is read when it is opened
+func Open(name string) (io.ReadCloser, error) {
+	l, err := Parse(name)
+	if err != nil {
+		return nil, err
+	}
+	p := shellquote.Join(l.Path)
+	data, err := l.run("open", "[ -e "+p+" ] || exit 3; [ -d "+p+" ] && exit 5; [ -r "+p+" ] || exit 4; cat < "+p, nil)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+// A writer keeps what is written to a remote file and sends it when it is
+// closed
+type writer struct {
+	l    Location
+	data bytes.Buffer
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	return w.data.Write(p)
+}
+
+func (w *writer) Close() error {
+	p := shellquote.Join(w.l.Path)
+	_, err := w.l.run("write", "[ -d "+p+" ] && exit 5; [ -e "+p+" ] && [ ! -w "+p+" ] && exit 4; cat > "+p, &w.data)
+	return err
+}
+
+// Create returns a writer that replaces the contents of the remote file,
+// creating it if it does not exist
+// Nothing is written until the writer is closed, and Close returns the
+// error if writing failed
+func Create(name string) (io.WriteCloser, error) {
+	l, err := Parse(name)
+	if err != nil {
+		return nil, err
+	}
+	return &writer{l: l}, nil
+}
+
+// fileInfo describes a remote file
+type fileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (f *fileInfo) Name() string       { return f.name }
+func (f *fileInfo) Size() int64        { return f.size }
+func (f *fileInfo) ModTime() time.Time { return f.modTime }
+func (f *fileInfo) IsDir() bool        { return f.dir }
+func (f *fileInfo) Sys() interface{}   { return nil }
+
+func (f *fileInfo) Mode() os.FileMode {
+	if f.dir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
+
+// Stat returns the size and modification time of the remote file, with
+// GNU or BSD stat
+func Stat(name string) (os.FileInfo, error) {
+	l, err := Parse(name)
+	if err != nil {
+		return nil, err
+	}
+	p := shellquote.Join(l.Path)
+	out, err := l.run("stat", "[ -e "+p+" ] || exit 3; stat -L -c '%s %Y %F' "+p+" 2>/dev/null || stat -L -f '%z %m %HT' "+p, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := strings.Fields(string(out))
+	if len(fields) < 3 {
+		return nil, errors.New("Cannot read the size of " + name)
+	}
+	size, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	mtime, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	kind := strings.ToLower(strings.Join(fields[2:], " "))
+	return &fileInfo{
+		name:    path.Base(l.Path),
+		size:    size,
+		modTime: time.Unix(mtime, 0),
+		dir:     strings.Contains(kind, "directory"),
+	}, nil
+}
@@ -0,0 +1,31 @@
+package remote
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		want Location
+	}{
+		{"ssh://me@example.com/etc/hosts", Location{User: "me", Host: "example.com", Port: "22", Path: "/etc/hosts"}},
+		{"ssh://me@example.com:2222/~/notes.txt", Location{User: "me", Host: "example.com", Port: "2222", Path: "notes.txt"}},
+		{"ssh://me@[::1]:2222/a", Location{User: "me", Host: "::1", Port: "2222", Path: "/a"}},
+	}
+	for _, test := range tests {
+		l, err := Parse(test.name)
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", test.name, err)
+			continue
+		}
+		l.name = ""
+		if l != test.want {
+			t.Errorf("Parse(%q) = %+v, want %+v", test.name, l, test.want)
+		}
+	}
+
+	for _, name := range []string{"/etc/hosts", "ssh://example.com", "ssh://example.com/", "ssh:///etc/hosts"} {
+		if _, err := Parse(name); err == nil {
+			t.Errorf("Parse(%q) should fail", name)
+		}
+	}
+}
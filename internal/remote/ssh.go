@@ -0,0 +1,145 @@
+package remote
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// keyFiles are the private keys in ~/.ssh that are tried, after the keys of
+// the SSH agent
+// Keys protected by a passphrase can only be used through the agent
+var keyFiles = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+// connections are kept open so that every read or write of a file does not
+// have to log in again
+var (
+	clientsLock sync.Mutex
+	clients     = make(map[string]*ssh.Client)
+)
+
+func (l Location) addr() string {
+	return net.JoinHostPort(l.Host, l.Port)
+}
+
+func (l Location) key() string {
+	return l.User + "@" + l.addr()
+}
+
+// clientConfig logs in as user with the SSH agent and the private keys in
+// ~/.ssh, and only accepts hosts listed in ~/.ssh/known_hosts
+func clientConfig(user string) (*ssh.ClientConfig, error) {
+	home, err := homedir.Dir()
+	if err != nil {
+		return nil, err
+	}
+	hostKeys, err := knownhosts.New(filepath.Join(home, ".ssh", "known_hosts"))
+	if err != nil {
+		return nil, err
+	}
+
+	var auth []ssh.AuthMethod
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			auth = append(auth, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+	var signers []ssh.Signer
+	for _, name := range keyFiles {
+		data, err := ioutil.ReadFile(filepath.Join(home, ".ssh", name))
+		if err != nil {
+			continue
+		}
+		if signer, err := ssh.ParsePrivateKey(data); err == nil {
+			signers = append(signers, signer)
+		}
+	}
+	if len(signers) > 0 {
+		auth = append(auth, ssh.PublicKeys(signers...))
+	}
+	if len(auth) == 0 {
+		return nil, errors.New("No SSH agent or private key without a passphrase to log in with")
+	}
+
+	return &ssh.ClientConfig{
+		User:            user,
+		Auth:            auth,
+		HostKeyCallback: hostKeys,
+		Timeout:         10 * time.Second,
+	}, nil
+}
+
+// client returns the open connection to the location's host, connecting
+// first if there is none
+func client(l Location) (*ssh.Client, error) {
+	clientsLock.Lock()
+	defer clientsLock.Unlock()
+
+	if c, ok := clients[l.key()]; ok {
+		return c, nil
+	}
+	config, err := clientConfig(l.User)
+	if err != nil {
+		return nil, err
+	}
+	c, err := ssh.Dial("tcp", l.addr(), config)
+	if err != nil {
+		return nil, err
+	}
+	clients[l.key()] = c
+	return c, nil
+}
+
+// newSession starts a session on the location's host, connecting again
+// once if the open connection was lost
+func newSession(l Location) (*ssh.Session, error) {
+	c, err := client(l)
+	if err != nil {
+		return nil, err
+	}
+	s, err := c.NewSession()
+	if err == nil {
+		return s, nil
+	}
+
+	clientsLock.Lock()
+	if clients[l.key()] == c {
+		delete(clients, l.key())
+	}
+	clientsLock.Unlock()
+	c.Close()
+
+	if c, err = client(l); err != nil {
+		return nil, err
+	}
+	return c.NewSession()
+}
+
+// CloseAll closes the open connections, for when micro exits
+func CloseAll() {
+	clientsLock.Lock()
+	defer clientsLock.Unlock()
+
+	for key, c := range clients {
+		c.Close()
+		delete(clients, key)
+	}
+}
+
+// exitStatus returns the exit status of a command that failed on the
+// remote machine, or -1 if it did not run to the end
+func exitStatus(err error) int {
+	if e, ok := err.(*ssh.ExitError); ok {
+		return e.ExitStatus()
+	}
+	return -1
+}
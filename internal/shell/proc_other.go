@@ -0,0 +1,11 @@
+// +build plan9 nacl windows
+
+package shell
+
+import "os/exec"
+
+func setProcessGroup(cmd *exec.Cmd) {}
+
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
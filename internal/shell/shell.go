@@ -2,15 +2,21 @@ package shell
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"os/signal"
+	"runtime"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	shellquote "github.com/kballard/go-shellquote"
+	"github.com/zyedidia/micro/internal/config"
 	"github.com/zyedidia/micro/internal/screen"
 )
 
@@ -31,57 +37,241 @@ func ExecCommand(name string, arg ...string) (string, error) {
 	return outstring, err
 }
 
+// ExecCommandOutput executes a command using exec
+// Unlike ExecCommand it keeps what the command wrote to stdout and stderr
+// apart, so that results can be told from diagnostics
+func ExecCommandOutput(name string, arg ...string) (string, string, error) {
+	return execSeparate(nil, name, arg...)
+}
+
+// ExecCommandWithInput executes a command using exec, feeding it the given
+// input on stdin
+// It returns what the command wrote to stdout; if the command fails the
+// error includes what it wrote to stderr
+func ExecCommandWithInput(input string, name string, arg ...string) (string, error) {
+	stdout, stderr, err := execSeparate(strings.NewReader(input), name, arg...)
+	if err != nil {
+		if msg := strings.TrimSpace(stderr); msg != "" {
+			err = fmt.Errorf("%v: %s", err, msg)
+		}
+	}
+	return stdout, err
+}
+
+// ExecCommandFrom executes a command like ExecCommandWithInput, but the
+// input is written to the command's stdin by write while the command reads
+// it, so that a large input does not have to be built as one string first
+func ExecCommandFrom(write func(io.Writer) error, name string, arg ...string) (string, error) {
+	r, w := io.Pipe()
+	go func() {
+		w.CloseWithError(write(w))
+	}()
+	stdout, stderr, err := execSeparate(r, name, arg...)
+	// the command may exit without reading all of its input, which must
+	// not leave write blocked
+	r.Close()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr); msg != "" {
+			err = fmt.Errorf("%v: %s", err, msg)
+		}
+	}
+	return stdout, err
+}
+
+// execSeparate runs a command with the given stdin, which may be nil, and
+// returns its stdout and stderr separately
+func execSeparate(stdin io.Reader, name string, arg ...string) (string, string, error) {
+	cmd := exec.Command(name, arg...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	return stdout.String(), stderr.String(), err
+}
+
+// splitCommand returns the program and arguments to run for the given
+// command line
+// If the useshell option is on the whole command line is passed to the
+// user's shell, so that quoting, pipes and redirections work as they would
+// in a terminal
+func splitCommand(input string) ([]string, error) {
+	if strings.TrimSpace(input) == "" {
+		return nil, errors.New("No arguments")
+	}
+	if useShell, _ := config.GetGlobalOption("useshell").(bool); useShell {
+		if runtime.GOOS == "windows" {
+			return []string{"cmd", "/C", input}, nil
+		}
+		sh := os.Getenv("SHELL")
+		if sh == "" {
+			sh = "sh"
+		}
+		return []string{sh, "-c", input}, nil
+	}
+
+	return shellquote.Split(input)
+}
+
+// ExitCode returns the exit code of a command from the error returned
+// when running it: 0 if there was no error and -1 if the command could
+// not be run at all
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			return status.ExitStatus()
+		}
+	}
+	return -1
+}
+
 // RunCommand executes a shell command and returns the output/error
 func RunCommand(input string) (string, error) {
-	args, err := shellquote.Split(input)
+	args, err := splitCommand(input)
 	if err != nil {
 		return "", err
 	}
-	if len(args) == 0 {
-		return "", errors.New("No arguments")
+
+	return ExecCommand(args[0], args[1:]...)
+}
+
+// RunCommandOutput is the same as RunCommand but returns the command's
+// stdout and stderr separately
+func RunCommandOutput(input string) (string, string, error) {
+	args, err := splitCommand(input)
+	if err != nil {
+		return "", "", err
 	}
-	inputCmd := args[0]
 
-	return ExecCommand(inputCmd, args[1:]...)
+	return ExecCommandOutput(args[0], args[1:]...)
+}
+
+var (
+	// ErrTimeout is returned when a background command runs for longer
+	// than the shellcmdtimeout option allows
+	ErrTimeout = errors.New("command timed out")
+	// ErrKilled is returned when a background command is stopped with
+	// KillBackgroundShells
+	ErrKilled = errors.New("command was killed")
+)
+
+var (
+	backgroundLock    sync.Mutex
+	backgroundCancels = make(map[*exec.Cmd]context.CancelFunc)
+)
+
+// KillBackgroundShells kills every command started by RunBackgroundShell
+// that is still running
+// It returns the number of commands that were killed
+func KillBackgroundShells() int {
+	backgroundLock.Lock()
+	defer backgroundLock.Unlock()
+
+	for _, cancel := range backgroundCancels {
+		cancel()
+	}
+	return len(backgroundCancels)
+}
+
+// execBackground executes a command like ExecCommand, but kills it along
+// with the processes it started if it runs for longer than the
+// shellcmdtimeout option allows or if KillBackgroundShells is called
+func execBackground(name string, arg ...string) (string, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if timeout, _ := config.GetGlobalOption("shellcmdtimeout").(float64); timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, time.Duration(timeout*float64(time.Second)))
+		defer cancelTimeout()
+	}
+
+	cmd := exec.Command(name, arg...)
+	outputBytes := &bytes.Buffer{}
+	cmd.Stdout = outputBytes
+	cmd.Stderr = outputBytes
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+
+	backgroundLock.Lock()
+	backgroundCancels[cmd] = cancel
+	backgroundLock.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			killProcessGroup(cmd)
+		case <-done:
+		}
+	}()
+
+	err := cmd.Wait()
+	close(done)
+
+	backgroundLock.Lock()
+	delete(backgroundCancels, cmd)
+	backgroundLock.Unlock()
+
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		err = ErrTimeout
+	case context.Canceled:
+		err = ErrKilled
+	}
+	return outputBytes.String(), err
 }
 
 // RunBackgroundShell runs a shell command in the background
 // It returns a function which will run the command and returns a string
 // message result
+// The command is killed if it runs for longer than the shellcmdtimeout
+// option allows
 func RunBackgroundShell(input string) (func() string, error) {
-	args, err := shellquote.Split(input)
+	runf, err := RunBackgroundShellExit(input)
 	if err != nil {
 		return nil, err
 	}
-	if len(args) == 0 {
-		return nil, errors.New("No arguments")
-	}
-	inputCmd := args[0]
 	return func() string {
-		output, err := RunCommand(input)
+		str, _ := runf()
+		return str
+	}, nil
+}
+
+// RunBackgroundShellExit is the same as RunBackgroundShell but the
+// function it returns also returns the command's exit code
+func RunBackgroundShellExit(input string) (func() (string, int), error) {
+	args, err := splitCommand(input)
+	if err != nil {
+		return nil, err
+	}
+	inputCmd := strings.Fields(input)[0]
+	return func() (string, int) {
+		output, err := execBackground(args[0], args[1:]...)
 		totalLines := strings.Split(output, "\n")
 
 		str := output
-		if len(totalLines) < 3 {
+		if len(totalLines) < 3 || err == ErrTimeout || err == ErrKilled {
 			if err == nil {
 				str = fmt.Sprint(inputCmd, " exited without error")
 			} else {
 				str = fmt.Sprint(inputCmd, " exited with error: ", err, ": ", output)
 			}
 		}
-		return str
+		return str, ExitCode(err)
 	}, nil
 }
 
 // RunInteractiveShell runs a shellcommand interactively
 func RunInteractiveShell(input string, wait bool, getOutput bool) (string, error) {
-	args, err := shellquote.Split(input)
+	args, err := splitCommand(input)
 	if err != nil {
 		return "", err
 	}
-	if len(args) == 0 {
-		return "", errors.New("No arguments")
-	}
 	inputCmd := args[0]
 
 	// Shut down the screen because we're going to interact directly with the shell
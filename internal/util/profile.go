@@ -13,7 +13,9 @@ import (
 func GetMemStats() string {
 	var memstats runtime.MemStats
 	runtime.ReadMemStats(&memstats)
-	return fmt.Sprintf("Alloc: %s, Sys: %s, GC: %d, PauseTotalNs: %dns", humanize.Bytes(memstats.Alloc), humanize.Bytes(memstats.Sys), memstats.NumGC, memstats.PauseTotalNs)
+	return fmt.Sprintf("Alloc: %s, Sys: %s, HeapInuse: %s, HeapObjects: %d, Goroutines: %d, GC: %d, PauseTotalNs: %dns",
+		humanize.Bytes(memstats.Alloc), humanize.Bytes(memstats.Sys), humanize.Bytes(memstats.HeapInuse),
+		memstats.HeapObjects, runtime.NumGoroutine(), memstats.NumGC, memstats.PauseTotalNs)
 }
 
 func Tic(s string) time.Time {
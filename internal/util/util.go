@@ -308,21 +308,36 @@ func ReplaceHome(path string) (string, error) {
 	return strings.Replace(path, homeString, home, 1), nil
 }
 
+// cursorPosRegex matches a path followed by an optional line and column,
+// such as util.go:10:5, and possibly by a trailing colon
+var cursorPosRegex = regexp.MustCompile(`^([\s\S]+?)(?::(\d+))?(?::(\d+))?:?$`)
+
 // GetPathAndCursorPosition returns a filename without everything following a `:`
 // This is used for opening files like util.go:10:5 to specify a line and column
 // Special cases like Windows Absolute path (C:\myfile.txt:10:5) are handled correctly.
+// A trailing colon, as in util.go:10: or util.go:, is ignored, and only
+// colons and digits may follow the filename, so that names with colons
+// in them are kept whole
 func GetPathAndCursorPosition(path string) (string, []string) {
-	re := regexp.MustCompile(`([\s\S]+?)(?::(\d+))(?::(\d+))?`)
-	match := re.FindStringSubmatch(path)
+	// the colon of a drive letter, as in C:\ or C:, is part of the path
+	drive := ""
+	if len(path) >= 2 && path[1] == ':' && unicode.IsLetter(rune(path[0])) &&
+		(len(path) == 2 || path[2] == '\\' || path[2] == '/') {
+		drive, path = path[:2], path[2:]
+	}
+
+	match := cursorPosRegex.FindStringSubmatch(path)
 	// no lines/columns were specified in the path, return just the path with no cursor location
 	if len(match) == 0 {
-		return path, nil
-	} else if match[len(match)-1] != "" {
+		return drive + path, nil
+	} else if match[2] == "" {
+		return drive + match[1], nil
+	} else if match[3] != "" {
 		// if the last capture group match isn't empty then both line and column were provided
-		return match[1], match[2:]
+		return drive + match[1], match[2:]
 	}
 	// if it was empty, then only a line was provided, so default to column 0
-	return match[1], []string{match[2], "0"}
+	return drive + match[1], []string{match[2], "0"}
 }
 
 // GetModTime returns the last modification time for a given file
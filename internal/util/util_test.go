@@ -31,3 +31,31 @@ func TestSliceVisualEnd(t *testing.T) {
 	assert.Equal(t, []byte("ello"), slc)
 	assert.Equal(t, 0, n)
 }
+
+func TestGetPathAndCursorPosition(t *testing.T) {
+	tests := []struct {
+		in   string
+		path string
+		pos  []string
+	}{
+		{"util.go", "util.go", nil},
+		{"util.go:10", "util.go", []string{"10", "0"}},
+		{"util.go:10:5", "util.go", []string{"10", "5"}},
+		{"util.go:10:", "util.go", []string{"10", "0"}},
+		{"util.go:10:5:", "util.go", []string{"10", "5"}},
+		{"util.go:", "util.go", nil},
+		{"/tmp/a:b/util.go:3", "/tmp/a:b/util.go", []string{"3", "0"}},
+		{"notes:2020.txt", "notes:2020.txt", nil},
+		{"a:10", "a", []string{"10", "0"}},
+		{`C:\foo.go`, `C:\foo.go`, nil},
+		{`C:\foo.go:10:2`, `C:\foo.go`, []string{"10", "2"}},
+		{`C:\foo.go:10:`, `C:\foo.go`, []string{"10", "0"}},
+		{"C:/foo.go:7", "C:/foo.go", []string{"7", "0"}},
+		{"C:", "C:", nil},
+	}
+	for _, test := range tests {
+		path, pos := GetPathAndCursorPosition(test.in)
+		assert.Equal(t, test.path, path, test.in)
+		assert.Equal(t, test.pos, pos, test.in)
+	}
+}
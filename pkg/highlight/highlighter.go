@@ -392,6 +392,55 @@ func (h *Highlighter) ReHighlightStates(input LineStates, startline int) int {
 	return input.LinesNum() - 1
 }
 
+// DirtyLineStates is a LineStates whose lines can be marked as dirty when
+// they are edited, so that only those lines are highlighted again
+type DirtyLineStates interface {
+	LineStates
+	Rehighlight(lineN int) bool
+	SetRehighlight(lineN int, on bool)
+}
+
+// ReHighlightDirty sets the end of line state again for the dirty lines
+// from startline to endline and clears their marks
+// After a line whose state changed it keeps going until a line ends in the
+// same state as before, since the lines below it are still correct
+// It returns the first and last lines whose states were set, or -1, -1 if
+// there were none
+func (h *Highlighter) ReHighlightDirty(input DirtyLineStates, startline, endline int) (int, int) {
+	first, last := -1, -1
+	converged := true
+	for i := startline; i < input.LinesNum(); i++ {
+		dirty := input.Rehighlight(i)
+		if !dirty && converged {
+			if i >= endline {
+				break
+			}
+			continue
+		}
+
+		h.lastRegion = nil
+		if i > 0 {
+			h.lastRegion = input.State(i - 1)
+		}
+		line := input.LineBytes(i)
+		if i == 0 || h.lastRegion == nil {
+			h.highlightEmptyRegion(nil, 0, true, i, line, true)
+		} else {
+			h.highlightRegion(nil, 0, true, i, line, h.lastRegion, true)
+		}
+		curState := h.lastRegion
+		converged = curState == input.State(i)
+
+		input.SetState(i, curState)
+		input.SetRehighlight(i, false)
+		if first < 0 {
+			first = i
+		}
+		last = i
+	}
+	return first, last
+}
+
 // ReHighlightLine will rehighlight the state and match for a single line
 func (h *Highlighter) ReHighlightLine(input LineStates, lineN int) {
 	line := input.LineBytes(lineN)
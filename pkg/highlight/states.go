@@ -0,0 +1,80 @@
+package highlight
+
+// EndState returns the state at the end of a line that starts in the given
+// state, without storing it anywhere
+// It is the state that HighlightStates would set for the line
+func (h *Highlighter) EndState(line []byte, lineN int, start State) State {
+	h.lastRegion = nil
+	if lineN == 0 || start == nil {
+		h.highlightEmptyRegion(nil, 0, true, lineN, line, true)
+	} else {
+		h.highlightRegion(nil, 0, true, lineN, line, start, true)
+	}
+	return h.lastRegion
+}
+
+// regionList returns the regions of the definition in a fixed order:
+// depth first, in the order they appear in the syntax file
+func (d *Def) regionList() []*region {
+	var list []*region
+	seen := make(map[*region]bool)
+	var walk func(r *rules)
+	walk = func(r *rules) {
+		if r == nil {
+			return
+		}
+		for _, reg := range r.regions {
+			if seen[reg] {
+				continue
+			}
+			seen[reg] = true
+			list = append(list, reg)
+			walk(reg.rules)
+		}
+	}
+	walk(d.rules)
+	return list
+}
+
+// EncodeStates converts states computed with this definition to numbers
+// that do not depend on where the regions are in memory, for saving them
+// 0 stands for a nil state and n for the nth region of the definition
+// It returns false if a state does not belong to the definition
+func (d *Def) EncodeStates(states []State) ([]int, bool) {
+	index := make(map[*region]int)
+	for i, r := range d.regionList() {
+		index[r] = i + 1
+	}
+
+	codes := make([]int, len(states))
+	for i, s := range states {
+		if s == nil {
+			continue
+		}
+		n, ok := index[s]
+		if !ok {
+			return nil, false
+		}
+		codes[i] = n
+	}
+	return codes, true
+}
+
+// DecodeStates converts numbers from EncodeStates back to states of this
+// definition
+// It returns false if a number does not name a region of the definition,
+// which happens when the syntax file changed in the meantime
+func (d *Def) DecodeStates(codes []int) ([]State, bool) {
+	regions := d.regionList()
+
+	states := make([]State, len(codes))
+	for i, n := range codes {
+		if n < 0 || n > len(regions) {
+			return nil, false
+		}
+		if n > 0 {
+			states[i] = regions[n-1]
+		}
+	}
+	return states, true
+}